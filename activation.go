@@ -0,0 +1,52 @@
+package main
+
+// systemd socket activation, where systemd opens the listening socket and
+// passes it to the server. The socket stays open while the server restarts,
+// so connections wait instead of being refused.
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd. It's a
+// variable so tests can pass a different one.
+var listenFDsStart = 3
+
+// inheritedListener returns the first listener passed to the process with
+// systemd socket activation, or nil if there isn't one. The LISTEN_*
+// environment variables are unset, so child processes don't try to use the
+// same socket.
+func inheritedListener() (net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if pid == "" || fds == "" {
+		return nil, nil
+	}
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	// The variables are meant for a different process, like a parent that
+	// didn't unset them.
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	if n > 1 {
+		logger.Warn("Got more than one socket from systemd; only using the first", "count", n)
+	}
+	f := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_"+strconv.Itoa(listenFDsStart))
+	ln, err := net.FileListener(f)
+	// FileListener dups the descriptor, so the original isn't needed.
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("using socket from systemd: %v", err)
+	}
+	return ln, nil
+}
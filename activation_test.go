@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInheritedListener(t *testing.T) {
+	defer live.Store(getLive())
+	// Simulate systemd: open a socket and pass its descriptor in the
+	// environment.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+	defer f.Close()
+	defer func(start int) { listenFDsStart = start }(listenFDsStart)
+	listenFDsStart = int(f.Fd())
+	defer setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))()
+	defer setenv("LISTEN_FDS", "1")()
+
+	c := testConfig()
+	// The config asks for a different address; the inherited socket wins.
+	c.BindAddress = "127.0.0.1"
+	port := 0
+	c.Port = &port
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run(ctx) }()
+
+	res, err := http.Get("http://" + addr + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("GET /healthz: got code %d, want 200", res.StatusCode)
+	}
+	if v := os.Getenv("LISTEN_FDS"); v != "" {
+		t.Errorf("expected LISTEN_FDS to be unset, got %q", v)
+	}
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after the context was canceled")
+	}
+}
+
+func TestInheritedListenerOtherProcess(t *testing.T) {
+	defer setenv("LISTEN_PID", "1")()
+	defer setenv("LISTEN_FDS", "1")()
+	ln, err := inheritedListener()
+	if ln != nil || err != nil {
+		t.Errorf("got %v, %v, want nil, nil", ln, err)
+	}
+}
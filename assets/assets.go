@@ -1,6 +1,51 @@
+// Package assets contains the static files and templates for the server,
+// embedded in the binary when it's built.
 package assets
 
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// FS contains the "static" and "templates" folders.
+//
+//go:embed static templates
+var FS embed.FS
+
+// Asset returns the contents of the named asset, like "static/style.css".
+func Asset(name string) ([]byte, error) {
+	return FS.ReadFile(name)
+}
+
+// MustAsset is like Asset, but panics if the asset can't be read.
+func MustAsset(name string) []byte {
+	data, err := Asset(name)
+	if err != nil {
+		panic("asset: Asset(" + name + "): " + err.Error())
+	}
+	return data
+}
+
 // MustAssetString returns the asset contents as a string (instead of a []byte).
 func MustAssetString(name string) string {
 	return string(MustAsset(name))
 }
+
+// AssetInfo returns information about the named asset. Embedded files don't
+// have a modification time.
+func AssetInfo(name string) (os.FileInfo, error) {
+	return fs.Stat(FS, name)
+}
+
+// AssetNames returns the names of all of the assets.
+func AssetNames() []string {
+	var names []string
+	fs.WalkDir(FS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names
+}
@@ -0,0 +1,45 @@
+package assets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHomepageTemplate(t *testing.T) {
+	if html := MustAssetString("templates/index.html"); !strings.Contains(html, "Hello World") {
+		t.Errorf("templates/index.html: expected 'Hello World', got %s", html)
+	}
+}
+
+func TestStaticFile(t *testing.T) {
+	data, err := Asset("static/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "font-family") {
+		t.Errorf("static/style.css: got %s", data)
+	}
+	info, err := AssetInfo("static/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(data)) {
+		t.Errorf("AssetInfo: got size %d, want %d", info.Size(), len(data))
+	}
+	if _, err := Asset("static/missing.css"); err == nil {
+		t.Error("expected an error for a missing asset, got nil")
+	}
+}
+
+func TestAssetNames(t *testing.T) {
+	names := AssetNames()
+	found := make(map[string]bool)
+	for _, name := range names {
+		found[name] = true
+	}
+	for _, want := range []string{"static/style.css", "templates/index.html"} {
+		if !found[want] {
+			t.Errorf("AssetNames: %q missing from %q", want, names)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+// The service worker, served at /service-worker.js so it controls every page
+// on the site. Browsers check for a new version on every navigation; it's
+// served with "Cache-Control: no-cache" so they always get the latest one.
+//
+// It doesn't cache anything yet. To make pages work offline, cache them in the
+// install event and answer requests from the cache in a fetch listener.
+
+self.addEventListener("install", function() {
+  self.skipWaiting();
+});
+
+self.addEventListener("activate", function(event) {
+  event.waitUntil(self.clients.claim());
+});
@@ -0,0 +1,47 @@
+package main
+
+// HTTP Basic Auth for internal tools.
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/kevinburke/rest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against the password when the username is wrong, so
+// the response takes as long as it does for a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// requireBasicAuth returns middleware that only lets through requests with
+// basic auth credentials for user and a password matching the bcrypt hash.
+// Other requests get a 401 with a WWW-Authenticate header for realm. If user
+// is empty, every request is rejected.
+func requireBasicAuth(realm, user string, hash []byte) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !checkBasicAuth(r, user, hash) {
+				rest.Unauthorized(w, r, realm)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkBasicAuth reports whether r has basic auth credentials for user and a
+// password matching hash. Both the username and the password are always
+// checked, so the time taken doesn't reveal which was wrong.
+func checkBasicAuth(r *http.Request, user string, hash []byte) bool {
+	gotUser, gotPass, ok := r.BasicAuth()
+	if !ok || user == "" {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(gotUser), []byte(user)) == 1
+	if !userOK {
+		hash = dummyHash
+	}
+	passOK := bcrypt.CompareHashAndPassword(hash, []byte(gotPass)) == nil
+	return userOK && passOK
+}
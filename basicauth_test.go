@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testPasswordHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestRequireBasicAuth(t *testing.T) {
+	hash := testPasswordHash(t, "hunter2")
+	h := requireBasicAuth("admin", "admin", []byte(hash))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	tests := []struct {
+		name       string
+		user, pass string
+		set        bool
+		code       int
+	}{
+		{"correct credentials", "admin", "hunter2", true, 200},
+		{"wrong password", "admin", "wrong", true, 401},
+		{"wrong user", "root", "hunter2", true, 401},
+		{"missing header", "", "", false, 401},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		if tt.set {
+			req.SetBasicAuth(tt.user, tt.pass)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s: got code %d, want %d", tt.name, w.Code, tt.code)
+		}
+		if tt.code == 401 {
+			if got := w.Header().Get("WWW-Authenticate"); got != `Basic realm="admin"` {
+				t.Errorf("%s: got WWW-Authenticate %q", tt.name, got)
+			}
+			if w.Body.String() == "secret" {
+				t.Errorf("%s: expected the handler not to run", tt.name)
+			}
+		}
+	}
+
+	// With no user configured, nothing gets through.
+	h = requireBasicAuth("admin", "", nil)(http.NotFoundHandler())
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.SetBasicAuth("", "")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Errorf("no user: got code %d, want 401", w.Code)
+	}
+}
+
+func TestAdminAuthMetrics(t *testing.T) {
+	c := testConfig()
+	c.AdminUser = "admin"
+	c.AdminPasswordHash = testPasswordHash(t, "hunter2")
+	c.Pprof = true
+	c.MetricsAllow = DefaultMetricsAllow
+	mux := NewServeMux(c)
+	for _, path := range []string{"/metrics", "/debug/pprof/"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 401 {
+			t.Errorf("GET %s without credentials: got code %d, want 401", path, w.Code)
+		}
+		req.SetBasicAuth("admin", "hunter2")
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Errorf("GET %s with credentials: got code %d, want 200", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+// Decoding request bodies into structs.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A bindError means the request body couldn't be decoded, and the client
+// should get a 400 Bad Request. Its message is safe to show to the client.
+type bindError struct {
+	msg string
+}
+
+func (e *bindError) Error() string {
+	return e.msg
+}
+
+func newBindError(format string, args ...interface{}) error {
+	return &bindError{msg: fmt.Sprintf(format, args...)}
+}
+
+// bind decodes the body of r into v, which must be a pointer to a struct. A
+// JSON body is decoded with encoding/json. A URL-encoded or multipart form is
+// decoded into the fields with a matching "form" tag, or json tag if there's
+// no form tag; fields can be strings, bools, numbers, or slices of them.
+//
+// Malformed bodies return a *bindError. Bodies over the limit set by
+// withBodyLimit return an error for which isBodyTooLarge is true. Handle
+// both with bindFailed:
+//
+//	var signup struct {
+//		Email string `form:"email" json:"email"`
+//	}
+//	if err := bind(r, &signup); err != nil {
+//		bindFailed(w, r, err)
+//		return
+//	}
+func bind(r *http.Request, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(v); err != nil {
+			if isBodyTooLarge(err) {
+				return err
+			}
+			return newBindError("invalid JSON: %v", err)
+		}
+		return nil
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		// withCSRF may have parsed the form already; if so this does nothing.
+		if err := parseForm(r); err != nil {
+			if isBodyTooLarge(err) {
+				return err
+			}
+			return newBindError("invalid form: %v", err)
+		}
+		return bindForm(r.PostForm, v)
+	case "":
+		return newBindError("missing Content-Type")
+	default:
+		return newBindError("unsupported Content-Type %q", mediaType)
+	}
+}
+
+// bindForm sets the fields of the struct v points to from form.
+func bindForm(form map[string][]string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		panic("bind: v must be a pointer to a struct, got " + rv.Type().String())
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		name := formName(field)
+		if name == "" {
+			continue
+		}
+		values, ok := form[name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+			for j, s := range values {
+				if err := setFormValue(slice.Index(j), s); err != nil {
+					return newBindError("%s: %v", name, err)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+		if err := setFormValue(fv, values[0]); err != nil {
+			return newBindError("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// formName returns the form field name for field, or the empty string if it
+// shouldn't be set from a form.
+func formName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		// Unexported.
+		return ""
+	}
+	tag, ok := field.Tag.Lookup("form")
+	if !ok {
+		tag, ok = field.Tag.Lookup("json")
+	}
+	if !ok {
+		return field.Name
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func setFormValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		// Checkboxes send "on" when they're checked.
+		if s == "on" {
+			v.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a non-negative integer", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("can't decode a form value into a %s", v.Type())
+	}
+	return nil
+}
+
+// bindFailed responds to an error from bind: a 413 if the body was too
+// large, or a 400 Bad Request describing the problem.
+func bindFailed(w http.ResponseWriter, r *http.Request, err error) {
+	if isBodyTooLarge(err) {
+		bodyTooLarge(w, r)
+		return
+	}
+	var be *bindError
+	if errors.As(err, &be) {
+		writeError(w, http.StatusBadRequest, be.msg)
+		return
+	}
+	LoggerFrom(r.Context()).Error("Could not read request body", "err", err)
+	writeError(w, http.StatusBadRequest, "Could not read request body")
+}
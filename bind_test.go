@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type signup struct {
+	Email    string   `json:"email"`
+	Age      int      `json:"age"`
+	Score    float64  `form:"score" json:"score"`
+	Agree    bool     `json:"agree"`
+	Tags     []string `json:"tags"`
+	Internal string   `json:"-"`
+}
+
+var wantSignup = signup{Email: "gopher@example.com", Age: 12, Score: 9.5, Agree: true, Tags: []string{"go", "web"}}
+
+func TestBindJSON(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"email":"gopher@example.com","age":12,"score":9.5,"agree":true,"tags":["go","web"]}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	var got signup
+	if err := bind(req, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wantSignup) {
+		t.Errorf("got %+v, want %+v", got, wantSignup)
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	form := url.Values{
+		"email":    {"gopher@example.com"},
+		"age":      {"12"},
+		"score":    {"9.5"},
+		"agree":    {"on"},
+		"tags":     {"go", "web"},
+		"Internal": {"ignored"},
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var got signup
+	if err := bind(req, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wantSignup) {
+		t.Errorf("got %+v, want %+v", got, wantSignup)
+	}
+}
+
+func TestBindMultipartForm(t *testing.T) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	mw.WriteField("email", "gopher@example.com")
+	mw.WriteField("age", "12")
+	mw.Close()
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	var got signup
+	if err := bind(req, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "gopher@example.com" || got.Age != 12 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"malformed json", "application/json", `{"email":`, "invalid JSON"},
+		{"unknown json field", "application/json", `{"name":"gopher"}`, "invalid JSON"},
+		{"bad integer", "application/x-www-form-urlencoded", "age=twelve", `age: "twelve" is not an integer`},
+		{"no content type", "", "email=gopher", "missing Content-Type"},
+		{"unsupported content type", "text/plain", "hello", "unsupported Content-Type"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		var got signup
+		err := bind(req, &got)
+		if err == nil {
+			t.Errorf("%s: expected an error, got nil", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %q, want it to contain %q", tt.name, err, tt.want)
+		}
+		w := httptest.NewRecorder()
+		bindFailed(w, req, err)
+		if w.Code != 400 {
+			t.Errorf("%s: got code %d, want 400", tt.name, w.Code)
+		}
+	}
+}
+
+func TestBindBodyLimit(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.MaxBodyBytes = 10
+	setLive(c, NewRandomKey())
+	for _, contentType := range []string{"application/json", "application/x-www-form-urlencoded"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"email":"gopher@example.com"}`))
+		req.Header.Set("Content-Type", contentType)
+		// Chunked, so withBodyLimit can't reject it up front.
+		req.ContentLength = -1
+		w := httptest.NewRecorder()
+		withBodyLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var s signup
+			if err := bind(r, &s); err != nil {
+				bindFailed(w, r, err)
+			}
+		})).ServeHTTP(w, req)
+		if w.Code != 413 {
+			t.Errorf("%s: got code %d, want 413", contentType, w.Code)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+// Limits on the size of request bodies.
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kevinburke/rest"
+)
+
+// DefaultMaxBodyBytes is the largest request body the server accepts, if no
+// MaxBodyBytes is configured.
+const DefaultMaxBodyBytes = 1 << 20
+
+// bodyLimit returns the largest request body c allows for path: the limit
+// for the longest prefix in BodyLimits that path is at or below, or
+// MaxBodyBytes.
+func bodyLimit(c *FileConfig, path string) int64 {
+	if c == nil {
+		return DefaultMaxBodyBytes
+	}
+	limit, matched := c.MaxBodyBytes, ""
+	for prefix, n := range c.BodyLimits {
+		if hasPathPrefix(path, prefix) && len(prefix) > len(matched) {
+			limit, matched = n, prefix
+		}
+	}
+	if limit <= 0 {
+		return DefaultMaxBodyBytes
+	}
+	return limit
+}
+
+// withBodyLimit responds with a 413 to requests whose Content-Length is over
+// the limit for their path in the current config, and stops handlers from
+// reading more than the limit from other request bodies. Reading past the
+// limit returns an *http.MaxBytesError; respond to it with bodyTooLarge.
+func withBodyLimit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := bodyLimit(currentConfig(), r.URL.Path)
+		if r.ContentLength > n {
+			bodyTooLarge(w, r)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isBodyTooLarge reports whether err came from reading past the request body
+// limit.
+func isBodyTooLarge(err error) bool {
+	var mbe *http.MaxBytesError
+	return errors.As(err, &mbe)
+}
+
+// bodyTooLarge responds with a 413 Request Entity Too Large error.
+func bodyTooLarge(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusRequestEntityTooLarge, &rest.Error{
+		Title:    "Request body too large",
+		ID:       "request_too_large",
+		Instance: r.URL.Path,
+		Status:   http.StatusRequestEntityTooLarge,
+	})
+}
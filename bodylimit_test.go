@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.MaxBodyBytes = 10
+	c.BodyLimits = map[string]int64{"/upload": 100, "/upload/small": 5}
+	setLive(c, NewRandomKey())
+	h := withBodyLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			if isBodyTooLarge(err) {
+				bodyTooLarge(w, r)
+				return
+			}
+			t.Fatal(err)
+		}
+	}))
+	tests := []struct {
+		path string
+		size int
+		code int
+	}{
+		{"/", 10, 200},
+		{"/", 11, 413},
+		{"/upload", 100, 200},
+		{"/upload/file", 101, 413},
+		{"/upload/small", 6, 413},
+		{"/uploads", 11, 413},
+	}
+	for _, tt := range tests {
+		body := strings.Repeat("x", tt.size)
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("POST %s with %d bytes: got code %d, want %d", tt.path, tt.size, w.Code, tt.code)
+		}
+
+		// Without a Content-Length, the limit applies while reading.
+		req = httptest.NewRequest("POST", tt.path, io.MultiReader(strings.NewReader(body)))
+		req.ContentLength = -1
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("POST %s with %d bytes, chunked: got code %d, want %d", tt.path, tt.size, w.Code, tt.code)
+		}
+	}
+}
+
+func TestBodyLimitCSRFForm(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.MaxBodyBytes = 10
+	setLive(c, NewRandomKey())
+	h := withBodyLimit(withSession(withCSRF(http.NotFoundHandler()), nil))
+	req := httptest.NewRequest("POST", "/", strings.NewReader(CSRFFormField+"="+strings.Repeat("x", 20)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 413 {
+		t.Errorf("got code %d, want 413", w.Code)
+	}
+}
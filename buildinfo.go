@@ -0,0 +1,60 @@
+package main
+
+// Information about the running build.
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set these when building, for example with "make build":
+//
+//	go build -ldflags="-X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// -X main.version overrides Version. If commit isn't set, it comes from the
+// version control information Go records in the binary, if there is any.
+var (
+	version   = Version
+	commit    = ""
+	buildDate = ""
+)
+
+// BuildInfo describes the running build.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+func (b BuildInfo) String() string {
+	s := "go-html-boilerplate " + b.Version
+	if b.Commit != "" {
+		s += " commit " + b.Commit
+	}
+	if b.BuildDate != "" {
+		s += " built " + b.BuildDate
+	}
+	return s + " " + b.GoVersion
+}
+
+// getBuildInfo returns the values set with -ldflags, falling back to the
+// version control information in the binary for the commit.
+func getBuildInfo() BuildInfo {
+	b := BuildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok && b.Commit == "" {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				b.Commit = s.Value
+			}
+		}
+	}
+	return b
+}
+
+// versionHandler responds with the BuildInfo as JSON.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, getBuildInfo())
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	defer func(v, c, d string) { version, commit, buildDate = v, c, d }(version, commit, buildDate)
+	version, commit, buildDate = "1.2.3", "0123456789abcdef", "2026-10-15T12:00:00Z"
+
+	mux := NewServeMux(testConfig())
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+	if w.Code != 200 {
+		t.Fatalf("got code %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("got Content-Type %q, want JSON", ct)
+	}
+	var got BuildInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := BuildInfo{Version: "1.2.3", Commit: "0123456789abcdef", BuildDate: "2026-10-15T12:00:00Z", GoVersion: runtime.Version()}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if s := got.String(); s != "go-html-boilerplate 1.2.3 commit 0123456789abcdef built 2026-10-15T12:00:00Z "+runtime.Version() {
+		t.Errorf("String: got %q", s)
+	}
+}
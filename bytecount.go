@@ -0,0 +1,68 @@
+package main
+
+// Request and response sizes, for the access log.
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/kevinburke/handlers"
+)
+
+// withByteCounts adds the size of the request body and the response body, as
+// sent on the wire after compression, to the access log line as req_bytes and
+// resp_bytes. The request size is the Content-Length if there is one, and
+// otherwise the number of bytes the handler read.
+func withByteCounts(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		cw := &countingWriter{ResponseWriter: w}
+		h.ServeHTTP(cw, r)
+		reqBytes := body.n
+		if r.ContentLength > 0 {
+			reqBytes = r.ContentLength
+		}
+		handlers.AppendLog(r, "req_bytes", strconv.FormatInt(reqBytes, 10), "resp_bytes", strconv.FormatInt(cw.n, 10))
+	})
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written to a response body.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *countingWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/handlers"
+)
+
+func TestByteCountsHomepage(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	setLive(c, NewRandomKey())
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	buf := new(bytes.Buffer)
+	setLogFormat(handlers.Logger, "logfmt", buf)
+
+	mux := logRequests(withByteCounts(NewServeMux(c)))
+	for _, encoding := range []string{"", "gzip"} {
+		buf.Reset()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("%q: got code %d, want 200", encoding, w.Code)
+		}
+		want := fmt.Sprintf("req_bytes=0 resp_bytes=%d", w.Body.Len())
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%q: got log output %q, want it to contain %q", encoding, buf.String(), want)
+		}
+	}
+}
+
+func TestByteCountsRequestBody(t *testing.T) {
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	buf := new(bytes.Buffer)
+	setLogFormat(handlers.Logger, "logfmt", buf)
+
+	mux := logRequests(withByteCounts(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	})))
+	req := httptest.NewRequest("POST", "/", strings.NewReader("hello world"))
+	// Chunked, so the size has to be counted.
+	req.ContentLength = -1
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(buf.String(), "req_bytes=11 resp_bytes=0") {
+		t.Errorf("got log output %q, want req_bytes=11", buf.String())
+	}
+}
+
+func TestByteCountsKeepsInterfaces(t *testing.T) {
+	var w http.ResponseWriter = &countingWriter{ResponseWriter: &pushRecorder{ResponseRecorder: httptest.NewRecorder()}}
+	if _, ok := w.(http.Flusher); !ok {
+		t.Error("countingWriter should implement http.Flusher")
+	}
+	p, ok := w.(http.Pusher)
+	if !ok {
+		t.Fatal("countingWriter should implement http.Pusher")
+	}
+	if err := p.Push("/static/style.css", nil); err != nil {
+		t.Errorf("Push: %v", err)
+	}
+	w.(http.Flusher).Flush()
+	if !w.(*countingWriter).ResponseWriter.(*pushRecorder).Flushed {
+		t.Error("Flush wasn't passed through")
+	}
+}
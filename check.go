@@ -0,0 +1,78 @@
+package main
+
+// Checking a config file without starting the server.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// checkConfig loads the config file at filename and returns every problem
+// that would stop the server from starting with it: everything Validate
+// reports, a secret key file that doesn't hold a valid key, certificates that
+// can't be loaded, and templates that don't parse. It doesn't listen on any
+// ports or write any files. If dev is true, the templates in dev_dir are
+// checked, as for the -dev flag.
+func checkConfig(filename string, dev bool) []error {
+	c, err := loadConfig(filename)
+	if err != nil {
+		return []error{err}
+	}
+	if dev {
+		c.Dev = true
+	}
+	if err := c.setDefaults(); err != nil {
+		return []error{err}
+	}
+	var errs []error
+	validateErr := c.Validate()
+	if ve, ok := validateErr.(ValidationError); ok {
+		errs = append(errs, ve...)
+	} else if validateErr != nil {
+		errs = append(errs, validateErr)
+	}
+	if c.primarySecretKey() == "" {
+		keyFile := c.SecretKeyFile
+		if keyFile == "" {
+			keyFile = DefaultSecretKeyFile
+		}
+		// If there's no file, the server generates a key when it starts.
+		if data, err := ioutil.ReadFile(keyFile); err == nil {
+			if _, err := getSecretKey(strings.TrimSpace(string(data))); err != nil {
+				errs = append(errs, fmt.Errorf("secret_key_file: %s: %v", keyFile, err))
+			}
+		} else if !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("secret_key_file: %v", err))
+		}
+	}
+	// Validate already reported missing cert files and bad TLS settings.
+	if validateErr == nil && !c.HTTPOnly {
+		var certs certSource
+		if c.AutoTLS.Enabled() {
+			certs = newCertManager(c)
+		} else if store, err := newCertStore(c); err != nil {
+			errs = append(errs, fmt.Errorf("loading certificates: %v", err))
+		} else {
+			certs = store
+		}
+		if certs != nil {
+			if _, err := newTLSConfig(c, certs); err != nil {
+				errs = append(errs, fmt.Errorf("loading TLS config: %v", err))
+			}
+		}
+	}
+	var store assetStore = embedded{}
+	if c.Dev {
+		if validateErr != nil {
+			// dev_dir may not exist.
+			return errs
+		}
+		store = diskStore(c.DevDir)
+	}
+	if _, err := parseTemplates(store, newRouter().templateFuncs(), new(static).templateFuncs()); err != nil {
+		errs = append(errs, fmt.Errorf("templates: %v", err))
+	}
+	return errs
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	key := strings.Repeat("ab", 32)
+
+	if errs := checkConfig(write("good.yml", "http_only: true\nsecret_key: "+key+"\n"), false); len(errs) != 0 {
+		t.Errorf("good config: got %v", errs)
+	}
+	if errs := checkConfig(write("devcert.yml", "dev_cert: true\nsecret_key: "+key+"\ncert_file: "+filepath.Join(dir, "cert.pem")+"\nkey_file: "+filepath.Join(dir, "key.pem")+"\n"), false); len(errs) != 0 {
+		t.Errorf("dev cert: got %v", errs)
+	}
+
+	badKeyFile := write("secret.key", "not a key\n")
+	errs := checkConfig(write("badkey.yml", "http_only: true\nsecret_key_file: "+badKeyFile+"\n"), false)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "secret_key_file") {
+		t.Errorf("bad secret key file: got %v", errs)
+	}
+
+	write("bad.pem", "not a certificate")
+	errs = checkConfig(write("badcert.yml", "secret_key: "+key+"\ncert_file: "+filepath.Join(dir, "bad.pem")+"\nkey_file: "+filepath.Join(dir, "bad.pem")+"\n"), false)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "loading certificates") {
+		t.Errorf("bad certificate: got %v", errs)
+	}
+
+	templateDir := filepath.Join(dir, "assets", "templates")
+	if err := os.MkdirAll(templateDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "assets", "static"), 0755)
+	write("assets/templates/base.html", "")
+	write("assets/templates/index.html", "{{ if }}")
+	errs = checkConfig(write("badtemplate.yml", "http_only: true\nsecret_key: "+key+"\ndev_dir: "+filepath.Join(dir, "assets")+"\n"), true)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "index.html") {
+		t.Errorf("bad template: got %v", errs)
+	}
+
+	if errs := checkConfig(filepath.Join(dir, "missing.yml"), false); len(errs) != 1 {
+		t.Errorf("missing file: got %v", errs)
+	}
+}
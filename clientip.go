@@ -0,0 +1,71 @@
+package main
+
+// The IP address of the client, for requests that come through a proxy.
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/kevinburke/handlers"
+)
+
+// withClientIP stores the client's IP address, as found by clientIP with the
+// trusted_proxies in the current config, in the request context, so handlers
+// can retrieve it with ClientIP. The address is also added to the access log
+// line as client_ip.
+func withClientIP(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var trusted []*net.IPNet
+		if c := currentConfig(); c != nil {
+			// Validate checked the networks when the config was loaded.
+			trusted, _ = parseNetworks(c.TrustedProxies)
+		}
+		ip := clientIP(r, trusted)
+		handlers.AppendLog(r, "client_ip", ip)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, ip)))
+	})
+}
+
+// ClientIP returns the IP address of the client that made the request with
+// ctx, or the empty string if the request didn't go through withClientIP.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
+
+// clientIP returns the IP address of the client that made r. If the
+// connection comes from a proxy in trusted, the client is the last address in
+// X-Forwarded-For that isn't a trusted proxy, or the X-Real-IP header if
+// there's no X-Forwarded-For. Addresses in the headers that came from other
+// clients can be forged, so they're ignored.
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !allowedAddr(host, trusted) {
+		return host
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	if len(hops) == 0 {
+		if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+			return real
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		host = hop
+		if !allowedAddr(hop, trusted) {
+			break
+		}
+	}
+	return host
+}
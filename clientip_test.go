@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/handlers"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseNetworks([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		realIP string
+		want   string
+	}{
+		{"direct", "203.0.113.5:1234", "", "", "203.0.113.5"},
+		{"untrusted proxy", "203.0.113.5:1234", "198.51.100.1", "", "203.0.113.5"},
+		{"untrusted real ip", "203.0.113.5:1234", "", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"multiple hops", "10.0.0.1:1234", "198.51.100.1, 10.0.0.3, 10.0.0.2", "", "198.51.100.1"},
+		{"forged hop", "10.0.0.1:1234", "192.0.2.1, 198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"trusted real ip", "10.0.0.1:1234", "", "198.51.100.1", "198.51.100.1"},
+		{"xff before real ip", "10.0.0.1:1234", "198.51.100.1", "192.0.2.1", "198.51.100.1"},
+		{"no header", "10.0.0.1:1234", "", "", "10.0.0.1"},
+		{"garbage", "10.0.0.1:1234", "unknown", "", "10.0.0.1"},
+		{"garbage real ip", "10.0.0.1:1234", "", "unknown", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := clientIP(req, trusted); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithClientIP(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.TrustedProxies = []string{"10.0.0.0/8"}
+	setLive(c, NewRandomKey())
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	buf := new(bytes.Buffer)
+	setLogFormat(handlers.Logger, "logfmt", buf)
+
+	var got string
+	mux := logRequests(withClientIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientIP(r.Context())
+	})))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "198.51.100.1" {
+		t.Errorf("trusted proxy: got client IP %q, want 198.51.100.1", got)
+	}
+	if !strings.Contains(buf.String(), "client_ip=198.51.100.1") {
+		t.Errorf("got log output %q, want the client IP", buf.String())
+	}
+
+	req.RemoteAddr = "203.0.113.5:1234"
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "203.0.113.5" {
+		t.Errorf("untrusted source: got client IP %q, want 203.0.113.5", got)
+	}
+}
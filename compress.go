@@ -0,0 +1,180 @@
+package main
+
+// Gzip compression for rendered pages and other dynamic responses.
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipMinSize is the smallest response worth compressing. Smaller responses
+// fit in a single packet anyway, and gzip adds about 20 bytes.
+const gzipMinSize = 512
+
+// compressibleTypes are the content types withGzip compresses. Images, video
+// and archives are usually compressed already.
+var compressibleTypes = map[string]bool{
+	"text/html":                 true,
+	"text/css":                  true,
+	"text/plain":                true,
+	"text/javascript":           true,
+	"text/xml":                  true,
+	"application/javascript":    true,
+	"application/json":          true,
+	"application/manifest+json": true,
+	"application/xml":           true,
+	"image/svg+xml":             true,
+}
+
+func compressible(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return compressibleTypes[strings.ToLower(mediaType)]
+}
+
+// withGzip compresses responses from h with gzip, for clients that accept it,
+// if the response is a compressible type and at least gzipMinSize bytes.
+// Responses that already have a Content-Encoding, like precompressed static
+// files, and partial responses to range requests are left alone.
+func withGzip(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gw := &gzipWriter{
+			ResponseWriter: w,
+			accepts:        acceptsEncoding(r.Header.Get("Accept-Encoding"), "gzip"),
+		}
+		h.ServeHTTP(gw, r)
+		// Not deferred: if h panics, nothing buffered should be written
+		// before withRecover writes the error page.
+		gw.close()
+	})
+}
+
+// gzipWriter buffers the start of a response until it knows whether it's big
+// enough to compress.
+type gzipWriter struct {
+	http.ResponseWriter
+	accepts bool
+
+	code    int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if w.code == 0 {
+			w.code = http.StatusOK
+		}
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < gzipMinSize {
+			return len(p), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide writes the header, compressed or not, and the buffered body.
+func (w *gzipWriter) decide() error {
+	w.decided = true
+	hdr := w.Header()
+	if hdr.Get("Content-Type") == "" && len(w.buf) > 0 {
+		hdr.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if hdr.Get("Content-Encoding") == "" && hdr.Get("Content-Range") == "" && compressible(hdr.Get("Content-Type")) {
+		addVary(hdr, "Accept-Encoding")
+		if w.accepts && len(w.buf) >= gzipMinSize && w.code != http.StatusNoContent && w.code != http.StatusNotModified {
+			hdr.Set("Content-Encoding", "gzip")
+			hdr.Del("Content-Length")
+			weakenETag(hdr)
+			// Ranges would be offsets into the compressed response, which
+			// changes from one request to the next.
+			hdr.Del("Accept-Ranges")
+			w.gz = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// weakenETag marks a strong ETag in hdr as weak. A response compressed on
+// the fly isn't byte-for-byte the one the ETag was computed for, and strong
+// ETags have to differ between encodings.
+func weakenETag(hdr http.Header) {
+	if etag := hdr.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		hdr.Set("ETag", "W/"+etag)
+	}
+}
+
+// close writes anything still buffered and finishes the gzip stream.
+func (w *gzipWriter) close() {
+	if !w.decided {
+		if w.code == 0 {
+			// Nothing was written.
+			return
+		}
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+func (w *gzipWriter) Flush() {
+	if !w.decided && w.code != 0 {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// addVary adds value to the Vary header, unless it's there already.
+func addVary(hdr http.Header, value string) {
+	for _, v := range hdr.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	hdr.Add("Vary", value)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipHomepage(t *testing.T) {
+	mux := NewServeMux(testConfig())
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("got Content-Encoding %q, want gzip", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("got Vary %q, want Accept-Encoding", got)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "Hello World") {
+		t.Errorf("expected the homepage, got %q", body)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("no Accept-Encoding: got Content-Encoding %q, want none", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("no Accept-Encoding: got Vary %q, want Accept-Encoding", got)
+	}
+	if !strings.Contains(w.Body.String(), "Hello World") {
+		t.Errorf("no Accept-Encoding: expected the homepage, got %q", w.Body.String())
+	}
+}
+
+func TestGzipSkips(t *testing.T) {
+	big := strings.Repeat("a", gzipMinSize)
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+	}{
+		{"small", "text/html", "", "hello"},
+		{"image", "image/png", "", big},
+		{"already compressed", "text/css", "br", big},
+	}
+	for _, tt := range tests {
+		h := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			if tt.encoding != "" {
+				w.Header().Set("Content-Encoding", tt.encoding)
+			}
+			w.Write([]byte(tt.body))
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s: got Content-Encoding %q, want %q", tt.name, got, tt.encoding)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: body was changed", tt.name)
+		}
+	}
+}
+
+func TestGzipWeakensETag(t *testing.T) {
+	big := strings.Repeat("a", gzipMinSize)
+	h := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(big))
+	}))
+	for _, tt := range []struct {
+		encoding string
+		want     string
+	}{
+		{"gzip", `W/"abc"`},
+		{"", `"abc"`},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", tt.encoding)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got := w.Header().Get("ETag"); got != tt.want {
+			t.Errorf("Accept-Encoding %q: got ETag %q, want %q", tt.encoding, got, tt.want)
+		}
+	}
+}
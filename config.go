@@ -0,0 +1,987 @@
+package main
+
+import (
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FileConfig represents the data in a config file.
+//
+// Scalar and list fields can also be set with an environment variable, named
+// by upper-casing the field's YAML key and adding EnvPrefix - for example,
+// APP_SECRET_KEY, APP_SECRET_KEY_FILE, APP_PORT, APP_HTTP_ONLY, APP_CERT_FILE
+// and APP_KEY_FILE. Lists are comma-separated. Structs and maps can only be set
+// in the config file. Environment variables take precedence over values in the
+// config file.
+type FileConfig struct {
+	// SecretKey is used to encrypt sessions and other data before serving it to
+	// the client. It should be a hex string that's exactly 64 bytes long. For
+	// example:
+	//
+	//   d7211b215341871968869dontusethisc0ff1789fc88e0ac6e296ba36703edf8
+	//
+	// That key is invalid - you can generate a random key by running:
+	//
+	//   openssl rand -hex 32
+	//
+	// If no secret key is present, we'll generate one when the server starts
+	// and save it to SecretKeyFile, so sessions keep working when the server
+	// restarts. If SecretKeyFile can't be written, sessions may error when the
+	// server restarts.
+	//
+	// If a server key is present, but invalid, the server will not start.
+	SecretKey string `yaml:"secret_key" json:"secret_key" toml:"secret_key"`
+
+	// SecretKeys can be set instead of SecretKey to rotate the secret key. The
+	// first key encrypts new sessions and cookies. The rest are only used to
+	// decrypt data that was encrypted before the rotation. To rotate, add a
+	// new key to the front of the list, and remove the old key once cookies
+	// encrypted with it have expired.
+	SecretKeys []string `yaml:"secret_keys" json:"secret_keys" toml:"secret_keys"`
+
+	// SecretKeyFile is where a generated secret key is saved and loaded from
+	// when SecretKey is empty. Defaults to ".secret_key" in the working
+	// directory.
+	SecretKeyFile string `yaml:"secret_key_file" json:"secret_key_file" toml:"secret_key_file"`
+
+	// Port to listen on. Set to 0 to choose a port at random. If unspecified,
+	// defaults to 7065.
+	Port *int `yaml:"port" json:"port" toml:"port"`
+
+	// PortFile is a file to write the port the server is listening on to,
+	// once it's listening. This is useful with port 0, so scripts and tests
+	// can find the server. The file is removed when the server shuts down.
+	PortFile string `yaml:"port_file" json:"port_file" toml:"port_file"`
+
+	// BindAddress is the IP address of the interface to listen on, for example
+	// "127.0.0.1" to only accept connections from the local machine. If
+	// unspecified, the server listens on all interfaces.
+	BindAddress string `yaml:"bind_address" json:"bind_address" toml:"bind_address"`
+
+	// UnixSocket is the path of a Unix domain socket to listen on, instead of
+	// a TCP port. Any file at that path when the server starts is removed, and
+	// the socket is removed when the server shuts down.
+	UnixSocket string `yaml:"unix_socket" json:"unix_socket" toml:"unix_socket"`
+
+	// Set to true to listen for HTTP traffic (instead of TLS traffic). Note
+	// you need to terminate TLS to use HTTP server push.
+	HTTPOnly bool `yaml:"http_only" json:"http_only" toml:"http_only"`
+
+	// Set to true to start a second server on HTTPPort that redirects all
+	// traffic to the HTTPS server. HTTPPort defaults to 80.
+	RedirectHTTP bool `yaml:"redirect_http" json:"redirect_http" toml:"redirect_http"`
+	HTTPPort     int  `yaml:"http_port" json:"http_port" toml:"http_port"`
+
+	// For TLS configuration.
+	CertFile string `yaml:"cert_file" json:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file" toml:"key_file"`
+
+	// Certificates lists extra cert and key files, for serving several
+	// hostnames from one server. The certificate is chosen by matching the
+	// hostname the client asks for (SNI) against each certificate. If
+	// Certificates is set, CertFile and KeyFile are optional.
+	Certificates []CertKeyPair `yaml:"certificates" json:"certificates" toml:"certificates"`
+
+	// MinTLSVersion is the oldest TLS version the server accepts, either "1.2"
+	// or "1.3". Defaults to "1.2".
+	MinTLSVersion string `yaml:"min_tls_version" json:"min_tls_version" toml:"min_tls_version"`
+
+	// CipherSuites restricts the TLS 1.0-1.2 cipher suites the server will
+	// use, by IANA name, for example "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+	// If empty, Go's defaults are used. TLS 1.3 cipher suites can't be
+	// configured.
+	CipherSuites []string `yaml:"cipher_suites" json:"cipher_suites" toml:"cipher_suites"`
+
+	// ClientCAFile is a PEM file of certificate authorities that sign client
+	// certificates. If it's set, clients may present a certificate, and
+	// handlers can get the subject of a verified client certificate with
+	// ClientSubject. Set RequireClientCert to reject clients that don't
+	// present a valid certificate.
+	ClientCAFile      string `yaml:"client_ca_file" json:"client_ca_file" toml:"client_ca_file"`
+	RequireClientCert bool   `yaml:"require_client_cert" json:"require_client_cert" toml:"require_client_cert"`
+
+	// Set DevCert to true to generate a self-signed certificate for localhost
+	// when the server starts if CertFile or KeyFile doesn't exist. Browsers
+	// will warn about the certificate; don't use this in production.
+	DevCert bool `yaml:"dev_cert" json:"dev_cert" toml:"dev_cert"`
+
+	// AutoTLS gets certificates from Let's Encrypt instead of CertFile and
+	// KeyFile. When enabled, a HTTP server is started on HTTPPort to answer
+	// Let's Encrypt challenges and redirect other traffic to HTTPS.
+	AutoTLS AutoTLSConfig `yaml:"auto_tls" json:"auto_tls" toml:"auto_tls"`
+
+	// ReadTimeout is the maximum time to read an entire request, including
+	// the body, and WriteTimeout is the maximum time to write a response.
+	// Both are strings like "15s" or "1m". If unspecified, they default to
+	// DefaultReadTimeout and DefaultWriteTimeout.
+	ReadTimeout  Duration `yaml:"read_timeout" json:"read_timeout" toml:"read_timeout"`
+	WriteTimeout Duration `yaml:"write_timeout" json:"write_timeout" toml:"write_timeout"`
+
+	// IdleTimeout is the maximum time to keep an idle keep-alive connection
+	// open, and ReadHeaderTimeout is the maximum time to read the request
+	// headers. A short ReadHeaderTimeout protects against Slowloris attacks,
+	// where a client holds a connection open by sending headers very slowly.
+	// If unspecified, they default to DefaultIdleTimeout and
+	// DefaultReadHeaderTimeout.
+	IdleTimeout       Duration `yaml:"idle_timeout" json:"idle_timeout" toml:"idle_timeout"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" json:"read_header_timeout" toml:"read_header_timeout"`
+
+	// ShutdownTimeout is how long the server waits for requests in flight to
+	// finish after it receives SIGINT or SIGTERM. Connections still open after
+	// that are closed. If unspecified, defaults to DefaultShutdownTimeout.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" json:"shutdown_timeout" toml:"shutdown_timeout"`
+
+	// MaxHeaderBytes is the maximum size of the request headers, in bytes.
+	// Requests with larger headers get a 431 response. If unspecified,
+	// defaults to http.DefaultMaxHeaderBytes (1MB).
+	MaxHeaderBytes int `yaml:"max_header_bytes" json:"max_header_bytes" toml:"max_header_bytes"`
+
+	// StaticCacheMaxAge is how long browsers may cache static assets, like
+	// "1h". If unspecified, defaults to DefaultStaticCacheMaxAge.
+	// Fingerprinted assets are always cached for a year.
+	StaticCacheMaxAge Duration `yaml:"static_cache_max_age" json:"static_cache_max_age" toml:"static_cache_max_age"`
+
+	// StaticPrefix is the URL path the embedded static assets are served
+	// under, like "/assets/". If unspecified, defaults to DefaultStaticPrefix,
+	// "/static/". The asset template function returns paths under it.
+	StaticPrefix string `yaml:"static_prefix" json:"static_prefix" toml:"static_prefix"`
+
+	// StaticDirs are directories on disk to serve at other URL prefixes, like
+	// user uploads at /uploads/, each with its own cache max-age.
+	StaticDirs []StaticDir `yaml:"static_dirs" json:"static_dirs" toml:"static_dirs"`
+
+	// EnablePush controls whether the server uses HTTP/2 server push for
+	// resources like the stylesheet. Defaults to true. If it's false, or the
+	// client doesn't support push, pages send a preload Link header instead.
+	EnablePush *bool `yaml:"enable_push" json:"enable_push" toml:"enable_push"`
+
+	// Set Dev to true, or run the server with -dev, to read static files and
+	// templates from the "static" and "templates" folders in DevDir for every
+	// request, instead of the copies embedded in the binary. Changes to the
+	// files show up without rebuilding or restarting the server. DevDir
+	// defaults to the "assets" directory. Changing either setting requires a
+	// restart.
+	Dev    bool   `yaml:"dev" json:"dev" toml:"dev"`
+	DevDir string `yaml:"dev_dir" json:"dev_dir" toml:"dev_dir"`
+
+	// RobotsTxt is served as /robots.txt, for example DisallowAllRobots to
+	// keep crawlers away from a staging server:
+	//
+	//     robots_txt: "User-agent: *\nDisallow: /\n"
+	//
+	// If it's unspecified, the static/robots.txt asset is served, which lets
+	// crawlers index everything.
+	RobotsTxt string `yaml:"robots_txt" json:"robots_txt" toml:"robots_txt"`
+
+	// WebManifest is served as /manifest.webmanifest, the web app manifest
+	// that lets browsers install the site as an app. If it's unspecified,
+	// the static/manifest.webmanifest asset is served.
+	WebManifest string `yaml:"web_manifest" json:"web_manifest" toml:"web_manifest"`
+
+	// BaseURL is the scheme and host the site is served at, like
+	// "https://www.example.com", used for the links in /sitemap.xml. If it's
+	// unspecified, links use the scheme and Host of the request.
+	BaseURL string `yaml:"base_url" json:"base_url" toml:"base_url"`
+
+	// Flags are feature flags, keyed by name. Check them with FlagEnabled.
+	// They can be changed by reloading the config.
+	Flags map[string]FlagSpec `yaml:"flags" json:"flags" toml:"flags"`
+
+	// Set SPAFallback to true to serve a single-page app, which handles its
+	// own routes in the browser: GET requests that don't match a route get
+	// the app.html template, or the homepage if there's no app.html, instead
+	// of a 404. Paths that start with a prefix in SPAExclude, which defaults
+	// to DefaultSPAExclude, and paths with a file extension, like
+	// "/missing.js", still get a 404.
+	SPAFallback bool     `yaml:"spa_fallback" json:"spa_fallback" toml:"spa_fallback"`
+	SPAExclude  []string `yaml:"spa_exclude" json:"spa_exclude" toml:"spa_exclude"`
+
+	// Set MaintenanceMode to true to take the site offline without stopping
+	// the server: every request gets a 503 and the maintenance.html page,
+	// except health checks, static files, and paths in MaintenanceAllow and
+	// the paths below them. Reload the config with SIGHUP to turn it on or
+	// off. Clients are told to try again after MaintenanceRetryAfter, which
+	// defaults to DefaultMaintenanceRetryAfter, 5 minutes.
+	MaintenanceMode       bool     `yaml:"maintenance_mode" json:"maintenance_mode" toml:"maintenance_mode"`
+	MaintenanceAllow      []string `yaml:"maintenance_allow" json:"maintenance_allow" toml:"maintenance_allow"`
+	MaintenanceRetryAfter Duration `yaml:"maintenance_retry_after" json:"maintenance_retry_after" toml:"maintenance_retry_after"`
+
+	// Set MinifyHTML to true to remove comments and extra whitespace from
+	// rendered pages. It has no effect in dev mode, so the source stays
+	// readable.
+	MinifyHTML bool `yaml:"minify_html" json:"minify_html" toml:"minify_html"`
+
+	// SessionStore is where session values are kept. "cookie" (the default)
+	// stores them in an encrypted cookie, which browsers limit to about 4KB.
+	// "memory" and "redis" store them on the server, and the cookie only
+	// holds the session ID. Sessions in memory are lost when the server
+	// restarts.
+	SessionStore string `yaml:"session_store" json:"session_store" toml:"session_store"`
+	// RedisAddr is the host:port of the Redis server for the "redis" session
+	// store. Defaults to "localhost:6379".
+	RedisAddr string `yaml:"redis_addr" json:"redis_addr" toml:"redis_addr"`
+
+	// MetricsAllow lists the IP addresses and CIDR networks, like
+	// "10.0.0.0/8", that may read Prometheus metrics from /metrics. Other
+	// clients get a 404. Defaults to DefaultMetricsAllow, which only allows
+	// the local machine.
+	MetricsAllow []string `yaml:"metrics_allow" json:"metrics_allow" toml:"metrics_allow"`
+
+	// AdminUser and AdminPasswordHash are the basic auth credentials for
+	// internal tools. AdminPasswordHash is a bcrypt hash of the password;
+	// generate one with:
+	//
+	//     htpasswd -nbB "" password | tr -d ':\n'
+	//
+	// If they're set, /metrics and the pprof endpoints require them.
+	AdminUser         string `yaml:"admin_user" json:"admin_user" toml:"admin_user"`
+	AdminPasswordHash string `yaml:"admin_password_hash" json:"admin_password_hash" toml:"admin_password_hash"`
+
+	// Set Pprof to true to serve the net/http/pprof profiling endpoints under
+	// /debug/pprof/. They're not registered at all unless Pprof is set. If
+	// PprofPassword is set, the endpoints require basic auth with the
+	// username "pprof" and that password; set it unless the server is only
+	// reachable from a trusted network.
+	Pprof         bool   `yaml:"pprof" json:"pprof" toml:"pprof"`
+	PprofPassword string `yaml:"pprof_password" json:"pprof_password" toml:"pprof_password"`
+
+	// Set Expvar to true to serve runtime stats from the expvar package at
+	// /debug/vars, including counts of requests served and templates
+	// rendered, and the number of goroutines. Like /metrics, only clients in
+	// MetricsAllow can see them, and they require the admin credentials if
+	// AdminUser is set.
+	Expvar bool `yaml:"expvar" json:"expvar" toml:"expvar"`
+
+	// Set DebugConfig to true to serve the config the server is running
+	// with, as JSON, at /debug/config, to see which values came from the
+	// file, the environment and the defaults. Secrets are redacted. It's only
+	// served with the admin credentials, or without them in dev mode.
+	DebugConfig bool `yaml:"debug_config" json:"debug_config" toml:"debug_config"`
+
+	// Set WebSocketEcho to true to serve an example WebSocket endpoint at
+	// /ws/echo, which sends every message back to the client. See
+	// websocket.go.
+	WebSocketEcho bool `yaml:"websocket_echo" json:"websocket_echo" toml:"websocket_echo"`
+
+	// LogFormat is "logfmt" (the default) or "json". Set it to "json" to write
+	// every log line, including access logs, as a JSON object. Errors loading
+	// the config are always written as logfmt.
+	LogFormat string `yaml:"log_format" json:"log_format" toml:"log_format"`
+
+	// UnloggedPaths are paths left out of the access log, along with the
+	// paths below them; requests to them are only logged at debug level.
+	// Defaults to DefaultUnloggedPaths, the health checks and metrics. Set it
+	// to an empty list to log every request.
+	UnloggedPaths []string `yaml:"unlogged_paths" json:"unlogged_paths" toml:"unlogged_paths"`
+
+	// LogFile is a file to write logs to, including access logs, instead of
+	// stdout. It's rotated when it reaches LogMaxSize megabytes (default
+	// 100), keeping LogMaxBackups old files (default 5; set it to 0 to keep
+	// none). The server reopens it on SIGHUP, so tools like logrotate can
+	// rotate it instead.
+	LogFile       string `yaml:"log_file" json:"log_file" toml:"log_file"`
+	LogMaxSize    int    `yaml:"log_max_size" json:"log_max_size" toml:"log_max_size"`
+	LogMaxBackups *int   `yaml:"log_max_backups" json:"log_max_backups" toml:"log_max_backups"`
+
+	// RequestTimeout is how long a handler may take before the server gives
+	// up and responds with a 503, like "20s". RouteTimeouts overrides it for
+	// a path and the paths below it, like "/reports", for long-running
+	// endpoints; "0s" means no limit. Keep the timeouts under write_timeout,
+	// or the connection is closed before the 503 is sent. If RequestTimeout
+	// is unspecified, requests aren't limited.
+	RequestTimeout Duration            `yaml:"request_timeout" json:"request_timeout" toml:"request_timeout"`
+	RouteTimeouts  map[string]Duration `yaml:"route_timeouts" json:"route_timeouts" toml:"route_timeouts"`
+
+	// MaxBodyBytes is the largest request body, in bytes, the server accepts;
+	// larger requests get a 413. Defaults to DefaultMaxBodyBytes, 1MB.
+	// BodyLimits overrides it for a path and the paths below it, like
+	// "/upload", for example to allow larger uploads.
+	MaxBodyBytes int64            `yaml:"max_body_bytes" json:"max_body_bytes" toml:"max_body_bytes"`
+	BodyLimits   map[string]int64 `yaml:"body_limits" json:"body_limits" toml:"body_limits"`
+
+	// MaxUploadBytes is the largest file, in bytes, formFile accepts; larger
+	// files get a 413. Defaults to DefaultMaxUploadBytes, 1MB. UploadTypes
+	// are the content types it accepts, sniffed from the file; other files
+	// get a 415. Defaults to DefaultUploadTypes, PNG, JPEG, GIF and WebP
+	// images.
+	MaxUploadBytes int64    `yaml:"max_upload_bytes" json:"max_upload_bytes" toml:"max_upload_bytes"`
+	UploadTypes    []string `yaml:"upload_types" json:"upload_types" toml:"upload_types"`
+
+	// ContentSecurityPolicy is the Content-Security-Policy header sent with
+	// every response. Defaults to DefaultContentSecurityPolicy, which blocks
+	// inline scripts and resources from other sites.
+	ContentSecurityPolicy string `yaml:"content_security_policy" json:"content_security_policy" toml:"content_security_policy"`
+	// HSTSMaxAge is how long browsers should only connect to the site over
+	// HTTPS, like "720h". The Strict-Transport-Security header is only sent
+	// for requests over TLS. Defaults to DefaultHSTSMaxAge, a year.
+	HSTSMaxAge Duration `yaml:"hsts_max_age" json:"hsts_max_age" toml:"hsts_max_age"`
+
+	// CORS lets pages on other sites call the server from JavaScript. By
+	// default, browsers block those requests.
+	CORS CORSConfig `yaml:"cors" json:"cors" toml:"cors"`
+
+	// RateLimit is the number of requests per second each client IP may
+	// make, on average; requests over the limit get a 429. RateLimitBurst is
+	// how many requests a client may make at once, and defaults to RateLimit
+	// rounded up. If RateLimit is 0, requests aren't limited.
+	RateLimit      float64 `yaml:"rate_limit" json:"rate_limit" toml:"rate_limit"`
+	RateLimitBurst int     `yaml:"rate_limit_burst" json:"rate_limit_burst" toml:"rate_limit_burst"`
+
+	// TrustedProxies lists the IP addresses and CIDR networks of proxies in
+	// front of the server. For requests from these addresses, the client IP
+	// is read from the X-Forwarded-For header, or X-Real-IP if there's no
+	// X-Forwarded-For. Don't list addresses that clients can connect from
+	// directly, or they can claim to be anyone.
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies" toml:"trusted_proxies"`
+
+	// Add other configuration settings here.
+}
+
+// getPort returns the port to listen on. A port in the config file takes
+// precedence over the PORT environment variable, which takes precedence over
+// DefaultPort. getPort never dereferences a nil c.Port.
+func getPort(c *FileConfig) (int, error) {
+	if c.Port != nil {
+		return *c.Port, nil
+	}
+	if port, ok := os.LookupEnv("PORT"); ok {
+		return strconv.Atoi(port)
+	}
+	return DefaultPort, nil
+}
+
+// Duration is a time.Duration that is written in config files as a string like
+// "15s" or "2m30s".
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses text with time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	dur, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = dur
+	return nil
+}
+
+// MarshalText formats d as a duration string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// UnmarshalYAML parses a YAML string with time.ParseDuration.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+// parseConfig unmarshals data into c. The format is chosen by the extension of
+// filename: ".json" files are parsed as JSON, ".toml" files as TOML, and ".yml"
+// and ".yaml" files (or files with no extension) as YAML.
+func parseConfig(filename string, data []byte, c *FileConfig) error {
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".json":
+		return json.Unmarshal(data, c)
+	case ".toml":
+		return toml.Unmarshal(data, c)
+	case ".yml", ".yaml", "":
+		return yaml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unknown config file extension %q", ext)
+	}
+}
+
+// setupConfig applies defaults to c, validates it and returns the secret key
+// to use with it.
+func setupConfig(c *FileConfig) (*[32]byte, error) {
+	if err := c.setDefaults(); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return loadSecretKey(c.primarySecretKey(), c.SecretKeyFile)
+}
+
+// String returns c as JSON with the secret key, passwords and certificate
+// files redacted, so a config can be logged or printed without leaking them.
+func (c FileConfig) String() string {
+	v, err := redactedConfig(&c)
+	if err != nil {
+		return "FileConfig{" + err.Error() + "}"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "FileConfig{" + err.Error() + "}"
+	}
+	return string(b)
+}
+
+// GoString is the same as String, so %#v doesn't leak secrets either.
+func (c FileConfig) GoString() string {
+	return c.String()
+}
+
+// pushEnabled reports whether c allows HTTP/2 server push.
+func (c *FileConfig) pushEnabled() bool {
+	return c.EnablePush == nil || *c.EnablePush
+}
+
+// staticPrefix returns the URL path the static assets are served under, with
+// a trailing slash.
+func (c *FileConfig) staticPrefix() string {
+	if c.StaticPrefix == "" {
+		return DefaultStaticPrefix
+	}
+	return strings.TrimSuffix(c.StaticPrefix, "/") + "/"
+}
+
+// primarySecretKey returns the hex key used to encrypt new data.
+func (c *FileConfig) primarySecretKey() string {
+	if len(c.SecretKeys) > 0 {
+		return c.SecretKeys[0]
+	}
+	return c.SecretKey
+}
+
+// fallbackKeys returns the keys in c that are only used for decryption. Call
+// Validate first; invalid keys are skipped.
+func (c *FileConfig) fallbackKeys() []*[32]byte {
+	if len(c.SecretKeys) < 2 {
+		return nil
+	}
+	keys := make([]*[32]byte, 0, len(c.SecretKeys)-1)
+	for _, hexKey := range c.SecretKeys[1:] {
+		if key, err := getSecretKey(hexKey); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// setDefaults fills in default values for any settings that weren't
+// configured.
+func (c *FileConfig) setDefaults() error {
+	port, err := getPort(c)
+	if err != nil {
+		return fmt.Errorf("invalid PORT %q: %v", os.Getenv("PORT"), err)
+	}
+	c.Port = &port
+	if len(c.Certificates) == 0 {
+		if c.CertFile == "" {
+			c.CertFile = "cert.pem"
+		}
+		if c.KeyFile == "" {
+			c.KeyFile = "key.pem"
+		}
+	}
+	if (c.RedirectHTTP || c.AutoTLS.Enabled()) && c.HTTPPort == 0 {
+		c.HTTPPort = 80
+	}
+	if c.MinTLSVersion == "" {
+		c.MinTLSVersion = "1.2"
+	}
+	if c.AutoTLS.Enabled() && c.AutoTLS.CacheDir == "" {
+		c.AutoTLS.CacheDir = DefaultAutoTLSCacheDir
+	}
+	if c.ReadTimeout.Duration == 0 {
+		c.ReadTimeout.Duration = DefaultReadTimeout
+	}
+	if c.WriteTimeout.Duration == 0 {
+		c.WriteTimeout.Duration = DefaultWriteTimeout
+	}
+	if c.IdleTimeout.Duration == 0 {
+		c.IdleTimeout.Duration = DefaultIdleTimeout
+	}
+	if c.ReadHeaderTimeout.Duration == 0 {
+		c.ReadHeaderTimeout.Duration = DefaultReadHeaderTimeout
+	}
+	if c.ShutdownTimeout.Duration == 0 {
+		c.ShutdownTimeout.Duration = DefaultShutdownTimeout
+	}
+	if c.StaticCacheMaxAge.Duration == 0 {
+		c.StaticCacheMaxAge.Duration = DefaultStaticCacheMaxAge
+	}
+	if c.Dev && c.DevDir == "" {
+		c.DevDir = DefaultDevDir
+	}
+	if c.SessionStore == "" {
+		c.SessionStore = "cookie"
+	}
+	if c.SessionStore == "redis" && c.RedisAddr == "" {
+		c.RedisAddr = DefaultRedisAddr
+	}
+	if len(c.MetricsAllow) == 0 {
+		c.MetricsAllow = DefaultMetricsAllow
+	}
+	if c.MaintenanceRetryAfter.Duration == 0 {
+		c.MaintenanceRetryAfter.Duration = DefaultMaintenanceRetryAfter
+	}
+	if c.UnloggedPaths == nil {
+		c.UnloggedPaths = DefaultUnloggedPaths
+	}
+	if c.SPAExclude == nil {
+		c.SPAExclude = DefaultSPAExclude
+	}
+	if c.LogMaxSize == 0 {
+		c.LogMaxSize = DefaultLogMaxSize
+	}
+	if c.LogMaxBackups == nil {
+		backups := DefaultLogMaxBackups
+		c.LogMaxBackups = &backups
+	}
+	if c.MaxBodyBytes == 0 {
+		c.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if c.MaxUploadBytes == 0 {
+		c.MaxUploadBytes = DefaultMaxUploadBytes
+	}
+	if len(c.UploadTypes) == 0 {
+		c.UploadTypes = DefaultUploadTypes
+	}
+	if c.ContentSecurityPolicy == "" {
+		c.ContentSecurityPolicy = DefaultContentSecurityPolicy
+	}
+	if c.HSTSMaxAge.Duration == 0 {
+		c.HSTSMaxAge.Duration = DefaultHSTSMaxAge
+	}
+	return nil
+}
+
+// DefaultDevDir contains the static files and templates that are read in dev
+// mode, if no DevDir is configured.
+const DefaultDevDir = "assets"
+
+// EnvPrefix is prepended to the upper-cased YAML key of a FileConfig field to
+// get the name of the environment variable that overrides it.
+const EnvPrefix = "APP_"
+
+// loadConfig reads the config file at filename and applies any overrides from
+// the environment. A missing config file is not an error if at least one
+// config value is set in the environment.
+func loadConfig(filename string) (*FileConfig, error) {
+	c := new(FileConfig)
+	data, readErr := ioutil.ReadFile(filename)
+	if readErr == nil {
+		if err := parseConfig(filename, data, c); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(readErr) {
+		return nil, readErr
+	}
+	found, err := applyEnv(c)
+	if err != nil {
+		return nil, err
+	}
+	if readErr != nil && !found {
+		return nil, readErr
+	}
+	return c, nil
+}
+
+// applyEnv overwrites fields in c with the values of the corresponding
+// environment variables, and reports whether any variables were set.
+func applyEnv(c *FileConfig) (bool, error) {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	found := false
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := EnvPrefix + strings.ToUpper(name)
+		val, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), val); err != nil {
+			return found, fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		found = true
+	}
+	return found, nil
+}
+
+// setField parses val into f, based on the type of f. Slices are parsed as a
+// comma-separated list.
+func setField(f reflect.Value, val string) error {
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(val))
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Ptr:
+		p := reflect.New(f.Type().Elem())
+		if err := setField(p.Elem(), val); err != nil {
+			return err
+		}
+		f.Set(p)
+	case reflect.Slice:
+		parts := strings.Split(val, ",")
+		s := reflect.MakeSlice(f.Type(), 0, len(parts))
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			elem := reflect.New(f.Type().Elem()).Elem()
+			if err := setField(elem, part); err != nil {
+				return err
+			}
+			s = reflect.Append(s, elem)
+		}
+		f.Set(s)
+	default:
+		return fmt.Errorf("cannot set a %s from the environment", f.Type())
+	}
+	return nil
+}
+
+// ValidationError holds every problem found by Validate.
+type ValidationError []error
+
+func (v ValidationError) Error() string {
+	msgs := make([]string, len(v))
+	for i, err := range v {
+		msgs[i] = err.Error()
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks c for problems, and returns a ValidationError listing all of
+// them, so they can be fixed in one pass. Validate should be called after
+// defaults have been applied.
+func (c *FileConfig) Validate() error {
+	var errs ValidationError
+	if c.SecretKey != "" {
+		if _, err := getSecretKey(c.SecretKey); err != nil {
+			errs = append(errs, fmt.Errorf("secret_key: %v", err))
+		}
+		if len(c.SecretKeys) > 0 {
+			errs = append(errs, errors.New("secret_key: can't be set with secret_keys"))
+		}
+	}
+	for i, hexKey := range c.SecretKeys {
+		if hexKey == "" {
+			errs = append(errs, fmt.Errorf("secret_keys: key %d is empty", i))
+		} else if _, err := getSecretKey(hexKey); err != nil {
+			errs = append(errs, fmt.Errorf("secret_keys: key %d: %v", i, err))
+		}
+	}
+	if c.Port != nil && (*c.Port < 0 || *c.Port > 65535) {
+		errs = append(errs, fmt.Errorf("port: %d is out of range (0-65535)", *c.Port))
+	}
+	if c.HTTPPort < 0 || c.HTTPPort > 65535 {
+		errs = append(errs, fmt.Errorf("http_port: %d is out of range (0-65535)", c.HTTPPort))
+	}
+	if c.RedirectHTTP && c.HTTPOnly {
+		errs = append(errs, errors.New("redirect_http: can't redirect to HTTPS when http_only is set"))
+	}
+	if c.BindAddress != "" && net.ParseIP(c.BindAddress) == nil {
+		errs = append(errs, fmt.Errorf("bind_address: %q is not a valid IP address", c.BindAddress))
+	}
+	if c.ReadTimeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("read_timeout: %v is negative", c.ReadTimeout))
+	}
+	if c.WriteTimeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("write_timeout: %v is negative", c.WriteTimeout))
+	}
+	if c.IdleTimeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("idle_timeout: %v is negative", c.IdleTimeout))
+	}
+	if c.ReadHeaderTimeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("read_header_timeout: %v is negative", c.ReadHeaderTimeout))
+	}
+	if c.ShutdownTimeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("shutdown_timeout: %v is negative", c.ShutdownTimeout))
+	}
+	if c.MaxHeaderBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_header_bytes: %d is negative", c.MaxHeaderBytes))
+	}
+	if c.RequestTimeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("request_timeout: %v is negative", c.RequestTimeout))
+	}
+	for prefix, d := range c.RouteTimeouts {
+		if !strings.HasPrefix(prefix, "/") {
+			errs = append(errs, fmt.Errorf("route_timeouts: %q is not a path", prefix))
+		}
+		if d.Duration < 0 {
+			errs = append(errs, fmt.Errorf("route_timeouts: timeout for %q is negative", prefix))
+		}
+	}
+	if c.MaxBodyBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_body_bytes: %d is negative", c.MaxBodyBytes))
+	}
+	if c.MaxUploadBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_upload_bytes: %d is negative", c.MaxUploadBytes))
+	}
+	for _, t := range c.UploadTypes {
+		if mediaType, _, err := mime.ParseMediaType(t); err != nil || mediaType != t || !strings.Contains(t, "/") {
+			errs = append(errs, fmt.Errorf("upload_types: %q is not a content type, like image/png", t))
+		}
+	}
+	for prefix, n := range c.BodyLimits {
+		if !strings.HasPrefix(prefix, "/") {
+			errs = append(errs, fmt.Errorf("body_limits: %q is not a path", prefix))
+		}
+		if n <= 0 {
+			errs = append(errs, fmt.Errorf("body_limits: limit for %q must be positive", prefix))
+		}
+	}
+	if c.HSTSMaxAge.Duration < 0 {
+		errs = append(errs, fmt.Errorf("hsts_max_age: %v is negative", c.HSTSMaxAge))
+	}
+	if c.StaticCacheMaxAge.Duration < 0 {
+		errs = append(errs, fmt.Errorf("static_cache_max_age: %v is negative", c.StaticCacheMaxAge))
+	}
+	if c.StaticPrefix != "" && (!strings.HasPrefix(c.StaticPrefix, "/") || c.staticPrefix() == "/") {
+		errs = append(errs, fmt.Errorf("static_prefix: %q is not a path like /assets/", c.StaticPrefix))
+	}
+	prefixes := make(map[string]bool)
+	for _, d := range c.StaticDirs {
+		if err := d.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("static_dirs: %v", err))
+		} else if prefixes[d.Prefix] {
+			errs = append(errs, fmt.Errorf("static_dirs: %s: prefix %q is used twice", d.Name, d.Prefix))
+		} else if sp := c.staticPrefix(); strings.HasPrefix(d.Prefix, sp) || strings.HasPrefix(sp, d.Prefix) {
+			errs = append(errs, fmt.Errorf("static_dirs: %s: prefix %q overlaps the static assets at %s", d.Name, d.Prefix, sp))
+		}
+		prefixes[d.Prefix] = true
+	}
+	if c.Dev {
+		for _, dir := range []string{"static", "templates"} {
+			if err := checkReadable(filepath.Join(c.DevDir, dir)); err != nil {
+				errs = append(errs, fmt.Errorf("dev_dir: %v", err))
+			}
+		}
+	}
+	if c.WebManifest != "" && !json.Valid([]byte(c.WebManifest)) {
+		errs = append(errs, errors.New("web_manifest: not valid JSON"))
+	}
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			errs = append(errs, fmt.Errorf("base_url: %q is not a URL like https://www.example.com", c.BaseURL))
+		}
+	}
+	if err := c.CORS.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("cors: %v", err))
+	}
+	for name, f := range c.Flags {
+		if name == "" {
+			errs = append(errs, errors.New("flags: a flag has no name"))
+		}
+		if f.Percent < 0 || f.Percent > 100 || math.IsNaN(f.Percent) {
+			errs = append(errs, fmt.Errorf("flags: %s: percent %v is not between 0 and 100", name, f.Percent))
+		}
+	}
+	for _, prefix := range c.SPAExclude {
+		if !strings.HasPrefix(prefix, "/") {
+			errs = append(errs, fmt.Errorf("spa_exclude: %q is not a path", prefix))
+		}
+	}
+	for _, prefix := range c.MaintenanceAllow {
+		if !strings.HasPrefix(prefix, "/") {
+			errs = append(errs, fmt.Errorf("maintenance_allow: %q is not a path", prefix))
+		}
+	}
+	if c.MaintenanceRetryAfter.Duration < 0 {
+		errs = append(errs, fmt.Errorf("maintenance_retry_after: %v is negative", c.MaintenanceRetryAfter.Duration))
+	}
+	for _, prefix := range c.UnloggedPaths {
+		if !strings.HasPrefix(prefix, "/") {
+			errs = append(errs, fmt.Errorf("unlogged_paths: %q is not a path", prefix))
+		}
+	}
+	if c.LogMaxSize < 0 {
+		errs = append(errs, fmt.Errorf("log_max_size: %d is negative", c.LogMaxSize))
+	}
+	if c.LogMaxBackups != nil && *c.LogMaxBackups < 0 {
+		errs = append(errs, fmt.Errorf("log_max_backups: %d is negative", *c.LogMaxBackups))
+	}
+	switch c.LogFormat {
+	case "", "logfmt", "json":
+	default:
+		errs = append(errs, fmt.Errorf("log_format: unknown format %q, want logfmt or json", c.LogFormat))
+	}
+	switch c.SessionStore {
+	case "", "cookie", "memory", "redis":
+	default:
+		errs = append(errs, fmt.Errorf("session_store: unknown store %q, want cookie, memory or redis", c.SessionStore))
+	}
+	if _, err := parseNetworks(c.MetricsAllow); err != nil {
+		errs = append(errs, fmt.Errorf("metrics_allow: %v", err))
+	}
+	if (c.AdminUser == "") != (c.AdminPasswordHash == "") {
+		errs = append(errs, errors.New("admin_user: admin_user and admin_password_hash must be set together"))
+	} else if c.AdminPasswordHash != "" {
+		if _, err := bcrypt.Cost([]byte(c.AdminPasswordHash)); err != nil {
+			errs = append(errs, fmt.Errorf("admin_password_hash: not a bcrypt hash: %v", err))
+		}
+	}
+	if c.AdminUser != "" && c.PprofPassword != "" {
+		errs = append(errs, errors.New("pprof_password: can't be set with admin_user; pprof uses the admin credentials"))
+	}
+	if c.RateLimit < 0 || math.IsNaN(c.RateLimit) || math.IsInf(c.RateLimit, 0) {
+		errs = append(errs, fmt.Errorf("rate_limit: %v is not a valid rate", c.RateLimit))
+	}
+	if c.RateLimitBurst < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit_burst: %d is negative", c.RateLimitBurst))
+	}
+	if _, err := parseNetworks(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("trusted_proxies: %v", err))
+	}
+	if c.MinTLSVersion != "" {
+		if _, err := parseTLSVersion(c.MinTLSVersion); err != nil {
+			errs = append(errs, fmt.Errorf("min_tls_version: %v", err))
+		}
+	}
+	if _, err := parseCipherSuites(c.CipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("cipher_suites: %v", err))
+	}
+	if c.RequireClientCert && c.ClientCAFile == "" {
+		errs = append(errs, errors.New("require_client_cert: client_ca_file must be set"))
+	}
+	if c.ClientCAFile != "" {
+		if err := checkReadable(c.ClientCAFile); err != nil {
+			errs = append(errs, fmt.Errorf("client_ca_file: %v", err))
+		}
+	}
+	if c.AutoTLS.Enabled() && c.HTTPOnly {
+		errs = append(errs, errors.New("auto_tls: can't get certificates when http_only is set"))
+	}
+	if !c.HTTPOnly && !c.AutoTLS.Enabled() && !c.DevCert {
+		if c.CertFile != "" || c.KeyFile != "" || len(c.Certificates) == 0 {
+			if err := checkReadable(c.CertFile); err != nil {
+				errs = append(errs, fmt.Errorf("cert_file: %v; generate one using 'make generate_cert'", err))
+			}
+			if err := checkReadable(c.KeyFile); err != nil {
+				errs = append(errs, fmt.Errorf("key_file: %v; generate one using 'make generate_cert'", err))
+			}
+		}
+		for i, pair := range c.Certificates {
+			if err := checkReadable(pair.CertFile); err != nil {
+				errs = append(errs, fmt.Errorf("certificates[%d].cert_file: %v", i, err))
+			}
+			if err := checkReadable(pair.KeyFile); err != nil {
+				errs = append(errs, fmt.Errorf("certificates[%d].key_file: %v", i, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkReadable returns an error if filename can't be opened for reading.
+func checkReadable(filename string) error {
+	if filename == "" {
+		return errors.New("no file specified")
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// defaultConfig is written by writeDefaultConfig. The %s is replaced with a
+// randomly generated secret key.
+const defaultConfig = `# Config file for go-html-boilerplate. Every scalar or list value can also be
+# set with an environment variable: upper-case the key and add an APP_ prefix,
+# for example APP_PORT=8080.
+
+# Used to encrypt sessions and other data before serving it to the client. Must
+# be a 64 character hex string; generate a new one with "openssl rand -hex 32".
+# To rotate the key, replace secret_key with a list of keys; the first encrypts
+# new data, and the rest are still accepted for old cookies:
+#
+# secret_keys:
+#   - <new key>
+#   - <old key>
+secret_key: %s
+
+# Port to listen on. Set to 0 to choose a port at random.
+port: 7065
+
+# IP address of the interface to listen on. Remove this to listen on all
+# interfaces.
+bind_address: 127.0.0.1
+
+# Set to true to serve HTTP instead of HTTPS. You need TLS to use HTTP/2 server
+# push.
+http_only: false
+
+# Run "make generate_cert" to generate these files.
+cert_file: cert.pem
+key_file: key.pem
+`
+
+// writeDefaultConfig writes a commented YAML config file with a new secret key
+// to filename. If filename already exists, writeDefaultConfig returns an error
+// unless force is true.
+func writeDefaultConfig(filename string, force bool) error {
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".yml", ".yaml":
+	default:
+		return fmt.Errorf("can only write a YAML config file, not %q", filename)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(filename, flags, 0600)
+	if err != nil {
+		return err
+	}
+	key := NewRandomKey()
+	if _, err := fmt.Fprintf(f, defaultConfig, hex.EncodeToString(key[:])); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
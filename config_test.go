@@ -0,0 +1,264 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var yamlConfig = []byte(`
+secret_key: d7211b215341871968869d0e3f48ac0ff1789fc88e0ac6e296ba36703edf8ab1
+port: 8080
+http_only: true
+cert_file: cert.pem
+key_file: key.pem
+`)
+
+var jsonConfig = []byte(`{
+  "secret_key": "d7211b215341871968869d0e3f48ac0ff1789fc88e0ac6e296ba36703edf8ab1",
+  "port": 8080,
+  "http_only": true,
+  "cert_file": "cert.pem",
+  "key_file": "key.pem"
+}`)
+
+func TestParseConfigJSONMatchesYAML(t *testing.T) {
+	yc := new(FileConfig)
+	if err := parseConfig("config.yml", yamlConfig, yc); err != nil {
+		t.Fatal(err)
+	}
+	jc := new(FileConfig)
+	if err := parseConfig("config.json", jsonConfig, jc); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(yc, jc) {
+		t.Errorf("JSON and YAML configs differ:\nyaml: %#v\njson: %#v", yc, jc)
+	}
+	if yc.Port == nil || *yc.Port != 8080 {
+		t.Errorf("expected port 8080, got %v", yc.Port)
+	}
+}
+
+func TestParseConfigUnknownExtension(t *testing.T) {
+	if err := parseConfig("config.ini", []byte("port=80"), new(FileConfig)); err == nil {
+		t.Error("expected an error for an unknown extension, got nil")
+	}
+}
+
+func TestParseConfigTOML(t *testing.T) {
+	data, err := ioutil.ReadFile("config.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := new(FileConfig)
+	if err := parseConfig("config.toml", data, c); err != nil {
+		t.Fatal(err)
+	}
+	if c.SecretKey != "" {
+		t.Errorf("SecretKey: got %q, want empty", c.SecretKey)
+	}
+	if c.Port == nil || *c.Port != 7065 {
+		t.Errorf("Port: got %v, want 7065", c.Port)
+	}
+	if c.CertFile != "cert.pem" {
+		t.Errorf("CertFile: got %q, want cert.pem", c.CertFile)
+	}
+	if c.KeyFile != "key.pem" {
+		t.Errorf("KeyFile: got %q, want key.pem", c.KeyFile)
+	}
+}
+
+func TestParseConfigTOMLOmittedPort(t *testing.T) {
+	data := []byte(`secret_key = "d7211b215341871968869d0e3f48ac0ff1789fc88e0ac6e296ba36703edf8ab1"
+cert_file = "a.pem"
+key_file = "b.pem"
+`)
+	c := new(FileConfig)
+	if err := parseConfig("config.toml", data, c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != nil {
+		t.Errorf("Port: got %d, want nil", *c.Port)
+	}
+	if c.SecretKey != "d7211b215341871968869d0e3f48ac0ff1789fc88e0ac6e296ba36703edf8ab1" {
+		t.Errorf("SecretKey: got %q", c.SecretKey)
+	}
+	if c.CertFile != "a.pem" || c.KeyFile != "b.pem" {
+		t.Errorf("got CertFile %q KeyFile %q, want a.pem b.pem", c.CertFile, c.KeyFile)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	key := "d7211b215341871968869d0e3f48ac0ff1789fc88e0ac6e296ba36703edf8ab1"
+	defer setenv("APP_PORT", "9999")()
+	defer setenv("APP_SECRET_KEY", key)()
+	defer setenv("APP_CERT_FILE", "/etc/ssl/cert.pem")()
+	defer setenv("APP_HTTP_ONLY", "true")()
+	c, err := loadConfig("testdata/does-not-exist.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port == nil || *c.Port != 9999 {
+		t.Errorf("Port: got %v, want 9999", c.Port)
+	}
+	if c.SecretKey != key {
+		t.Errorf("SecretKey: got %q, want %q", c.SecretKey, key)
+	}
+	if c.CertFile != "/etc/ssl/cert.pem" {
+		t.Errorf("CertFile: got %q, want /etc/ssl/cert.pem", c.CertFile)
+	}
+	if !c.HTTPOnly {
+		t.Error("HTTPOnly: got false, want true")
+	}
+}
+
+func TestLoadConfigEnvOverridesFile(t *testing.T) {
+	defer setenv("APP_PORT", "9999")()
+	c, err := loadConfig("config.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port == nil || *c.Port != 9999 {
+		t.Errorf("Port: got %v, want 9999", c.Port)
+	}
+	if c.CertFile != "cert.pem" {
+		t.Errorf("CertFile: got %q, want value from file", c.CertFile)
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	if _, err := loadConfig("testdata/does-not-exist.yml"); err == nil {
+		t.Error("expected an error for a missing file with no environment, got nil")
+	}
+}
+
+func TestLoadConfigInvalidEnv(t *testing.T) {
+	defer setenv("APP_PORT", "notaport")()
+	if _, err := loadConfig("config.yml"); err == nil {
+		t.Error("expected an error for an invalid APP_PORT, got nil")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	f, err := ioutil.TempFile("", "go-html-boilerplate-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	readable := f.Name()
+
+	port := func(p int) *int { return &p }
+	validKey := "d7211b215341871968869d0e3f48ac0ff1789fc88e0ac6e296ba36703edf8ab1"
+	tests := []struct {
+		name string
+		c    FileConfig
+		want []string
+	}{
+		{"valid", FileConfig{SecretKey: validKey, Port: port(7065), CertFile: readable, KeyFile: readable}, nil},
+		{"valid http only", FileConfig{Port: port(0), HTTPOnly: true}, nil},
+		{"short secret key", FileConfig{SecretKey: "abc", HTTPOnly: true}, []string{"secret_key"}},
+		{"non-hex secret key", FileConfig{SecretKey: strings.Repeat("z", 64), HTTPOnly: true}, []string{"secret_key"}},
+		{"negative port", FileConfig{Port: port(-1), HTTPOnly: true}, []string{"port"}},
+		{"port too large", FileConfig{Port: port(65536), HTTPOnly: true}, []string{"port"}},
+		{"missing cert", FileConfig{CertFile: "testdata/missing.pem", KeyFile: readable}, []string{"cert_file"}},
+		{"missing key", FileConfig{CertFile: readable, KeyFile: "testdata/missing.pem"}, []string{"key_file"}},
+		{"missing dev dir", FileConfig{HTTPOnly: true, Dev: true, DevDir: "testdata/missing"}, []string{"dev_dir", "dev_dir"}},
+		{"valid secret keys", FileConfig{HTTPOnly: true, SecretKeys: []string{validKey, validKey}}, nil},
+		{"invalid fallback key", FileConfig{HTTPOnly: true, SecretKeys: []string{validKey, "abc"}}, []string{"secret_keys"}},
+		{"secret key and secret keys", FileConfig{HTTPOnly: true, SecretKey: validKey, SecretKeys: []string{validKey}}, []string{"secret_key"}},
+		{"invalid metrics network", FileConfig{HTTPOnly: true, MetricsAllow: []string{"localhost"}}, []string{"metrics_allow"}},
+		{"admin user without hash", FileConfig{HTTPOnly: true, AdminUser: "admin"}, []string{"admin_user"}},
+		{"invalid admin hash", FileConfig{HTTPOnly: true, AdminUser: "admin", AdminPasswordHash: "hunter2"}, []string{"admin_password_hash"}},
+		{"negative request timeout", FileConfig{HTTPOnly: true, RequestTimeout: Duration{-1}}, []string{"request_timeout"}},
+		{"invalid route timeout", FileConfig{HTTPOnly: true, RouteTimeouts: map[string]Duration{"reports": {}}}, []string{"route_timeouts"}},
+		{"negative max body bytes", FileConfig{HTTPOnly: true, MaxBodyBytes: -1}, []string{"max_body_bytes"}},
+		{"negative max upload bytes", FileConfig{HTTPOnly: true, MaxUploadBytes: -1}, []string{"max_upload_bytes"}},
+		{"invalid upload type", FileConfig{HTTPOnly: true, UploadTypes: []string{"png"}}, []string{"upload_types"}},
+		{"invalid body limit", FileConfig{HTTPOnly: true, BodyLimits: map[string]int64{"upload": 10}}, []string{"body_limits"}},
+		{"negative hsts max age", FileConfig{HTTPOnly: true, HSTSMaxAge: Duration{-1}}, []string{"hsts_max_age"}},
+		{"negative rate limit", FileConfig{HTTPOnly: true, RateLimit: -1}, []string{"rate_limit"}},
+		{"invalid trusted proxy", FileConfig{HTTPOnly: true, TrustedProxies: []string{"proxy"}}, []string{"trusted_proxies"}},
+		{"invalid cors origin", FileConfig{HTTPOnly: true, CORS: CORSConfig{AllowedOrigins: []string{"example.com"}}}, []string{"cors"}},
+		{"cors wildcard with credentials", FileConfig{HTTPOnly: true, CORS: CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}}, []string{"cors"}},
+		{"invalid flag percent", FileConfig{HTTPOnly: true, Flags: map[string]FlagSpec{"new_nav": {Percent: 150}}}, []string{"flags"}},
+		{"invalid static prefix", FileConfig{HTTPOnly: true, StaticPrefix: "assets/"}, []string{"static_prefix"}},
+		{"invalid static dir", FileConfig{HTTPOnly: true, StaticDirs: []StaticDir{{Name: "uploads", Prefix: "/static/uploads/", Dir: "."}}}, []string{"static_dirs"}},
+		{"missing static dir", FileConfig{HTTPOnly: true, StaticDirs: []StaticDir{{Name: "uploads", Prefix: "/uploads/", Dir: "testdata/missing"}}}, []string{"static_dirs"}},
+		{"invalid web manifest", FileConfig{HTTPOnly: true, WebManifest: "{"}, []string{"web_manifest"}},
+		{"invalid base url", FileConfig{HTTPOnly: true, BaseURL: "www.example.com"}, []string{"base_url"}},
+		{"invalid spa exclude", FileConfig{HTTPOnly: true, SPAExclude: []string{"api/"}}, []string{"spa_exclude"}},
+		{"invalid maintenance path", FileConfig{HTTPOnly: true, MaintenanceAllow: []string{"admin"}}, []string{"maintenance_allow"}},
+		{"negative maintenance retry after", FileConfig{HTTPOnly: true, MaintenanceRetryAfter: Duration{-1}}, []string{"maintenance_retry_after"}},
+		{"invalid unlogged path", FileConfig{HTTPOnly: true, UnloggedPaths: []string{"healthz"}}, []string{"unlogged_paths"}},
+		{"unknown log format", FileConfig{HTTPOnly: true, LogFormat: "xml"}, []string{"log_format"}},
+		{"unknown session store", FileConfig{HTTPOnly: true, SessionStore: "memcache"}, []string{"session_store"}},
+		{"everything wrong", FileConfig{SecretKey: "abc", Port: port(70000)}, []string{"secret_key", "port", "cert_file", "key_file"}},
+	}
+	for _, tt := range tests {
+		err := tt.c.Validate()
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: got error %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		verr, ok := err.(ValidationError)
+		if !ok {
+			t.Errorf("%s: got %#v, want a ValidationError", tt.name, err)
+			continue
+		}
+		if len(verr) != len(tt.want) {
+			t.Errorf("%s: got %d errors (%v), want %d", tt.name, len(verr), verr, len(tt.want))
+			continue
+		}
+		for i, field := range tt.want {
+			if !strings.HasPrefix(verr[i].Error(), field+":") {
+				t.Errorf("%s: error %d: got %q, want it to start with %q", tt.name, i, verr[i], field)
+			}
+		}
+	}
+}
+
+func TestWriteDefaultConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config.yml")
+	if err := writeDefaultConfig(filename, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := new(FileConfig)
+	if err := parseConfig(filename, data, c); err != nil {
+		t.Fatalf("default config is not valid YAML: %v", err)
+	}
+	if _, err := getSecretKey(c.SecretKey); err != nil || c.SecretKey == "" {
+		t.Errorf("expected a valid generated secret key, got %q (%v)", c.SecretKey, err)
+	}
+	if c.Port == nil || *c.Port != 7065 {
+		t.Errorf("Port: got %v, want 7065", c.Port)
+	}
+	if c.CertFile != "cert.pem" || c.KeyFile != "key.pem" {
+		t.Errorf("got CertFile %q KeyFile %q, want cert.pem key.pem", c.CertFile, c.KeyFile)
+	}
+
+	if err := writeDefaultConfig(filename, false); err == nil {
+		t.Error("expected an error overwriting an existing file without force")
+	}
+	if err := writeDefaultConfig(filename, true); err != nil {
+		t.Errorf("overwriting with force: %v", err)
+	}
+	data2, _ := ioutil.ReadFile(filename)
+	if string(data2) == string(data) {
+		t.Error("expected a new secret key after overwriting")
+	}
+}
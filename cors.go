@@ -0,0 +1,129 @@
+package main
+
+// Cross-origin resource sharing (CORS), for pages on other sites that call
+// this server from JavaScript.
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures which other sites can call the server from a browser.
+type CORSConfig struct {
+	// AllowedOrigins are the origins, like "https://app.example.com", that
+	// may make cross-origin requests. "*" allows any origin, and can't be
+	// used with AllowCredentials. CORS headers are only sent if this is set.
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins" toml:"allowed_origins"`
+
+	// AllowedMethods and AllowedHeaders are the methods and request headers
+	// cross-origin requests may use, beyond the ones browsers always allow.
+	// AllowedMethods defaults to DefaultCORSMethods.
+	AllowedMethods []string `yaml:"allowed_methods" json:"allowed_methods" toml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers" json:"allowed_headers" toml:"allowed_headers"`
+
+	// Set AllowCredentials to true to let cross-origin requests include
+	// cookies. They still need a CSRF token to change anything.
+	AllowCredentials bool `yaml:"allow_credentials" json:"allow_credentials" toml:"allow_credentials"`
+
+	// MaxAge is how long browsers may cache the response to a preflight
+	// request, like "10m". If unspecified, browsers use their own default,
+	// which is a few seconds.
+	MaxAge Duration `yaml:"max_age" json:"max_age" toml:"max_age"`
+}
+
+// DefaultCORSMethods are allowed in cross-origin requests if no methods are
+// configured.
+var DefaultCORSMethods = []string{"GET", "HEAD", "POST"}
+
+// Enabled reports whether any cross-origin requests are allowed.
+func (cc CORSConfig) Enabled() bool {
+	return len(cc.AllowedOrigins) > 0
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for
+// a request from origin, or the empty string if origin isn't allowed.
+func (cc CORSConfig) allowOrigin(origin string) string {
+	for _, o := range cc.AllowedOrigins {
+		if o == "*" {
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// validate returns an error if the config has an invalid origin, allows any
+// origin with credentials, or has a negative max age.
+func (cc CORSConfig) validate() error {
+	for _, o := range cc.AllowedOrigins {
+		if o == "*" {
+			// Any site could make requests with the user's cookies.
+			if cc.AllowCredentials {
+				return fmt.Errorf(`"*" can't be used with allow_credentials; list the allowed origins instead`)
+			}
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return fmt.Errorf("%q is not an origin like https://example.com", o)
+		}
+	}
+	if cc.MaxAge.Duration < 0 {
+		return fmt.Errorf("max_age: %v is negative", cc.MaxAge)
+	}
+	return nil
+}
+
+// withCORS adds CORS headers to responses to cross-origin requests from the
+// origins allowed in the current config, and answers preflight requests from
+// those origins with a 204. Requests from other origins get no CORS headers,
+// so browsers block them.
+func withCORS(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := currentConfig()
+		if c == nil || !c.CORS.Enabled() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cc := c.CORS
+		// The response depends on the Origin, so caches must not share it
+		// between origins.
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		allow := ""
+		if origin != "" {
+			allow = cc.allowOrigin(origin)
+		}
+		if allow == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allow)
+		if cc.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.Method != "OPTIONS" || r.Header.Get("Access-Control-Request-Method") == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		// A preflight request, asking whether the real request is allowed.
+		methods := cc.AllowedMethods
+		if len(methods) == 0 {
+			methods = DefaultCORSMethods
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if len(cc.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(cc.AllowedHeaders, ", "))
+		}
+		if cc.MaxAge.Duration > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cc.MaxAge.Duration/time.Second)))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.CORS = CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		AllowedHeaders:   []string{"Content-Type", "X-CSRF-Token"},
+		AllowCredentials: true,
+		MaxAge:           Duration{10 * time.Minute},
+	}
+	setLive(c, NewRandomKey())
+	var served int
+	h := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		w.Write([]byte("ok"))
+	}))
+	do := func(method, origin string, preflight bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "PUT")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("GET", "https://app.example.com", false)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("allowed origin: got Access-Control-Allow-Origin %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("allowed origin: got Access-Control-Allow-Credentials %q", got)
+	}
+	if w.Body.String() != "ok" || served != 1 {
+		t.Errorf("allowed origin: expected the handler to run")
+	}
+
+	w = do("GET", "https://evil.example.com", false)
+	for key := range w.Header() {
+		if key != "Vary" && key != "Content-Type" {
+			t.Errorf("disallowed origin: got header %s: %q", key, w.Header().Get(key))
+		}
+	}
+	if w.Header().Get("Vary") != "Origin" {
+		t.Errorf("disallowed origin: got Vary %q, want Origin", w.Header().Get("Vary"))
+	}
+
+	served = 0
+	w = do("OPTIONS", "https://app.example.com", true)
+	if w.Code != 204 || served != 0 {
+		t.Errorf("preflight: got code %d (handler ran %d times), want 204 without running the handler", w.Code, served)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, PUT",
+		"Access-Control-Allow-Headers": "Content-Type, X-CSRF-Token",
+		"Access-Control-Max-Age":       "600",
+	}
+	for key, val := range want {
+		if got := w.Header().Get(key); got != val {
+			t.Errorf("preflight: got %s %q, want %q", key, got, val)
+		}
+	}
+
+	w = do("OPTIONS", "https://evil.example.com", true)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" || served != 1 {
+		t.Errorf("disallowed preflight: got Access-Control-Allow-Origin %q, want it passed to the handler", got)
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.CORS.AllowedOrigins = []string{"*"}
+	setLive(c, NewRandomKey())
+	h := withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("got Access-Control-Allow-Origin %q, want *", got)
+	}
+}
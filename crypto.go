@@ -8,6 +8,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"io"
+	"io/ioutil"
+	"strings"
 
 	"golang.org/x/crypto/nacl/secretbox"
 )
@@ -41,25 +43,52 @@ func getSecretKey(hexKey string) (*[32]byte, error) {
 	return secretKey, nil
 }
 
-func newNonce() *[24]byte {
-	nonce := new([24]byte)
-	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
-		panic(err)
+// DefaultSecretKeyFile is where a generated secret key is saved if no
+// SecretKeyFile is configured.
+const DefaultSecretKeyFile = ".secret_key"
+
+// loadSecretKey is like getSecretKey, but if hexKey is the empty string it
+// reuses the key saved in keyFile. If keyFile doesn't exist, a new key is
+// generated and written to keyFile, so sessions survive a server restart. If
+// keyFile can't be written, the new key is returned anyway and a warning is
+// logged.
+func loadSecretKey(hexKey string, keyFile string) (*[32]byte, error) {
+	if hexKey != "" {
+		return getSecretKey(hexKey)
+	}
+	if keyFile == "" {
+		keyFile = DefaultSecretKeyFile
 	}
-	return nonce
+	if data, err := ioutil.ReadFile(keyFile); err == nil {
+		return getSecretKey(strings.TrimSpace(string(data)))
+	}
+	key := NewRandomKey()
+	if err := ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(key[:])+"\n"), 0600); err != nil {
+		logger.Warn("Couldn't save generated secret key; sessions will not survive a restart", "file", keyFile, "err", err)
+	}
+	return key, nil
 }
 
-func opaqueByte(b []byte, secretKey *[32]byte) string {
-	nonce := newNonce()
-	encrypted := secretbox.Seal(nonce[:], b, nonce, secretKey)
-	return base64.URLEncoding.EncodeToString(encrypted)
+// Encrypt seals plaintext with key using secretbox, and returns the random
+// nonce and the sealed box encoded with URL-safe base64. The result can be
+// used in a cookie or a URL. Use Decrypt to get the plaintext back.
+func Encrypt(key *[32]byte, plaintext []byte) (string, error) {
+	nonce := new([24]byte)
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return "", err
+	}
+	encrypted := secretbox.Seal(nonce[:], plaintext, nonce, key)
+	return base64.URLEncoding.EncodeToString(encrypted), nil
 }
 
 var errTooShort = errors.New("Encrypted string is too short")
 var errInvalidInput = errors.New("Could not decrypt invalid input")
 
-func unopaqueByte(compressed string, secretKey *[32]byte) ([]byte, error) {
-	encrypted, err := base64.URLEncoding.DecodeString(compressed)
+// Decrypt decodes and opens ciphertext created by Encrypt with the same key.
+// It returns an error if ciphertext was sealed with a different key or has
+// been modified.
+func Decrypt(key *[32]byte, ciphertext string) ([]byte, error) {
+	encrypted, err := base64.URLEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return nil, err
 	}
@@ -68,23 +97,41 @@ func unopaqueByte(compressed string, secretKey *[32]byte) ([]byte, error) {
 	}
 	decryptNonce := new([24]byte)
 	copy(decryptNonce[:], encrypted[:24])
-	decrypted, ok := secretbox.Open([]byte{}, encrypted[24:], decryptNonce, secretKey)
+	decrypted, ok := secretbox.Open([]byte{}, encrypted[24:], decryptNonce, key)
 	if !ok {
 		return nil, errInvalidInput
 	}
 	return decrypted, nil
 }
 
+// DecryptAny is like Decrypt, but tries each key in turn, so data encrypted
+// with an older key can still be read after the key is rotated.
+func DecryptAny(keys []*[32]byte, ciphertext string) ([]byte, error) {
+	err := errInvalidInput
+	for _, key := range keys {
+		var b []byte
+		b, err = Decrypt(key, ciphertext)
+		if err == nil {
+			return b, nil
+		}
+	}
+	return nil, err
+}
+
 // Opaque encrypts s with secretKey and returns the encrypted string encoded
-// with base64, or an error.
+// with base64. It panics if random bytes for the nonce cannot be read.
 func opaque(s string, secretKey *[32]byte) string {
-	return opaqueByte([]byte(s), secretKey)
+	encrypted, err := Encrypt(secretKey, []byte(s))
+	if err != nil {
+		panic(err)
+	}
+	return encrypted
 }
 
 // Unopaque decodes compressed using base64, then decrypts the decoded byte
 // array using the secretKey.
 func unopaque(compressed string, secretKey *[32]byte) (string, error) {
-	b, err := unopaqueByte(compressed, secretKey)
+	b, err := Decrypt(secretKey, compressed)
 	if err != nil {
 		return "", err
 	}
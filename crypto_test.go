@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSecretKeyGeneratesAndReuses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, ".secret_key")
+
+	key, err := loadSecretKey("", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		t.Fatalf("expected key to be saved: %v", err)
+	}
+	saved := strings.TrimSpace(string(data))
+	if len(saved) != 64 {
+		t.Errorf("saved key: got length %d, want 64", len(saved))
+	}
+	if saved != hex.EncodeToString(key[:]) {
+		t.Errorf("saved key %q does not match generated key", saved)
+	}
+
+	key2, err := loadSecretKey("", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *key2 != *key {
+		t.Errorf("expected second load to reuse the saved key")
+	}
+}
+
+func TestLoadSecretKeyUnwritable(t *testing.T) {
+	f, err := ioutil.TempFile("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	// The parent "directory" is a regular file, so the key can't be written.
+	keyFile := filepath.Join(f.Name(), ".secret_key")
+	key, err := loadSecretKey("", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == nil {
+		t.Fatal("expected a generated key, got nil")
+	}
+	if _, err := os.Stat(keyFile); err == nil {
+		t.Errorf("expected no key file at %s", keyFile)
+	}
+}
+
+func TestLoadSecretKeyConfigured(t *testing.T) {
+	hexKey := strings.Repeat("ab", 32)
+	key, err := loadSecretKey(hexKey, "/nonexistent/.secret_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(key[:]); got != hexKey {
+		t.Errorf("got key %q, want %q", got, hexKey)
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := NewRandomKey()
+	for _, plaintext := range []string{"", "hello", strings.Repeat("long message ", 100)} {
+		ciphertext, err := Encrypt(key, []byte(plaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(ciphertext, "hello") || strings.Contains(ciphertext, "long") {
+			t.Errorf("ciphertext %q contains the plaintext", ciphertext)
+		}
+		got, err := Decrypt(key, ciphertext)
+		if err != nil {
+			t.Errorf("%q: %v", plaintext, err)
+			continue
+		}
+		if string(got) != plaintext {
+			t.Errorf("got %q, want %q", got, plaintext)
+		}
+	}
+	a, _ := Encrypt(key, []byte("hello"))
+	b, _ := Encrypt(key, []byte("hello"))
+	if a == b {
+		t.Error("expected a new nonce for every call to Encrypt")
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	key := NewRandomKey()
+	ciphertext, err := Encrypt(key, []byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.URLEncoding.DecodeString(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip a bit in the nonce, the authenticator and the sealed message.
+	for _, i := range []int{0, 24, len(raw) - 1} {
+		tampered := append([]byte(nil), raw...)
+		tampered[i] ^= 1
+		if b, err := Decrypt(key, base64.URLEncoding.EncodeToString(tampered)); err == nil {
+			t.Errorf("byte %d: expected an error for tampered input, got %q", i, b)
+		}
+	}
+	tests := []struct {
+		name       string
+		key        *[32]byte
+		ciphertext string
+	}{
+		{"wrong key", NewRandomKey(), ciphertext},
+		{"truncated", key, ciphertext[:20]},
+		{"not base64", key, "!!!" + ciphertext},
+		{"empty", key, ""},
+	}
+	for _, tt := range tests {
+		if b, err := Decrypt(tt.key, tt.ciphertext); err == nil || b != nil {
+			t.Errorf("%s: got %q, %v, want an error", tt.name, b, err)
+		}
+	}
+}
+
+func TestDecryptAny(t *testing.T) {
+	oldKey, newKey := NewRandomKey(), NewRandomKey()
+	ciphertext, err := Encrypt(oldKey, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := DecryptAny([]*[32]byte{newKey, oldKey}, ciphertext); err != nil || string(b) != "hello" {
+		t.Errorf("got %q, %v, want hello", b, err)
+	}
+	if _, err := DecryptAny([]*[32]byte{newKey}, ciphertext); err == nil {
+		t.Error("expected an error without the old key")
+	}
+	if _, err := DecryptAny(nil, ciphertext); err == nil {
+		t.Error("expected an error with no keys")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+// Protection against cross-site request forgery.
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/kevinburke/rest"
+)
+
+// csrfKey is the session key for the CSRF token.
+const csrfKey = "_csrf"
+
+// CSRFFormField and CSRFHeader are where withCSRF looks for the token in a
+// request.
+const (
+	CSRFFormField = "csrf_token"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// CSRFToken returns the CSRF token for the session in ctx, generating one if
+// the session doesn't have a token yet. The token is stored in the session, so
+// it's sealed with the secret key and differs for every client. CSRFToken
+// returns the empty string if ctx has no session.
+func CSRFToken(ctx context.Context) string {
+	s := sessionFromContext(ctx)
+	if s == nil {
+		return ""
+	}
+	if token, ok := s[csrfKey].(string); ok && token != "" {
+		return token
+	}
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	s[csrfKey] = token
+	return token
+}
+
+// csrfField returns a hidden form input holding token.
+func csrfField(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + CSRFFormField + `" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
+// csrfMaxMemory is how much of a multipart form is kept in memory while
+// looking for the CSRF token; the rest is written to temporary files. It's the
+// same as the default for http.Request.FormValue.
+const csrfMaxMemory = 32 << 20
+
+// parseForm parses the form in the body of r, whether it's URL-encoded or
+// multipart. Unlike r.ParseMultipartForm, it returns the error from reading a
+// URL-encoded body, such as one over the size limit. Only the first call
+// returns the error.
+func parseForm(r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		return r.ParseMultipartForm(csrfMaxMemory)
+	}
+	return r.ParseForm()
+}
+
+// safeMethod reports whether requests with method can't change state, and
+// don't need a CSRF token.
+func safeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// withCSRF rejects requests that can change state unless they include the
+// session's CSRF token in the X-CSRF-Token header or the csrf_token form field.
+// Templates add the field to a form with {{ csrfField $ }}. withCSRF must run
+// inside withSession.
+func withCSRF(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r.Method) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		s := sessionFromContext(r.Context())
+		want, _ := s[csrfKey].(string)
+		got := r.Header.Get(CSRFHeader)
+		if got == "" {
+			if err := parseForm(r); err != nil && isBodyTooLarge(err) {
+				bodyTooLarge(w, r)
+				return
+			}
+			got = r.PostFormValue(CSRFFormField)
+		}
+		if want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			rest.Forbidden(w, r, &rest.Error{
+				Title: "Invalid or missing CSRF token",
+				ID:    "invalid_csrf_token",
+			})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// csrfClient gets a session cookie and CSRF token from h.
+func csrfClient(t *testing.T, h http.Handler) (*http.Cookie, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/token", nil))
+	return getSessionCookie(t, w), w.Body.String()
+}
+
+func TestCSRF(t *testing.T) {
+	defer live.Store(getLive())
+	setLive(testConfig(), NewRandomKey())
+
+	r := newRouter()
+	r.Get("/token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CSRFToken(r.Context())))
+	}))
+	r.Post("/save", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("saved"))
+	}))
+	h := withSession(withCSRF(r), nil)
+
+	cookie, token := csrfClient(t, h)
+	_, otherToken := csrfClient(t, h)
+	if token == "" || token == otherToken {
+		t.Fatalf("expected a different token for each session, got %q and %q", token, otherToken)
+	}
+
+	form := func(token string) *http.Request {
+		req := httptest.NewRequest("POST", "/save", strings.NewReader(url.Values{CSRFFormField: {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+	header := func(token string) *http.Request {
+		req := httptest.NewRequest("POST", "/save", nil)
+		req.Header.Set(CSRFHeader, token)
+		return req
+	}
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"form field", form(token), 200},
+		{"header", header(token), 200},
+		{"missing token", httptest.NewRequest("POST", "/save", nil), 403},
+		{"token from another session", form(otherToken), 403},
+		{"header from another session", header(otherToken), 403},
+	}
+	for _, tt := range tests {
+		tt.req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, tt.req)
+		if w.Code != tt.want {
+			t.Errorf("%s: got code %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	// Without a session cookie there's no token to match.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, form(token))
+	if w.Code != 403 {
+		t.Errorf("no session: got code %d, want 403", w.Code)
+	}
+}
+
+func TestCSRFField(t *testing.T) {
+	want := `<input type="hidden" name="csrf_token" value="a&lt;b">`
+	if got := string(csrfField("a<b")); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+// Keys for values stored in a request's context.
+
+type ctxVar int
+
+const (
+	clientSubjectKey ctxVar = iota
+	paramsKey
+	sessionKey
+	requestIDKey
+	loggerKey
+	earlyHintsKey
+	cspNonceKey
+	clientIPKey
+	serverWriterKey
+)
@@ -0,0 +1,93 @@
+package main
+
+// Showing the config the server is running with.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// redactedFields are config fields whose values debugConfigHandler hides.
+var redactedFields = map[string]bool{
+	"secret_key":          true,
+	"secret_keys":         true,
+	"admin_password_hash": true,
+	"pprof_password":      true,
+	"key_file":            true,
+}
+
+// redactedConfig returns c as JSON values, with the fields in redactedFields,
+// including those in nested objects, replaced by a note of how long they are.
+func redactedConfig(c *FileConfig) (map[string]interface{}, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	redact(v)
+	return v, nil
+}
+
+func redact(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if redactedFields[k] {
+				v[k] = mask(field)
+			} else {
+				redact(field)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			redact(item)
+		}
+	}
+}
+
+// mask replaces a secret with a description of its length, so it's possible
+// to tell whether it's set without seeing it.
+func mask(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return ""
+		}
+		return fmt.Sprintf("[redacted, %d characters]", len(v))
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = mask(item)
+		}
+		return masked
+	case nil:
+		return nil
+	default:
+		return "[redacted]"
+	}
+}
+
+// debugConfigHandler responds with the current config as JSON, after
+// defaults, the config file and environment variables have been applied.
+// Secrets are redacted, but the rest of the config can still tell an
+// attacker a lot about the server, so it's only served in dev mode or with
+// the admin credentials.
+func debugConfigHandler(w http.ResponseWriter, r *http.Request) {
+	c := currentConfig()
+	if c == nil {
+		writeError(w, http.StatusServiceUnavailable, "No config is loaded")
+		return
+	}
+	v, err := redactedConfig(c)
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Could not encode config", "err", err)
+		writeError(w, http.StatusInternalServerError, "Could not encode config")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, v)
+}
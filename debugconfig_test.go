@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugConfig(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.DebugConfig = true
+	c.AdminUser = "admin"
+	c.AdminPasswordHash = testPasswordHash(t, "hunter2")
+	c.Certificates = []CertKeyPair{{CertFile: "example.pem", KeyFile: "example.key"}}
+	setLive(c, NewRandomKey())
+	mux := NewServeMux(c)
+
+	req := httptest.NewRequest("GET", "/debug/config", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Errorf("without credentials: got code %d, want 401", w.Code)
+	}
+	req.SetBasicAuth("admin", "hunter2")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("with credentials: got code %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	for _, secret := range []string{c.SecretKey, c.AdminPasswordHash, "example.key"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("response contains secret %q: %s", secret, body)
+		}
+	}
+	var got struct {
+		SecretKey    string `json:"secret_key"`
+		HTTPOnly     bool   `json:"http_only"`
+		AdminUser    string `json:"admin_user"`
+		Certificates []struct {
+			CertFile string `json:"cert_file"`
+			KeyFile  string `json:"key_file"`
+		} `json:"certificates"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.SecretKey != "[redacted, 64 characters]" {
+		t.Errorf("got secret_key %q, want it masked", got.SecretKey)
+	}
+	if !got.HTTPOnly || got.AdminUser != "admin" {
+		t.Errorf("expected the other fields to be present, got %s", body)
+	}
+	if len(got.Certificates) != 1 || got.Certificates[0].KeyFile != "[redacted, 11 characters]" {
+		t.Errorf("got certificates %+v, want the key file masked", got.Certificates)
+	}
+	if len(got.Certificates) == 1 && got.Certificates[0].CertFile != "example.pem" {
+		t.Errorf("got cert_file %q, want it shown", got.Certificates[0].CertFile)
+	}
+}
+
+func TestDebugConfigNeedsAuthOrDev(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.DebugConfig = true
+	setLive(c, NewRandomKey())
+	w := httptest.NewRecorder()
+	NewServeMux(c).ServeHTTP(w, httptest.NewRequest("GET", "/debug/config", nil))
+	if w.Code != 404 {
+		t.Errorf("no admin_user: got code %d, want 404", w.Code)
+	}
+
+	c.Dev = true
+	c.DevDir = "assets"
+	w = httptest.NewRecorder()
+	NewServeMux(c).ServeHTTP(w, httptest.NewRequest("GET", "/debug/config", nil))
+	if w.Code != 200 {
+		t.Errorf("dev mode: got code %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+// Sending files for the browser to save.
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serveDownload sends content as a file called filename that the browser
+// saves instead of showing. The Content-Type comes from the extension of
+// filename, or is application/octet-stream.
+//
+// If content is an io.ReadSeeker, like a *bytes.Reader or *os.File, the
+// response is sent with http.ServeContent, so clients can resume downloads
+// with range requests, and modtime is used for Last-Modified and
+// If-Modified-Since. Set an ETag header before calling serveDownload to
+// support If-Range and If-None-Match too. Other readers are copied to the
+// response as they are.
+//
+//	serveDownload(w, r, "report.csv", time.Time{}, bytes.NewReader(data))
+func serveDownload(w http.ResponseWriter, r *http.Request, filename string, modtime time.Time, content io.Reader) {
+	name := downloadFilename(filename)
+	hdr := w.Header()
+	hdr.Set("Content-Disposition", contentDisposition(name))
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	hdr.Set("Content-Type", contentType)
+	if rs, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, name, modtime, rs)
+		return
+	}
+	if !modtime.IsZero() {
+		hdr.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method == "HEAD" {
+		return
+	}
+	if _, err := io.Copy(w, content); err != nil {
+		LoggerFrom(r.Context()).Debug("Could not send download", "file", name, "err", err)
+	}
+}
+
+// downloadFilename returns the last element of filename, without any
+// directories, control characters or characters that aren't allowed in file
+// names on Windows. It returns "download" if nothing is left.
+func downloadFilename(filename string) string {
+	filename = filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	filename = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return -1
+		}
+		return r
+	}, filename)
+	filename = strings.Trim(filename, " .")
+	if filename == "" {
+		return "download"
+	}
+	return filename
+}
+
+// contentDisposition returns a Content-Disposition header for a download of
+// filename, which must already be sanitized. Names with non-ASCII characters
+// are encoded as RFC 2231 describes.
+func contentDisposition(filename string) string {
+	if v := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return "attachment"
+}
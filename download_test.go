@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeDownload(t *testing.T) {
+	data := strings.Repeat("name,email\n", 100)
+	modtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	// withGzip mustn't compress a ranged response.
+	h := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveDownload(w, r, "../reports/users.csv", modtime, strings.NewReader(data))
+	}))
+
+	req := httptest.NewRequest("GET", "/download", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("got code %d, want 200", w.Code)
+	}
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename=users.csv`; got != want {
+		t.Errorf("got Content-Disposition %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+		t.Errorf("got Content-Type %q, want text/csv", got)
+	}
+	if got := w.Header().Get("Last-Modified"); got != "Thu, 02 Jan 2020 03:04:05 GMT" {
+		t.Errorf("got Last-Modified %q", got)
+	}
+
+	req = httptest.NewRequest("GET", "/download", nil)
+	req.Header.Set("Range", "bytes=0-9")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("range: got code %d, want 206", w.Code)
+	}
+	if got := w.Body.String(); got != "name,email" {
+		t.Errorf("range: got body %q, want %q", got, "name,email")
+	}
+	if got, want := w.Header().Get("Content-Range"), "bytes 0-9/1100"; got != want {
+		t.Errorf("range: got Content-Range %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("range: got Content-Encoding %q, want none", got)
+	}
+
+	// If-Range with an old date gets the whole file.
+	req = httptest.NewRequest("GET", "/download", nil)
+	req.Header.Set("Range", "bytes=0-9")
+	req.Header.Set("If-Range", modtime.Add(-time.Hour).Format(http.TimeFormat))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 200 || w.Body.String() != data {
+		t.Errorf("stale If-Range: got code %d and %d bytes, want the whole file", w.Code, w.Body.Len())
+	}
+}
+
+func TestServeDownloadReader(t *testing.T) {
+	w := httptest.NewRecorder()
+	body := ioutil.NopCloser(strings.NewReader("hello"))
+	serveDownload(w, httptest.NewRequest("GET", "/", nil), "hello", time.Time{}, body)
+	if w.Code != 200 || w.Body.String() != "hello" {
+		t.Errorf("got code %d and body %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/octet-stream" {
+		t.Errorf("got Content-Type %q, want application/octet-stream", got)
+	}
+}
+
+func TestDownloadFilename(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"report.pdf", `attachment; filename=report.pdf`},
+		{"/etc/passwd", `attachment; filename=passwd`},
+		{`C:\Users\me\notes.txt`, `attachment; filename=notes.txt`},
+		{"a\r\nSet-Cookie: x=y.txt", `attachment; filename="aSet-Cookie x=y.txt"`},
+		{`quote".txt`, `attachment; filename=quote.txt`},
+		{"résumé.pdf", `attachment; filename*=utf-8''r%C3%A9sum%C3%A9.pdf`},
+		{"..", `attachment; filename=download`},
+		{"", `attachment; filename=download`},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition(downloadFilename(tt.in)); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+// Rejecting new requests while the server shuts down.
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// drainRetryAfter is how many seconds clients are told to wait before trying
+// again while the server is shutting down. By then a load balancer should
+// have sent them to another server, or this one should have restarted.
+const drainRetryAfter = 5
+
+// drainer rejects new requests once the server starts shutting down, so a
+// request that arrives on an open connection after shutdown starts gets a
+// clean 503, instead of starting work the server may not have time to finish.
+// Requests that started before are left to finish.
+type drainer struct {
+	draining int32
+}
+
+// start makes every new request get a 503.
+func (d *drainer) start() {
+	atomic.StoreInt32(&d.draining, 1)
+}
+
+func (d *drainer) isDraining() bool {
+	return atomic.LoadInt32(&d.draining) == 1
+}
+
+// wrap responds to requests with a 503 and a Retry-After header once start has
+// been called, and closes the connection; otherwise it calls h.
+func (d *drainer) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !d.isDraining() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Connection", "close")
+		w.Header().Set("Retry-After", strconv.Itoa(drainRetryAfter))
+		writeError(w, http.StatusServiceUnavailable, "The server is shutting down")
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDrain(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	d := new(drainer)
+	s := httptest.NewServer(d.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.Write([]byte("finished"))
+	})))
+	defer s.Close()
+
+	type result struct {
+		code int
+		body string
+		err  error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		res, err := http.Get(s.URL + "/slow")
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		inFlight <- result{res.StatusCode, string(body), err}
+	}()
+	<-started
+
+	d.start()
+	res, err := http.Get(s.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 503 {
+		t.Errorf("new request: got code %d, want 503", res.StatusCode)
+	}
+	if got := res.Header.Get("Retry-After"); got != "5" {
+		t.Errorf("new request: got Retry-After %q, want 5", got)
+	}
+	if !res.Close {
+		t.Error("new request: expected the connection to be closed")
+	}
+
+	close(release)
+	if r := <-inFlight; r.err != nil || r.code != 200 || r.body != "finished" {
+		t.Errorf("in-flight request: got %d %q, %v, want it to finish", r.code, r.body, r.err)
+	}
+}
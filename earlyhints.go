@@ -0,0 +1,82 @@
+package main
+
+// 103 Early Hints, so browsers can start loading assets while a page renders.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// hintFunc sends a 103 Early Hints response with the given Link headers.
+type hintFunc func(links []string)
+
+// withEarlyHints lets handlers inside h send 103 Early Hints responses with
+// earlyHints. It must wrap the ResponseWriter from the http.Server, since
+// writers like httptest.ResponseRecorder and some middleware treat a 103 as
+// the final status code.
+func withEarlyHints(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hint := func(links []string) {
+			hdr := w.Header()
+			prev, had := hdr["Link"]
+			for _, link := range links {
+				hdr.Add("Link", link)
+			}
+			w.WriteHeader(http.StatusEarlyHints)
+			// Headers sent with a 1xx response stay in the header map, so put
+			// it back the way it was; the handler adds the links to the final
+			// response itself.
+			if had {
+				hdr["Link"] = prev
+			} else {
+				hdr.Del("Link")
+			}
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), earlyHintsKey, hintFunc(hint))))
+	})
+}
+
+// withoutEarlyHints returns r with 103 responses turned off, for middleware
+// that buffers the response or writes it from another goroutine.
+func withoutEarlyHints(r *http.Request) *http.Request {
+	if r.Context().Value(earlyHintsKey) == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), earlyHintsKey, hintFunc(nil)))
+}
+
+// preloadLink returns a Link header value that tells browsers to preload
+// resource. destination is a request destination like "style" or "script".
+func preloadLink(resource, destination string) string {
+	return fmt.Sprintf("<%s>; rel=preload; as=%s", resource, destination)
+}
+
+// earlyHints sends a 103 Early Hints response with links, so the browser can
+// start fetching them before the page is ready, and adds them to the final
+// response. If the server can't send a 103 for r, only the final response
+// gets the links. Call it before writing anything else.
+func earlyHints(w http.ResponseWriter, r *http.Request, links ...string) {
+	if hint, ok := r.Context().Value(earlyHintsKey).(hintFunc); ok && hint != nil {
+		hint(links)
+	}
+	for _, link := range links {
+		addLink(w.Header(), link)
+	}
+}
+
+// addLink adds link to the Link header, unless there's already a link to the
+// same resource.
+func addLink(hdr http.Header, link string) {
+	target := link
+	if i := strings.IndexByte(link, '>'); i >= 0 {
+		target = link[:i+1]
+	}
+	for _, v := range hdr.Values("Link") {
+		if strings.HasPrefix(v, target) {
+			return
+		}
+	}
+	hdr.Add("Link", link)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+func TestEarlyHintsHomepage(t *testing.T) {
+	c := testConfig()
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	NewServeMux(c).ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("got code %d, want 200", w.Code)
+	}
+	styleURL, err := newStatic(embedded{}, time.Now(), 0).URL("style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := w.Header().Values("Link")
+	if len(links) != 1 || links[0] != preloadLink(styleURL, "style") {
+		t.Errorf("got Link headers %q, want a preload for %s", links, styleURL)
+	}
+}
+
+func TestEarlyHints(t *testing.T) {
+	h := withEarlyHints(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		earlyHints(w, r, preloadLink("/static/style.css", "style"))
+		w.Write([]byte("ok"))
+	}))
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	var hints []textproto.MIMEHeader
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				hints = append(hints, header)
+			}
+			return nil
+		},
+	}
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	want := "</static/style.css>; rel=preload; as=style"
+	if len(hints) != 1 || hints[0].Get("Link") != want {
+		t.Errorf("got early hints %v, want one with Link %q", hints, want)
+	}
+	if links := resp.Header.Values("Link"); len(links) != 1 || links[0] != want {
+		t.Errorf("got final Link headers %q, want [%q]", links, want)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+// Server error pages.
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/kevinburke/rest"
+)
+
+// fallbackErrorPage is shown if the 500.html template is missing or can't be
+// rendered.
+const fallbackErrorPage = `<!doctype html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <title>Server error</title>
+  </head>
+  <body>
+    <h1>Server error</h1>
+    <p>Something went wrong. Please try again later.</p>
+  </body>
+</html>
+`
+
+// errorPage writes 500 responses. In dev mode the page shows what went wrong;
+// otherwise it's the 500.html template, which shouldn't include any details,
+// since they can reveal things about the server.
+type errorPage struct {
+	// load returns the parsed templates. If it's nil, the fallback page is
+	// used.
+	load func() (map[string]*template.Template, error)
+	dev  bool
+}
+
+// render writes a 500 response. detail is only shown in dev mode.
+func (e *errorPage) render(w http.ResponseWriter, r *http.Request, detail string) {
+	if e.dev {
+		renderDevErrorPage(w, "Server error", detail)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if e.load != nil {
+		if tpls, err := e.load(); err == nil {
+			if tpl, ok := tpls["500.html"]; ok {
+				// Don't use renderStatus, which would call rest.ServerError
+				// again if the template is broken.
+				out, err := executePage(r, tpl, "500.html", nil)
+				if err == nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					w.Write(out)
+					return
+				}
+				LoggerFrom(r.Context()).Error("Couldn't render the error page", "err", err)
+			}
+		}
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte(fallbackErrorPage))
+}
+
+// serverErrorHandler logs the error passed to rest.ServerError, and responds
+// with e.
+func serverErrorHandler(e *errorPage) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		detail := "unknown error"
+		if err := rest.CtxErr(r); err != nil {
+			detail = err.Error()
+		}
+		LoggerFrom(r.Context()).Error("Server error", "code", 500, "method", r.Method, "path", r.URL.Path, "err", detail)
+		e.render(w, r, detail)
+	})
+}
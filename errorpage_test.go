@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/rest"
+)
+
+func TestServerErrorPage(t *testing.T) {
+	secret := errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	for _, dev := range []bool{false, true} {
+		c := testConfig()
+		if dev {
+			c.Dev = true
+			c.DevDir = DefaultDevDir
+		}
+		NewServeMux(c)
+		w := httptest.NewRecorder()
+		rest.ServerError(w, httptest.NewRequest("GET", "/", nil), secret)
+		if w.Code != 500 {
+			t.Errorf("dev %t: got code %d, want 500", dev, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("dev %t: got Content-Type %q, want HTML", dev, ct)
+		}
+		body := w.Body.String()
+		if got := strings.Contains(body, secret.Error()); got != dev {
+			t.Errorf("dev %t: error page shows the error: %t\n%s", dev, got, body)
+		}
+		if !dev && !strings.Contains(body, "Something went wrong") {
+			t.Errorf("expected the 500.html page, got %s", body)
+		}
+	}
+}
+
+func TestServerErrorPageFallback(t *testing.T) {
+	e := &errorPage{}
+	w := httptest.NewRecorder()
+	e.render(w, httptest.NewRequest("GET", "/", nil), "details")
+	if w.Code != 500 || w.Body.String() != fallbackErrorPage {
+		t.Errorf("got %d %q, want the fallback page", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+// Runtime stats published with expvar, for a quick look at a running server
+// without Prometheus.
+
+import (
+	"expvar"
+	"net/http"
+	"runtime"
+)
+
+// Counters served at /debug/vars, along with the memory stats and command line
+// expvar publishes itself.
+var (
+	requestsServed  = expvar.NewInt("requests_served")
+	templateRenders = expvar.NewInt("template_renders")
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+}
+
+// countRequests adds one to requests_served for every request to h.
+func countRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsServed.Add(1)
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpvar(t *testing.T) {
+	c := testConfig()
+	c.MetricsAllow = DefaultMetricsAllow
+	mux := NewServeMux(c)
+	get := func(mux http.Handler, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	if w := get(mux, "/debug/vars"); w.Code != 404 {
+		t.Errorf("disabled: got code %d, want 404", w.Code)
+	}
+
+	c.Expvar = true
+	mux = NewServeMux(c)
+	vars := func() map[string]interface{} {
+		w := get(mux, "/debug/vars")
+		if w.Code != 200 {
+			t.Fatalf("got code %d, want 200", w.Code)
+		}
+		v := make(map[string]interface{})
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	before := vars()
+	get(mux, "/")
+	get(mux, "/")
+	after := vars()
+	// The second request to /debug/vars counts too.
+	if got := after["requests_served"].(float64) - before["requests_served"].(float64); got != 3 {
+		t.Errorf("got %v more requests served, want 3", got)
+	}
+	if got := after["template_renders"].(float64) - before["template_renders"].(float64); got != 2 {
+		t.Errorf("got %v more template renders, want 2", got)
+	}
+	if n, ok := after["goroutines"].(float64); !ok || n < 1 {
+		t.Errorf("got goroutines %v, want at least 1", after["goroutines"])
+	}
+
+	req := httptest.NewRequest("GET", "/debug/vars", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Errorf("remote client: got code %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+// Feature flags, defined in the config.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"hash/fnv"
+)
+
+// A FlagSpec turns a feature flag on for everyone, or for a percentage of
+// clients:
+//
+//	flags:
+//	  new_nav:
+//	    enabled: true
+//	  new_checkout:
+//	    percent: 25
+//
+// A flag that isn't in the config is off.
+type FlagSpec struct {
+	Enabled bool `yaml:"enabled" json:"enabled" toml:"enabled"`
+	// Percent is the percentage of clients, from 0 to 100, the flag is on
+	// for, if Enabled is false. Each client always gets the same result for
+	// the same flag.
+	Percent float64 `yaml:"percent" json:"percent" toml:"percent"`
+}
+
+// on reports whether the flag is on for key.
+func (f FlagSpec) on(name, key string) bool {
+	if f.Enabled || f.Percent >= 100 {
+		return true
+	}
+	if f.Percent <= 0 {
+		return false
+	}
+	return flagBucket(name, key) < f.Percent*100
+}
+
+// flagBucket maps name and key to a number from 0 to 9999, the same every
+// time. The flag name is included so each flag rolls out to a different set
+// of clients.
+func flagBucket(name, key string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return float64(h.Sum32() % 10000)
+}
+
+// flagKeyField is the session key for the ID that percentage rollouts use.
+const flagKeyField = "_flag_key"
+
+// FlagEnabled reports whether the feature flag called name is on for the
+// client that made the request with ctx, in the current config. Reload the
+// config to change flags while the server is running.
+//
+// Percentage rollouts are keyed by a random ID stored in the client's
+// session, so a client keeps the same result from one request to the next;
+// without a session they're keyed by the client's IP address. To key them by
+// something else, like a user ID, use FlagEnabledFor.
+func FlagEnabled(ctx context.Context, name string) bool {
+	f, ok := flagSpec(name)
+	if !ok {
+		return false
+	}
+	// Only percentage rollouts need a key, so don't add one to the session
+	// for flags that are on or off for everyone.
+	if f.Enabled || f.Percent <= 0 || f.Percent >= 100 {
+		return f.on(name, "")
+	}
+	return f.on(name, flagKey(ctx))
+}
+
+// FlagEnabledFor reports whether the feature flag called name is on for key
+// in the current config.
+func FlagEnabledFor(name, key string) bool {
+	f, ok := flagSpec(name)
+	return ok && f.on(name, key)
+}
+
+// flagSpec returns the flag called name in the current config.
+func flagSpec(name string) (FlagSpec, bool) {
+	c := currentConfig()
+	if c == nil {
+		return FlagSpec{}, false
+	}
+	f, ok := c.Flags[name]
+	return f, ok
+}
+
+// flagKey returns the ID to key percentage rollouts by for the request with
+// ctx, adding one to the session if there isn't one yet.
+func flagKey(ctx context.Context) string {
+	if s := sessionFromContext(ctx); s != nil {
+		if key, ok := s[flagKeyField].(string); ok && key != "" {
+			return key
+		}
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err == nil {
+			key := hex.EncodeToString(b)
+			s[flagKeyField] = key
+			return key
+		}
+	}
+	if ip := ClientIP(ctx); ip != "" {
+		return ip
+	}
+	return RequestID(ctx)
+}
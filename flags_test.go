@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.Flags = map[string]FlagSpec{
+		"on":       {Enabled: true},
+		"off":      {},
+		"half":     {Percent: 50},
+		"everyone": {Percent: 100},
+	}
+	setLive(c, NewRandomKey())
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		if !FlagEnabledFor("on", key) {
+			t.Errorf("on: expected the flag to be on for %s", key)
+		}
+		if FlagEnabledFor("off", key) || FlagEnabledFor("missing", key) {
+			t.Errorf("off: expected the flag to be off for %s", key)
+		}
+		if !FlagEnabledFor("everyone", key) {
+			t.Errorf("100%%: expected the flag to be on for %s", key)
+		}
+	}
+
+	on := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		got := FlagEnabledFor("half", key)
+		for j := 0; j < 3; j++ {
+			if FlagEnabledFor("half", key) != got {
+				t.Fatalf("50%%: got a different result for %s", key)
+			}
+		}
+		if got {
+			on++
+		}
+	}
+	if on < 4500 || on > 5500 {
+		t.Errorf("50%%: flag was on for %d of 10000 keys, want about 5000", on)
+	}
+
+	// Reloading the config changes the flags.
+	reloaded := *c
+	reloaded.Flags = map[string]FlagSpec{"off": {Enabled: true}}
+	setLive(&reloaded, NewRandomKey())
+	if !FlagEnabledFor("off", "user-1") || FlagEnabledFor("on", "user-1") {
+		t.Error("expected the reloaded flags to be used")
+	}
+}
+
+func TestFlagEnabledSession(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.Flags = map[string]FlagSpec{"half": {Percent: 50}}
+	setLive(c, NewRandomKey())
+
+	var results []bool
+	h := withSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results = append(results, FlagEnabled(r.Context(), "half"))
+	}), nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("expected the flag key to be saved in the session")
+	}
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	for _, got := range results[1:] {
+		if got != results[0] {
+			t.Fatalf("got different results for the same session: %v", results)
+		}
+	}
+
+	if FlagEnabled(context.Background(), "missing") {
+		t.Error("expected a missing flag to be off")
+	}
+}
+
+func TestFlagEnabledNoSessionKey(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.Flags = map[string]FlagSpec{
+		"on":       {Enabled: true},
+		"off":      {},
+		"everyone": {Percent: 100},
+	}
+	setLive(c, NewRandomKey())
+
+	for _, name := range []string{"on", "off", "everyone", "missing"} {
+		h := withSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FlagEnabled(r.Context(), name)
+		}), nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if cookies := w.Result().Cookies(); len(cookies) != 0 {
+			t.Errorf("%s: expected no session cookie, got %v", name, cookies)
+		}
+	}
+}
@@ -2,8 +2,13 @@ package main
 
 // Helper functions for setting a flash message as a cookie, and then reading
 // that flash message in another request.
+//
+// AddFlash and GetFlashes queue any number of messages in the session instead;
+// pages show them with the flashes template function.
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"time"
 )
@@ -64,3 +69,69 @@ func clearCookie(w http.ResponseWriter, name string) {
 		Expires: time.Unix(1, 0),
 	})
 }
+
+// FlashLevel is the kind of a Flash message. Templates can use it as a CSS
+// class.
+type FlashLevel string
+
+// Levels for flash messages.
+const (
+	LevelInfo    FlashLevel = "info"
+	LevelSuccess FlashLevel = "success"
+	LevelWarning FlashLevel = "warning"
+	LevelError   FlashLevel = "error"
+)
+
+// A Flash is a message for the next page the user sees, like "Your changes
+// were saved".
+type Flash struct {
+	Level   FlashLevel `json:"level"`
+	Message string     `json:"message"`
+}
+
+// flashesKey is the session key for queued flash messages.
+const flashesKey = "_flashes"
+
+// AddFlash queues a message in the session for ctx. The message is shown on
+// the next page rendered for the client, usually after a redirect, and then
+// cleared. AddFlash does nothing if ctx has no session.
+func AddFlash(ctx context.Context, level FlashLevel, msg string) {
+	s := sessionFromContext(ctx)
+	if s == nil {
+		return
+	}
+	s[flashesKey] = append(sessionFlashes(s), Flash{Level: level, Message: msg})
+}
+
+// GetFlashes returns the messages queued in the session for ctx and removes
+// them from the session, so each message is only returned once.
+func GetFlashes(ctx context.Context) []Flash {
+	s := sessionFromContext(ctx)
+	if s == nil {
+		return nil
+	}
+	flashes := sessionFlashes(s)
+	delete(s, flashesKey)
+	return flashes
+}
+
+// sessionFlashes returns the flashes in s. Flashes read from a cookie are
+// decoded as generic JSON values, so they're converted back into Flash values.
+func sessionFlashes(s Session) []Flash {
+	switch v := s[flashesKey].(type) {
+	case nil:
+		return nil
+	case []Flash:
+		return v
+	default:
+		var flashes []Flash
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		if err := json.Unmarshal(b, &flashes); err != nil {
+			return nil
+		}
+		return flashes
+	}
+}
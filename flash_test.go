@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFlashSurvivesOneRedirect(t *testing.T) {
+	defer live.Store(getLive())
+	setLive(testConfig(), NewRandomKey())
+
+	pages, err := parseTemplates(memStore{
+		"templates/base.html": "",
+		"templates/page.html": `{{ range flashes $ }}[{{ .Level }} {{ .Message }}]{{ end }}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRouter()
+	r.Post("/save", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddFlash(r.Context(), LevelSuccess, "Saved")
+		AddFlash(r.Context(), LevelWarning, "Check your email")
+		http.Redirect(w, r, "/page", http.StatusFound)
+	}))
+	r.Get("/page", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, pages["page.html"], "page.html", nil)
+	}))
+	h := withSession(r, nil)
+
+	var cookies []*http.Cookie
+	do := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if c := w.Result().Cookies(); len(c) > 0 {
+			cookies = c
+		}
+		return w
+	}
+
+	if w := do("POST", "/save"); w.Code != http.StatusFound {
+		t.Fatalf("POST /save: got code %d, want 302", w.Code)
+	}
+	want := "[success Saved][warning Check your email]"
+	if body := do("GET", "/page").Body.String(); body != want {
+		t.Errorf("first GET: got %q, want %q", body, want)
+	}
+	if body := do("GET", "/page").Body.String(); strings.Contains(body, "Saved") {
+		t.Errorf("second GET: expected flashes to be cleared, got %q", body)
+	}
+}
+
+func TestGetFlashesNoSession(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	AddFlash(req.Context(), LevelInfo, "ignored")
+	if flashes := GetFlashes(req.Context()); flashes != nil {
+		t.Errorf("got %v, want no flashes without a session", flashes)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+// Security headers sent with every response.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultContentSecurityPolicy only lets pages load scripts, styles, images
+// and other resources from this server, and stops other sites from framing
+// them. Inline scripts and styles are blocked, unless they have the nonce from
+// CSPNonce.
+const DefaultContentSecurityPolicy = "default-src 'self'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+// DefaultHSTSMaxAge is how long browsers remember to only connect over HTTPS,
+// if no HSTSMaxAge is configured.
+const DefaultHSTSMaxAge = 365 * 24 * time.Hour
+
+// withSecurityHeaders sets headers that tell browsers to block content type
+// sniffing, framing and inline scripts, and to send less in the Referer
+// header. Inline scripts and styles can run if they have the request's nonce;
+// see CSPNonce. For requests over TLS it also sets Strict-Transport-Security, so
+// browsers stop making plain HTTP requests to the site. The policy and HSTS
+// max age come from the current config.
+func withSecurityHeaders(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		csp, maxAge := DefaultContentSecurityPolicy, DefaultHSTSMaxAge
+		if c := currentConfig(); c != nil {
+			if c.ContentSecurityPolicy != "" {
+				csp = c.ContentSecurityPolicy
+			}
+			if c.HSTSMaxAge.Duration > 0 {
+				maxAge = c.HSTSMaxAge.Duration
+			}
+		}
+		nonce := newCSPNonce()
+		csp = addCSPNonce(csp, nonce)
+		r = r.WithContext(context.WithValue(r.Context(), cspNonceKey, nonce))
+		hdr := w.Header()
+		hdr.Set("X-Content-Type-Options", "nosniff")
+		hdr.Set("X-Frame-Options", "DENY")
+		hdr.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		hdr.Set("Content-Security-Policy", csp)
+		// Browsers ignore HSTS over plain HTTP, and sending it from a server
+		// that isn't set up for HTTPS would lock users out.
+		if r.TLS != nil {
+			hdr.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(maxAge/time.Second)))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// CSPNonce returns the nonce for the request, which allows an inline script or
+// style to run under the Content-Security-Policy, for example:
+//
+//	<script nonce="{{ cspNonce $ }}">
+//
+// A new nonce is generated for every request.
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey).(string)
+	return nonce
+}
+
+// cspNonceRand is where nonces come from.
+var cspNonceRand io.Reader = rand.Reader
+
+// newCSPNonce returns a random nonce. It uses the URL-safe base64 alphabet,
+// since html/template escapes "+", "/" and "=" in attributes, and the nonce in
+// the page has to match the one in the header exactly.
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(cspNonceRand, b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// addCSPNonce allows scripts and styles with nonce in policy. If policy has no
+// script-src or style-src directive, one is added with the default-src
+// sources, since otherwise it would replace them.
+func addCSPNonce(policy, nonce string) string {
+	source := "'nonce-" + nonce + "'"
+	directives := strings.Split(policy, ";")
+	var defaultSrc []string
+	found := map[string]bool{}
+	for i, d := range directives {
+		fields := strings.Fields(d)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "default-src":
+			defaultSrc = fields[1:]
+		case "script-src", "style-src":
+			found[strings.ToLower(fields[0])] = true
+			// Browsers ignore 'unsafe-inline' if there's a nonce, so leave
+			// directives that allow every inline script alone.
+			if !strings.Contains(d, "'unsafe-inline'") {
+				directives[i] = strings.TrimRight(d, " ") + " " + source
+			}
+		}
+	}
+	if defaultSrc == nil {
+		// Inline scripts and styles are allowed unless there's a script-src
+		// or style-src.
+		return strings.Join(directives, ";")
+	}
+	for _, name := range []string{"script-src", "style-src"} {
+		if found[name] {
+			continue
+		}
+		sources := make([]string, 0, len(defaultSrc)+1)
+		for _, s := range defaultSrc {
+			// 'none' can't be combined with other sources.
+			if s != "'none'" {
+				sources = append(sources, s)
+			}
+		}
+		sources = append(sources, source)
+		directives = append(directives, " "+name+" "+strings.Join(sources, " "))
+	}
+	return strings.Join(directives, ";")
+}
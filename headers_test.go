@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.ContentSecurityPolicy = "default-src 'self' https://cdn.example.com"
+	c.HSTSMaxAge = Duration{time.Hour}
+	setLive(c, NewRandomKey())
+	h := withSecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	want := map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+		"Strict-Transport-Security": "max-age=3600",
+	}
+	for key, val := range want {
+		if got := w.Header().Get(key); got != val {
+			t.Errorf("got %s %q, want %q", key, got, val)
+		}
+	}
+	// The policy has the nonce for inline scripts added.
+	if got := w.Header().Get("Content-Security-Policy"); !strings.HasPrefix(got, c.ContentSecurityPolicy+"; script-src") {
+		t.Errorf("got Content-Security-Policy %q, want the configured policy", got)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("plain HTTP: got Strict-Transport-Security %q, want none", got)
+	}
+	if got := w.Header().Get("X-Frame-Options"); got != "DENY" {
+		t.Errorf("plain HTTP: got X-Frame-Options %q, want DENY", got)
+	}
+}
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	if err := c.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	setLive(c, NewRandomKey())
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	NewServeMux(c).ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Security-Policy"); !strings.HasPrefix(got, DefaultContentSecurityPolicy+";") {
+		t.Errorf("got Content-Security-Policy %q, want the default", got)
+	}
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Errorf("got Strict-Transport-Security %q, want a year", got)
+	}
+}
+
+func TestAddCSPNonce(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"default-src 'self'", "default-src 'self'; script-src 'self' 'nonce-abc'; style-src 'self' 'nonce-abc'"},
+		{"default-src 'none'; script-src https://cdn.example.com", "default-src 'none'; script-src https://cdn.example.com 'nonce-abc'; style-src 'nonce-abc'"},
+		{"script-src 'self' 'unsafe-inline'", "script-src 'self' 'unsafe-inline'"},
+		{"img-src *", "img-src *"},
+	}
+	for _, tt := range tests {
+		if got := addCSPNonce(tt.policy, "abc"); got != tt.want {
+			t.Errorf("addCSPNonce(%q): got %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestCSPNonceTemplate(t *testing.T) {
+	pages, err := parseTemplates(memStore{
+		"templates/base.html":   "",
+		"templates/script.html": `<script nonce="{{ cspNonce $ }}">alert(1)</script>`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := withSecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, pages["script.html"], "script.html", nil)
+	}))
+	var nonces []string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		m := regexp.MustCompile(`nonce="([^"]+)"`).FindStringSubmatch(w.Body.String())
+		if m == nil || len(m[1]) < 16 {
+			t.Fatalf("expected a nonce in the page, got %q", w.Body.String())
+		}
+		csp := w.Header().Get("Content-Security-Policy")
+		if !strings.Contains(csp, "script-src 'self' 'nonce-"+m[1]+"'") {
+			t.Errorf("the page's nonce %q isn't in the header %q", m[1], csp)
+		}
+		nonces = append(nonces, m[1])
+	}
+	if nonces[0] == nonces[1] {
+		t.Errorf("expected a different nonce for each request, got %q twice", nonces[0])
+	}
+}
+
+func TestCSPNonceEscaping(t *testing.T) {
+	defer func(r io.Reader) { cspNonceRand = r }(cspNonceRand)
+	// These bytes are "+/+/..." in the standard base64 alphabet, which
+	// html/template would escape in the page.
+	b := bytes.Repeat([]byte{0xfb, 0xef, 0xbf}, 6)
+	if std := base64.StdEncoding.EncodeToString(b); !strings.Contains(std, "+") || !strings.Contains(std, "/") {
+		t.Fatalf("test bytes encode to %q, want + and /", std)
+	}
+	cspNonceRand = bytes.NewReader(b)
+
+	pages, err := parseTemplates(memStore{
+		"templates/base.html":   "",
+		"templates/script.html": `<script nonce="{{ cspNonce $ }}">alert(1)</script>`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := withSecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, pages["script.html"], "script.html", nil)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	m := regexp.MustCompile(`nonce="([^"]+)"`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("expected a nonce in the page, got %q", w.Body.String())
+	}
+	csp := w.Header().Get("Content-Security-Policy")
+	if !strings.Contains(csp, "'nonce-"+m[1]+"'") {
+		t.Errorf("the page's nonce %q doesn't match the header %q", m[1], csp)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+// Health checks for load balancers and container orchestrators.
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinburke/handlers"
+)
+
+// healthz reports that the server is up. It does no other work, so it's cheap
+// enough to call every few seconds.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(`{"status":"ok"}` + "\n"))
+}
+
+// A ReadyCheck returns an error if the server isn't ready to serve traffic,
+// for example because a database can't be reached. It should return before
+// ctx is done.
+type ReadyCheck func(ctx context.Context) error
+
+// readyTimeout limits how long /readyz waits for all the checks to finish.
+const readyTimeout = 5 * time.Second
+
+type namedCheck struct {
+	name  string
+	check ReadyCheck
+}
+
+// readyRegistry holds the checks run by /readyz.
+type readyRegistry struct {
+	mu     sync.Mutex
+	checks []namedCheck
+}
+
+func (rr *readyRegistry) add(name string, check ReadyCheck) {
+	rr.mu.Lock()
+	rr.checks = append(rr.checks, namedCheck{name, check})
+	rr.mu.Unlock()
+}
+
+func (rr *readyRegistry) all() []namedCheck {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return append([]namedCheck(nil), rr.checks...)
+}
+
+var readyChecks = new(readyRegistry)
+
+// AddReadyCheck registers a check that must pass for /readyz to report the
+// server as ready. name identifies the check in the response if it fails.
+func AddReadyCheck(name string, check ReadyCheck) {
+	readyChecks.add(name, check)
+}
+
+// readyz runs the builtin checks and the checks in rr, and responds with 200
+// if they all pass, or 503 and the names of the checks that failed. Errors are
+// logged rather than returned, since they may include details about the
+// server's internals.
+func readyz(rr *readyRegistry, builtin ...namedCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		failed := []string{}
+		checks := append(append([]namedCheck(nil), builtin...), rr.all()...)
+		for _, c := range checks {
+			if err := c.check(ctx); err != nil {
+				LoggerFrom(r.Context()).Warn("Readiness check failed", "check", c.name, "err", err)
+				failed = append(failed, c.name)
+			}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if len(failed) > 0 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "unavailable", "failed": failed})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// probePaths are requested every few seconds by health checkers and
+// Prometheus.
+var probePaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// DefaultUnloggedPaths are left out of the access log if no UnloggedPaths are
+// configured, since logging them would drown out everything else.
+var DefaultUnloggedPaths = []string{"/healthz", "/readyz", "/metrics"}
+
+// unlogged reports whether path is one of the prefixes in the current
+// config's UnloggedPaths, or below one of them. "/healthz" matches
+// "/healthz/db" but not "/healthzz".
+func unlogged(path string) bool {
+	prefixes := DefaultUnloggedPaths
+	if c := currentConfig(); c != nil && c.UnloggedPaths != nil {
+		prefixes = c.UnloggedPaths
+	}
+	for _, prefix := range prefixes {
+		if hasPathPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPathPrefix reports whether path is prefix or a path below it. "/admin"
+// matches "/admin" and "/admin/users" but not "/administrator".
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// logRequests logs requests and responses with handlers.Log, except for
+// requests to the unlogged paths, which are only logged at debug level.
+func logRequests(h http.Handler) http.Handler {
+	logged := handlers.Log(h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unlogged(r.URL.Path) {
+			LoggerFrom(r.Context()).Debug("Request", "method", r.Method, "path", r.URL.Path)
+			h.ServeHTTP(w, r)
+			return
+		}
+		logged.ServeHTTP(w, r)
+	})
+}
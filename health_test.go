@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kevinburke/handlers"
+)
+
+func TestHealthz(t *testing.T) {
+	mux := NewServeMux(testConfig())
+	for _, method := range []string{"GET", "HEAD"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, "/healthz", nil))
+		if w.Code != 200 {
+			t.Errorf("%s /healthz: got code %d, want 200", method, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("%s /healthz: got Content-Type %q", method, ct)
+		}
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if body := w.Body.String(); body != `{"status":"ok"}`+"\n" {
+		t.Errorf("GET /healthz: got body %q", body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	rr := new(readyRegistry)
+	h := readyz(rr, namedCheck{"builtin", func(context.Context) error { return nil }})
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w
+	}
+
+	rr.add("database", func(context.Context) error { return nil })
+	if w := get(); w.Code != 200 || w.Body.String() != `{"status":"ok"}`+"\n" {
+		t.Errorf("all passing: got %d %q, want 200", w.Code, w.Body.String())
+	}
+
+	rr.add("cache", func(context.Context) error { return errors.New("connection refused") })
+	rr.add("queue", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("expected a deadline")
+		}
+		return nil
+	})
+	w := get()
+	if w.Code != 503 {
+		t.Errorf("one failing: got code %d, want 503", w.Code)
+	}
+	var body struct {
+		Status string
+		Failed []string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != "unavailable" || !reflect.DeepEqual(body.Failed, []string{"cache"}) {
+		t.Errorf("one failing: got %+v", body)
+	}
+	if strings.Contains(w.Body.String(), "refused") {
+		t.Errorf("expected errors not to be returned, got %q", w.Body.String())
+	}
+}
+
+func TestReadyzRoute(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewServeMux(testConfig()).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != 200 {
+		t.Errorf("GET /readyz: got code %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+}
+
+func TestLogRequestsSkipsProbes(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.UnloggedPaths = DefaultUnloggedPaths
+	setLive(c, NewRandomKey())
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	buf := new(bytes.Buffer)
+	setLogFormat(handlers.Logger, "logfmt", buf)
+
+	mux := logRequests(NewServeMux(c))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	if buf.Len() != 0 {
+		t.Errorf("GET /healthz: got log output %q, want none", buf.String())
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(buf.String(), "path=/ ") {
+		t.Errorf("GET /: got log output %q, want the request logged", buf.String())
+	}
+}
+
+func TestUnlogged(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.UnloggedPaths = []string{"/healthz", "/internal/"}
+	setLive(c, NewRandomKey())
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/healthz", true},
+		{"/healthz/db", true},
+		{"/healthzz", false},
+		{"/healthz-secret", false},
+		{"/internal/", true},
+		{"/internal/jobs", true},
+		{"/internal", false},
+		{"/", false},
+	}
+	for _, tt := range tests {
+		if got := unlogged(tt.path); got != tt.want {
+			t.Errorf("unlogged(%q): got %t, want %t", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+// Helpers for JSON responses.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/kevinburke/rest"
+)
+
+// writeJSON writes v as JSON with the given status code. If v can't be
+// encoded, the error is logged and the client gets a 500 instead.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("Could not encode JSON response", "err", err)
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
+
+// writeError writes an error with the given status code and message, in the
+// same format as the errors from the rest package:
+//
+//	{"title": "Too many requests", "id": "too_many_requests", "status": 429}
+//
+// To set a more specific ID, or the instance, call writeJSON with a
+// *rest.Error instead.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, &rest.Error{
+		Title:  msg,
+		ID:     statusID(status),
+		Status: status,
+	})
+}
+
+// statusID turns the text for status into an error ID, like "not_found".
+func statusID(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeJSON(w, 201, map[string]string{"name": "gopher"})
+	if w.Code != 201 {
+		t.Errorf("got code %d, want 201", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("got Content-Type %q, want JSON", ct)
+	}
+	if got := w.Body.String(); got != `{"name":"gopher"}`+"\n" {
+		t.Errorf("got body %q", got)
+	}
+}
+
+func TestWriteJSONEncodeError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeJSON(w, 200, math.Inf(1))
+	if w.Code != 500 {
+		t.Errorf("got code %d, want 500", w.Code)
+	}
+	want := `{"title":"Internal server error","id":"internal_server_error","status":500}` + "\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeError(w, 429, "Slow down")
+	if w.Code != 429 {
+		t.Errorf("got code %d, want 429", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("got Content-Type %q, want JSON", ct)
+	}
+	want := `{"title":"Slow down","id":"too_many_requests","status":429}` + "\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+}
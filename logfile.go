@@ -0,0 +1,137 @@
+package main
+
+// Writing logs to a file, with rotation.
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+const (
+	// DefaultLogMaxSize is the size in megabytes at which the log file is
+	// rotated, if no LogMaxSize is configured.
+	DefaultLogMaxSize = 100
+	// DefaultLogMaxBackups is the number of rotated log files to keep, if no
+	// LogMaxBackups is configured.
+	DefaultLogMaxBackups = 5
+)
+
+// logFile is a log file that's rotated when it gets too big: "app.log" is
+// renamed to "app.log.1", "app.log.1" to "app.log.2" and so on, and the oldest
+// backup is removed. It's safe for concurrent use.
+type logFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// openLogFile opens the log file at path for appending, creating it if it
+// doesn't exist. It's rotated when it would grow past maxSize bytes.
+func openLogFile(path string, maxSize int64, maxBackups int) (*logFile, error) {
+	lf := &logFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// open opens the file at lf.path and switches writes to it. The old file is
+// only closed once the new one is open, so if open fails, writes keep going to
+// the old file.
+func (lf *logFile) open() error {
+	f, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	old := lf.f
+	lf.f = f
+	lf.size = fi.Size()
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.size > 0 && lf.size+int64(len(p)) > lf.maxSize {
+		if err := lf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file to the first backup and opens a new one.
+func (lf *logFile) rotate() error {
+	backup := func(i int) string { return lf.path + "." + strconv.Itoa(i) }
+	os.Remove(backup(lf.maxBackups))
+	for i := lf.maxBackups - 1; i >= 1; i-- {
+		os.Rename(backup(i), backup(i+1))
+	}
+	if lf.maxBackups > 0 {
+		if err := os.Rename(lf.path, backup(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(lf.path); err != nil {
+		return err
+	}
+	return lf.open()
+}
+
+// Reopen closes and reopens the file, so logs go to a new file after a tool
+// like logrotate has moved the old one.
+func (lf *logFile) Reopen() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.open()
+}
+
+func (lf *logFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.f.Close()
+}
+
+// logFileFor opens the log file configured in c.
+func logFileFor(c *FileConfig) (*logFile, error) {
+	maxBackups := DefaultLogMaxBackups
+	if c.LogMaxBackups != nil {
+		maxBackups = *c.LogMaxBackups
+	}
+	lf, err := openLogFile(c.LogFile, int64(c.LogMaxSize)<<20, maxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("opening log file: %v", err)
+	}
+	return lf, nil
+}
+
+// reopenOnSIGHUP reopens lf every time the process receives SIGHUP.
+func reopenOnSIGHUP(lf *logFile) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := lf.Reopen(); err != nil {
+				// Write to stderr, since the log file is what's broken.
+				fmt.Fprintf(os.Stderr, "Couldn't reopen log file %s: %v\n", lf.path, err)
+			}
+		}
+	}()
+}
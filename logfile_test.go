@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/handlers"
+)
+
+func TestLogFileRequests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := testConfig()
+	c.LogFile = filepath.Join(dir, "app.log")
+	c.LogMaxSize = DefaultLogMaxSize
+	lf, err := logFileFor(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	setLogFormat(handlers.Logger, "logfmt", lf)
+
+	mux := logRequests(NewServeMux(c))
+	for _, path := range []string{"/", "/missing", "/robots.txt"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	data, err := ioutil.ReadFile(c.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(lines), data)
+	}
+	for i, want := range []string{"path=/ ", "path=/missing", "path=/robots.txt"} {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("line %d: got %q, want it to contain %q", i, lines[i], want)
+		}
+	}
+}
+
+func TestLogFileRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	lf, err := openLogFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := lf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for file, body := range want {
+		if data, err := ioutil.ReadFile(file); err != nil || string(data) != body {
+			t.Errorf("%s: got %q, %v, want %q", file, data, err, body)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups, got %v", err)
+	}
+}
+
+func TestLogFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	lf, err := openLogFile(path, 1<<20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	l := log.New()
+	setLogFormat(l, "json", lf)
+	l.Info("before")
+	// Like logrotate: move the file, then tell the server.
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("after")
+	if data, _ := ioutil.ReadFile(path + ".old"); !strings.Contains(string(data), `"msg":"before"`) {
+		t.Errorf("old file: got %q", data)
+	}
+	if data, _ := ioutil.ReadFile(path); !strings.Contains(string(data), `"msg":"after"`) || strings.Contains(string(data), "before") {
+		t.Errorf("new file: got %q", data)
+	}
+}
+
+func TestLogFileReopenFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	lf, err := openLogFile(filepath.Join(dir, "logs", "app.log"), 1<<20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	// With the directory gone, the file can't be opened again.
+	if err := os.RemoveAll(filepath.Join(dir, "logs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.Reopen(); err == nil {
+		t.Fatal("expected an error reopening the file")
+	}
+	if _, err := lf.Write([]byte("still logging\n")); err != nil {
+		t.Errorf("write after a failed reopen: %v", err)
+	}
+}
+
+func TestLogFileNoBackups(t *testing.T) {
+	c := new(FileConfig)
+	data := []byte("http_only: true\nlog_max_backups: 0\nsecret_key: " + testSecretKey)
+	if err := parseConfig("config.yml", data, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if *c.LogMaxBackups != 0 {
+		t.Fatalf("LogMaxBackups: got %d, want 0", *c.LogMaxBackups)
+	}
+
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	lf, err := openLogFile(path, 10, *c.LogMaxBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := lf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "second\n" {
+		t.Errorf("%s: got %q, %v, want %q", path, data, err, "second\n")
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("expected no backups, got %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+// Log output formats.
+
+import (
+	"io"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// setLogFormat switches l to write lines in format to w. "json" writes one
+// JSON object per line; "logfmt" or the empty string writes logfmt.
+func setLogFormat(l log.Logger, format string, w io.Writer) {
+	f := log.LogfmtFormat()
+	if format == "json" {
+		f = log.JsonFormat()
+	}
+	l.SetHandler(log.LvlFilterHandler(log.LvlInfo, log.StreamHandler(w, f)))
+}
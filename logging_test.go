@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/handlers"
+)
+
+func TestJSONLogFormat(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := log.New()
+	setLogFormat(l, "json", buf)
+	l.Info("Started server", "addr", "127.0.0.1:7065")
+	l.Debug("not logged")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %q", len(lines), buf.String())
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatalf("log line is not JSON: %v: %q", err, lines[0])
+	}
+	if m["msg"] != "Started server" || m["addr"] != "127.0.0.1:7065" || m["lvl"] != "info" {
+		t.Errorf("got %v", m)
+	}
+}
+
+func TestJSONRequestLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	old := logger.GetHandler()
+	defer logger.SetHandler(old)
+	setLogFormat(logger, "json", buf)
+
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LoggerFrom(r.Context()).Warn("something happened")
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("log line is not JSON: %v: %q", err, buf.String())
+	}
+	if m["request_id"] != "req-1" || m["msg"] != "something happened" {
+		t.Errorf("got %v", m)
+	}
+}
+
+func TestLogfmtIsDefault(t *testing.T) {
+	for _, format := range []string{"", "logfmt"} {
+		buf := new(bytes.Buffer)
+		l := log.New()
+		setLogFormat(l, format, buf)
+		l.Info("Started server", "addr", "127.0.0.1:7065")
+		if out := buf.String(); !strings.Contains(out, `lvl=info msg="Started server" addr=127.0.0.1:7065`) {
+			t.Errorf("format %q: got %q, want logfmt", format, out)
+		}
+	}
+}
+
+func TestLoggedConfigRedactsSecrets(t *testing.T) {
+	c := testConfig()
+	c.SecretKeys = []string{strings.Repeat("cd", 32)}
+	c.PprofPassword = "hunter2"
+	c.KeyFile = "/etc/ssl/private/example.key"
+	secrets := []string{c.SecretKey, c.SecretKeys[0], c.PprofPassword, c.KeyFile}
+	for _, format := range []string{"logfmt", "json"} {
+		buf := new(bytes.Buffer)
+		l := log.New()
+		setLogFormat(l, format, buf)
+		l.Info("Loaded config", "config", c, "value", *c)
+		for _, secret := range secrets {
+			if strings.Contains(buf.String(), secret) {
+				t.Errorf("%s: log output contains %q: %s", format, secret, buf.String())
+			}
+		}
+		if !strings.Contains(buf.String(), "http_only") {
+			t.Errorf("%s: expected the rest of the config in the output: %s", format, buf.String())
+		}
+	}
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s"} {
+		out := fmt.Sprintf(verb, c)
+		for _, secret := range secrets {
+			if strings.Contains(out, secret) {
+				t.Errorf("%s: output contains %q: %s", verb, secret, out)
+			}
+		}
+	}
+}
+
+func TestAccessLogOmitsAuthorization(t *testing.T) {
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	buf := new(bytes.Buffer)
+	setLogFormat(handlers.Logger, "logfmt", buf)
+
+	mux := logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("admin", "hunter2")
+	basic := req.Header.Get("Authorization")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer s3cr3t-t0k3n")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, secret := range []string{"hunter2", basic, "s3cr3t-t0k3n"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("access log contains %q: %s", secret, buf.String())
+		}
+	}
+	if strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("expected 2 access log lines, got %q", buf.String())
+	}
+}
@@ -1,30 +1,29 @@
 // go-html-boilerplate loads configuration from a file and starts a HTTP server
 // that can render HTML templates and static assets.
 //
-// See config.yml for an explanation of the configuration options for the
-// server, and the Makefile for various tasks you can run in coordination with
+// See FileConfig in config.go for an explanation of the configuration options
+// for the server, and the Makefile for various tasks you can run in coordination with
 // the server (run tests, build assets, start the server).
 package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"expvar"
 	"flag"
+	"fmt"
 	"html/template"
-	"io/ioutil"
-	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
-	"strconv"
-	"strings"
+	"syscall"
 	"time"
 
 	log "github.com/inconshreveable/log15"
-	"github.com/kevinburke/go-html-boilerplate/assets"
 	"github.com/kevinburke/handlers"
 	"github.com/kevinburke/rest"
-	yaml "gopkg.in/yaml.v2"
 )
 
 // DefaultPort is the listening port if no other port is specified.
@@ -34,168 +33,255 @@ var DefaultPort = 7065
 const Version = "0.1"
 
 var errWrongLength = errors.New("Secret key has wrong length. Should be a 64-byte hex string")
-var homepageTpl *template.Template
+
+// templates are the pages in the templates folder, keyed by their path in the
+// folder, like "index.html".
+var templates map[string]*template.Template
 var logger log.Logger
 
 func init() {
-	homepageHTML := assets.MustAssetString("templates/index.html")
-	homepageTpl = template.Must(template.New("homepage").Parse(homepageHTML))
 	logger = handlers.Logger
-
-	// Add more templates here.
+	// Templates are cloned with the functions for the real routes and assets
+	// in NewServeMux; these are placeholders so the templates parse.
+	var err error
+	templates, err = parseTemplates(embedded{}, newRouter().templateFuncs(), new(static).templateFuncs())
+	if err != nil {
+		logger.Error("Couldn't parse templates", "err", err)
+		os.Exit(2)
+	}
 }
 
-// A HTTP server for static files. All assets are packaged up in the assets
-// directory with the go-bindata binary. Run "make assets" to rerun the
-// go-bindata binary.
-type static struct {
-	modTime time.Time
+// Render a template, or a server error. The output is minified if the
+// current config enables MinifyHTML.
+func render(w http.ResponseWriter, r *http.Request, tpl *template.Template, name string, data interface{}) {
+	renderStatus(w, r, tpl, name, http.StatusOK, data)
 }
 
-func (s *static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path == "/favicon.ico" {
-		r.URL.Path = "/static/favicon.ico"
-	}
-	bits, err := assets.Asset(strings.TrimPrefix(r.URL.Path, "/"))
+// renderStatus is like render, but responds with the given status code. The
+// template is rendered before anything is written, so if it fails the
+// response is a 500 instead of a partial page.
+func renderStatus(w http.ResponseWriter, r *http.Request, tpl *template.Template, name string, code int, data interface{}) {
+	out, err := executePage(r, tpl, name, data)
 	if err != nil {
-		rest.NotFound(w, r)
+		rest.ServerError(w, r, err)
 		return
 	}
-	http.ServeContent(w, r, r.URL.Path, s.modTime, bytes.NewReader(bits))
+	w.WriteHeader(code)
+	w.Write(out)
 }
 
-// Render a template, or a server error.
-func render(w http.ResponseWriter, r *http.Request, tpl *template.Template, name string, data interface{}) {
+// executePage renders the named template for r, minifying the output if the
+// current config enables MinifyHTML.
+func executePage(r *http.Request, tpl *template.Template, name string, data interface{}) ([]byte, error) {
 	buf := new(bytes.Buffer)
-	if err := tpl.ExecuteTemplate(buf, name, data); err != nil {
-		rest.ServerError(w, r, err)
-		return
+	templateRenders.Add(1)
+	if err := tpl.ExecuteTemplate(buf, name, Page{Data: data, ctx: r.Context()}); err != nil {
+		return nil, err
+	}
+	out := buf.Bytes()
+	if c := currentConfig(); c != nil && c.MinifyHTML && !c.Dev {
+		out = minifyHTML(out)
 	}
-	w.Write(buf.Bytes())
+	return out, nil
 }
 
 // NewServeMux returns a HTTP handler that covers all routes known to the
-// server.
-func NewServeMux() http.Handler {
-	staticServer := &static{
-		modTime: time.Now().UTC(),
+// server. Call setupConfig on c first to apply defaults.
+//
+// If c.Dev is set, static files and templates are read from c.DevDir for
+// every request instead of from the assets package, so changes show up
+// without rebuilding the server.
+func NewServeMux(c *FileConfig) http.Handler {
+	var store assetStore = embedded{}
+	if c.Dev {
+		store = diskStore(c.DevDir)
+	}
+	staticPrefix := c.staticPrefix()
+	newStaticServer := func(maxAge time.Duration) *static {
+		s := newStatic(store, time.Now().UTC(), maxAge)
+		s.prefix = staticPrefix
+		return s
+	}
+	staticServer := newStaticServer(c.StaticCacheMaxAge.Duration)
+	// currentStatic returns the static server to use for a request.
+	currentStatic := func() *static { return staticServer }
+	if c.Dev {
+		currentStatic = func() *static { return newStaticServer(0) }
 	}
 
-	r := new(handlers.Regexp)
-	r.Handle(regexp.MustCompile(`(^/static|^/favicon.ico$)`), []string{"GET"}, handlers.GZip(staticServer))
-	r.HandleFunc(regexp.MustCompile(`^/$`), []string{"GET"}, func(w http.ResponseWriter, r *http.Request) {
-		push(w, "/static/style.css", "style")
+	r := newRouter()
+	routeFuncs := r.templateFuncs()
+	// Cloning only fails if the templates have been executed, and templates
+	// never are.
+	parsed, err := cloneTemplates(templates, routeFuncs, staticServer.templateFuncs())
+	if err != nil {
+		panic(err)
+	}
+	pages := &templateLoader{store: store, dev: c.Dev, parsed: parsed}
+	m := newMetrics()
+	// Validate has already checked the networks.
+	metricsAllow, _ := parseNetworks(c.MetricsAllow)
+	r.Get(`(^`+regexp.QuoteMeta(staticPrefix)+`|^/favicon.ico$)`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		currentStatic().ServeHTTP(w, r)
+	}))
+	for _, d := range c.StaticDirs {
+		r.Get(`^`+regexp.QuoteMeta(d.Prefix), d.handler())
+	}
+	homepage := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := currentStatic()
+		tpls, err := pages.load(routeFuncs, s.templateFuncs())
+		if err != nil {
+			renderDevError(w, err)
+			return
+		}
+		styleURL, _ := s.URL("style.css")
+		earlyHints(w, r, preloadLink(styleURL, "style"))
+		push(w, r, styleURL, "style")
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		render(w, r, homepageTpl, "homepage", nil)
+		render(w, r, tpls["index.html"], "index.html", nil)
 	})
-	// Add more routes here. Routes not matched will get a 404 error page.
-	// Call rest.RegisterHandler(404, http.HandlerFunc) to provide your own 404
-	// page instead of the default.
-	return r
-}
+	r.Get("/", homepage).Name("homepage").Sitemap("daily", 1)
+	r.Get("/robots.txt", robotsTxt(c.RobotsTxt, c.StaticCacheMaxAge.Duration, currentStatic))
+	r.Get("/manifest.webmanifest", webManifest(c.WebManifest, c.StaticCacheMaxAge.Duration, currentStatic))
+	r.Get("/service-worker.js", serviceWorker(currentStatic))
+	// Call Sitemap on a route to list it here.
+	r.Get("/sitemap.xml", r.sitemapHandler())
+	// Liveness and readiness probes for load balancers; requests to them
+	// aren't logged. Call AddReadyCheck to add your own readiness checks.
+	r.Get("/healthz", http.HandlerFunc(healthz))
+	r.Get("/version", http.HandlerFunc(versionHandler))
+	r.Get("/readyz", readyz(readyChecks, namedCheck{"templates", func(context.Context) error {
+		_, err := pages.load(routeFuncs, currentStatic().templateFuncs())
+		return err
+	}}))
+	// adminAuth requires the admin_user credentials, and rejects every request
+	// if they aren't set. Use it for internal tools, for example with
+	// r.Group("/admin", adminAuth).
+	adminAuth := requireBasicAuth("admin", c.AdminUser, []byte(c.AdminPasswordHash))
+	metricsHandler := m.handler(metricsAllow)
+	if c.AdminUser != "" {
+		metricsHandler = adminAuth(metricsHandler)
+	}
+	r.Get("/metrics", metricsHandler)
+	if c.Pprof {
+		h := pprofHandler(c.PprofPassword)
+		if c.AdminUser != "" {
+			h = adminAuth(h)
+		}
+		r.Get(`^/debug/pprof/`, h)
+	}
+	if c.Expvar {
+		// Like /metrics, only clients in metrics_allow can see these.
+		h := allowOnly(metricsAllow, expvar.Handler())
+		if c.AdminUser != "" {
+			h = adminAuth(h)
+		}
+		r.Get(`^/debug/vars$`, h)
+	}
+	if c.WebSocketEcho {
+		r.Get(`^/ws/echo$`, webSocketHandler(echoWebSocket))
+	}
+	switch {
+	case !c.DebugConfig:
+	case c.AdminUser != "":
+		r.Get(`^/debug/config$`, adminAuth(http.HandlerFunc(debugConfigHandler)))
+	case c.Dev:
+		r.Get(`^/debug/config$`, http.HandlerFunc(debugConfigHandler))
+	default:
+		logger.Warn("Not serving /debug/config; it needs admin_user or dev mode")
+	}
+	// Add more routes here with r.Get, r.Post, r.Put and r.Delete. Name a
+	// route to build its path in templates with {{ url "name" }}.
 
-// FileConfig represents the data in a config file.
-type FileConfig struct {
-	// SecretKey is used to encrypt sessions and other data before serving it to
-	// the client. It should be a hex string that's exactly 64 bytes long. For
-	// example:
-	//
-	//   d7211b215341871968869dontusethisc0ff1789fc88e0ac6e296ba36703edf8
-	//
-	// That key is invalid - you can generate a random key by running:
-	//
-	//   openssl rand -hex 32
-	//
-	// If no secret key is present, we'll generate one when the server starts.
-	// However, this means that sessions may error when the server restarts.
-	//
-	// If a server key is present, but invalid, the server will not start.
-	SecretKey string `yaml:"secret_key"`
-
-	// Port to listen on. Set to 0 to choose a port at random. If unspecified,
-	// defaults to 7065.
-	Port *int `yaml:"port"`
-
-	// Set to true to listen for HTTP traffic (instead of TLS traffic). Note
-	// you need to terminate TLS to use HTTP server push.
-	HTTPOnly bool `yaml:"http_only"`
-
-	// For TLS configuration.
-	CertFile string `yaml:"cert_file"`
-	KeyFile  string `yaml:"key_file"`
-
-	// Add other configuration settings here.
+	// Routes not matched and missing static files get the 404.html page, or a
+	// JSON error for clients that don't want HTML. rest.NotFound uses the
+	// handler registered by the last call to NewServeMux.
+	loadPages := func() (map[string]*template.Template, error) {
+		return pages.load(routeFuncs, currentStatic().templateFuncs())
+	}
+	rest.RegisterHandler(http.StatusNotFound, notFoundHandler(loadPages))
+	// With spa_fallback on, other GET requests get the single-page app.
+	r.Fallback(spaFallback(loadPages, homepage))
+	// Server errors and panics get the 500.html page, or the error itself in
+	// dev mode.
+	errPage := &errorPage{load: loadPages, dev: c.Dev}
+	rest.RegisterHandler(http.StatusInternalServerError, serverErrorHandler(errPage))
+	return m.instrument(countRequests(withRecover(withSecurityHeaders(withGzip(withMaintenance(r, loadPages))), errPage)))
 }
 
-var cfg = flag.String("config", "config.yml", "Path to a config file")
+var cfg = flag.String("config", "config.yml", "Path to a config file (.yml, .yaml, .json or .toml)")
+var initConfig = flag.Bool("init", false, "Write a default config file to the -config path and exit")
+var force = flag.Bool("force", false, "Overwrite an existing config file when used with -init")
+var dev = flag.Bool("dev", false, "Read static files and templates from disk for every request (see dev_dir)")
+var checkOnly = flag.Bool("check", false, "Check the config file, certificates and templates for problems and exit, without starting the server")
+var printVersion = flag.Bool("version", false, "Print the version, commit and build date and exit, without reading the config")
 
 func main() {
 	flag.Parse()
-	data, err := ioutil.ReadFile(*cfg)
-	c := new(FileConfig)
-	if err == nil {
-		if err := yaml.Unmarshal(data, c); err != nil {
-			logger.Error("Couldn't parse config file", "err", err)
+	if *printVersion {
+		fmt.Println(getBuildInfo())
+		return
+	}
+	if *checkOnly {
+		errs := checkConfig(*cfg, *dev)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *cfg, err)
+		}
+		if len(errs) > 0 {
+			fmt.Fprintf(os.Stderr, "%s: found %d problem(s)\n", *cfg, len(errs))
+			os.Exit(1)
+		}
+		fmt.Printf("%s: OK\n", *cfg)
+		return
+	}
+	if *initConfig {
+		if err := writeDefaultConfig(*cfg, *force); err != nil {
+			logger.Error("Couldn't write config file", "file", *cfg, "err", err)
 			os.Exit(2)
 		}
-	} else {
-		logger.Error("Couldn't find config file", "err", err)
-		os.Exit(2)
+		logger.Info("Wrote config file", "file", *cfg)
+		return
 	}
-	key, err := getSecretKey(c.SecretKey)
+	c, err := loadConfig(*cfg)
 	if err != nil {
-		logger.Error("Error getting secret key", "err", err)
+		logger.Error("Couldn't load config", "file", *cfg, "err", err)
 		os.Exit(2)
 	}
-	// You can use the secret key with secretbox
-	// (godoc.org/golang.org/x/crypto/nacl/secretbox/) to generate cookies and
-	// secrets. See flash.go and crypto.go for examples.
-	_ = key
-
-	if c.Port == nil {
-		port, ok := os.LookupEnv("PORT")
-		if ok {
-			iPort, err := strconv.Atoi(port)
-			if err != nil {
-				logger.Error("Invalid port", "err", err, "port", port)
-				os.Exit(2)
-			}
-			c.Port = &iPort
-		} else {
-			c.Port = &DefaultPort
-		}
+	if *dev {
+		c.Dev = true
+	}
+	s, err := New(c)
+	if err != nil {
+		logger.Error("Couldn't start server", "file", *cfg, "err", err)
+		os.Exit(2)
 	}
-	mux := NewServeMux()
-	mux = handlers.UUID(mux)                                   // add UUID header
-	mux = handlers.Server(mux, "go-html-boilerplate/"+Version) // add Server header
-	mux = handlers.Log(mux)                                    // log requests/responses
-	mux = handlers.Duration(mux)                               // add Duration header
-	addr := ":" + strconv.Itoa(*c.Port)
-	if c.HTTPOnly {
-		ln, err := net.Listen("tcp", addr)
+	// FileConfig.String redacts the secrets.
+	logger.Debug("Loaded config", "file", *cfg, "config", c)
+	// logger is also handlers.Logger, so this changes the access logs too.
+	if c.LogFile != "" {
+		lf, err := logFileFor(c)
 		if err != nil {
-			logger.Error("Error listening", "addr", addr, "err", err)
-			os.Exit(2)
-		}
-		logger.Info("Started server", "port", *c.Port)
-		http.Serve(ln, mux)
-	} else {
-		if c.CertFile == "" {
-			c.CertFile = "cert.pem"
-		}
-		if _, err := os.Stat(c.CertFile); os.IsNotExist(err) {
-			logger.Error("Could not find a cert file; generate using 'make generate_cert'", "file", c.CertFile)
-			os.Exit(2)
-		}
-		if c.KeyFile == "" {
-			c.KeyFile = "key.pem"
-		}
-		if _, err := os.Stat(c.KeyFile); os.IsNotExist(err) {
-			logger.Error("Could not find a key file; generate using 'make generate_cert'", "file", c.KeyFile)
+			logger.Error("Couldn't start server", "file", *cfg, "err", err)
 			os.Exit(2)
 		}
-		logger.Info("Starting server", "port", *c.Port)
-		listenErr := http.ListenAndServeTLS(addr, c.CertFile, c.KeyFile, mux)
-		logger.Error("server shut down", "err", listenErr)
+		defer lf.Close()
+		setLogFormat(logger, c.LogFormat, lf)
+		reopenOnSIGHUP(lf)
+	} else if c.LogFormat == "json" {
+		// Otherwise keep the default handler, which writes logfmt, or
+		// colored output to a terminal.
+		setLogFormat(logger, c.LogFormat, os.Stdout)
+	}
+	stopReload := reloadOnSIGHUP(*cfg)
+	defer stopReload()
+
+	// On SIGINT or SIGTERM, stop accepting connections and let requests in
+	// flight finish.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := s.Run(ctx); err != nil {
+		logger.Error("server shut down", "err", err)
+		os.Exit(1)
 	}
+	logger.Info("server shut down")
 }
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 )
 
 func TestServer(t *testing.T) {
-	mux := NewServeMux()
+	mux := NewServeMux(testConfig())
 	req := httptest.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, req)
@@ -22,8 +29,77 @@ func TestServer(t *testing.T) {
 	}
 }
 
+// setenv sets key to value and returns a func that restores the old value.
+func setenv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// unsetenv unsets key and returns a func that restores the old value.
+func unsetenv(key string) func() {
+	restore := setenv(key, "")
+	os.Unsetenv(key)
+	return restore
+}
+
+func TestGetPortEmptyConfig(t *testing.T) {
+	// Find a free port so we can verify the server actually binds to it.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	defer setenv("PORT", strconv.Itoa(want))()
+	port, err := getPort(new(FileConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != want {
+		t.Fatalf("getPort: got %d, want %d", port, want)
+	}
+	ln, err = net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &http.Server{Handler: NewServeMux(testConfig())}
+	go s.Serve(ln)
+	defer s.Close()
+	res, err := http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("GET /: got code %d, want 200", res.StatusCode)
+	}
+}
+
+func TestGetPort(t *testing.T) {
+	defer unsetenv("PORT")()
+	if port, err := getPort(new(FileConfig)); err != nil || port != DefaultPort {
+		t.Errorf("getPort: got (%d, %v), want (%d, nil)", port, err, DefaultPort)
+	}
+	os.Setenv("PORT", "notaport")
+	if _, err := getPort(new(FileConfig)); err == nil {
+		t.Error("getPort: expected error for invalid PORT, got nil")
+	}
+	configured := 9000
+	if port, err := getPort(&FileConfig{Port: &configured}); err != nil || port != 9000 {
+		t.Errorf("getPort: got (%d, %v), want (9000, nil)", port, err)
+	}
+}
+
 func BenchmarkHomepage(b *testing.B) {
-	mux := NewServeMux()
+	mux := NewServeMux(testConfig())
 	s := httptest.NewServer(mux)
 	b.ResetTimer()
 	b.ReportAllocs()
@@ -39,3 +115,73 @@ func BenchmarkHomepage(b *testing.B) {
 		res.Body.Close()
 	}
 }
+
+// TestMainHelper runs main with the arguments in
+// GO_HTML_BOILERPLATE_MAIN_ARGS, when runMain starts a copy of the test binary.
+// Otherwise it does nothing.
+func TestMainHelper(t *testing.T) {
+	args := os.Getenv("GO_HTML_BOILERPLATE_MAIN_ARGS")
+	if args == "" {
+		return
+	}
+	commit, buildDate = "0123456789abcdef", "2026-10-15T12:00:00Z"
+	os.Args = append([]string{"go-html-boilerplate"}, strings.Split(args, "\n")...)
+	main()
+}
+
+// runMain runs main with args in a copy of the test binary, since main can
+// exit, and returns its stdout and stderr.
+func runMain(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMainHelper$")
+	cmd.Env = append(os.Environ(), "GO_HTML_BOILERPLATE_MAIN_ARGS="+strings.Join(args, "\n"))
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestVersionFlag(t *testing.T) {
+	// The config file doesn't exist, so this fails if main reads it.
+	out, _, err := runMain(t, "-config", "missing.yml", "-version")
+	if err != nil {
+		t.Fatalf("expected -version to exit 0, got %v", err)
+	}
+	want := "go-html-boilerplate " + Version + " commit 0123456789abcdef built 2026-10-15T12:00:00Z " + runtime.Version() + "\n"
+	if !strings.HasPrefix(out, want) {
+		t.Errorf("got output %q, want it to start with %q", out, want)
+	}
+}
+
+func TestCheckFlag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	good := filepath.Join(dir, "good.yml")
+	if err := ioutil.WriteFile(good, []byte("http_only: true\nport: 0\nsecret_key: "+strings.Repeat("ab", 32)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out, stderr, err := runMain(t, "-config", good, "-check")
+	if err != nil {
+		t.Fatalf("good config: expected -check to exit 0, got %v: %s", err, stderr)
+	}
+	if !strings.HasPrefix(out, good+": OK\n") {
+		t.Errorf("good config: got output %q", out)
+	}
+
+	bad := filepath.Join(dir, "bad.yml")
+	if err := ioutil.WriteFile(bad, []byte("port: 70000\nsecret_key: abc\ncert_file: missing.pem\nkey_file: missing.key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err = runMain(t, "-config", bad, "-check")
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("bad config: expected -check to exit 1, got %v", err)
+	}
+	for _, want := range []string{"secret_key:", "port:", "cert_file:", "key_file:", "found 4 problem(s)"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("bad config: got output %q, want it to contain %q", stderr, want)
+		}
+	}
+}
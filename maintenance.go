@@ -0,0 +1,70 @@
+package main
+
+// Maintenance mode, for taking the site offline without stopping the server.
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kevinburke/rest"
+)
+
+// DefaultMaintenanceRetryAfter is how long clients are told to wait before
+// trying again during maintenance, if no MaintenanceRetryAfter is configured.
+const DefaultMaintenanceRetryAfter = 5 * time.Minute
+
+// underMaintenance reports whether c puts requests to path under maintenance.
+// Health checks and static files are still served, so the maintenance page
+// can load its stylesheet.
+func underMaintenance(c *FileConfig, path string) bool {
+	if c == nil || !c.MaintenanceMode || probePaths[path] || path == "/favicon.ico" {
+		return false
+	}
+	for _, prefix := range append([]string{c.staticPrefix()}, c.MaintenanceAllow...) {
+		if hasPathPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// withMaintenance responds with a 503 and a Retry-After header to every
+// request while maintenance_mode is on in the current config, except health
+// checks, static files and paths in maintenance_allow. Clients that want HTML
+// get the maintenance.html template, and everyone else gets a JSON error.
+// Turn maintenance mode on and off by reloading the config.
+func withMaintenance(h http.Handler, load func() (map[string]*template.Template, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := currentConfig()
+		if !underMaintenance(c, r.URL.Path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		retryAfter := c.MaintenanceRetryAfter.Duration
+		if retryAfter <= 0 {
+			retryAfter = DefaultMaintenanceRetryAfter
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		w.Header().Set("Cache-Control", "no-store")
+		if wantsHTML(r) {
+			tpls, err := load()
+			if err != nil {
+				renderDevError(w, err)
+				return
+			}
+			if tpl, ok := tpls["maintenance.html"]; ok {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				renderStatus(w, r, tpl, "maintenance.html", http.StatusServiceUnavailable, nil)
+				return
+			}
+		}
+		writeJSON(w, http.StatusServiceUnavailable, &rest.Error{
+			Title:    "The site is down for maintenance",
+			ID:       "maintenance",
+			Instance: r.URL.Path,
+			Status:   http.StatusServiceUnavailable,
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	mux := NewServeMux(c)
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	setLive(c, NewRandomKey())
+	if w := get("/", "text/html"); w.Code != 200 {
+		t.Errorf("off: got code %d, want 200", w.Code)
+	}
+
+	on := *c
+	on.MaintenanceMode = true
+	on.MaintenanceAllow = []string{"/admin"}
+	setLive(&on, NewRandomKey())
+	w := get("/", "text/html")
+	if w.Code != 503 {
+		t.Errorf("on: got code %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "300" {
+		t.Errorf("on: got Retry-After %q, want 300", got)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "<h1>Down for maintenance</h1>") {
+		t.Errorf("on: expected the maintenance page, got %s", body)
+	}
+	if w := get("/api/users", "application/json"); w.Code != 503 || !strings.Contains(w.Body.String(), `"id":"maintenance"`) {
+		t.Errorf("on, JSON: got %d %s", w.Code, w.Body)
+	}
+	for _, path := range []string{"/healthz", "/readyz", "/static/style.css"} {
+		if w := get(path, "*/*"); w.Code != 200 {
+			t.Errorf("on: GET %s: got code %d, want 200", path, w.Code)
+		}
+	}
+	// Allowed paths go through to the router.
+	if w := get("/admin/missing", "text/html"); w.Code != 404 {
+		t.Errorf("on: GET /admin/missing: got code %d, want 404", w.Code)
+	}
+	if w := get("/administrator", "text/html"); w.Code != 503 {
+		t.Errorf("on: GET /administrator: got code %d, want 503", w.Code)
+	}
+
+	setLive(c, NewRandomKey())
+	if w := get("/", "text/html"); w.Code != 200 {
+		t.Errorf("off again: got code %d, want 200", w.Code)
+	}
+}
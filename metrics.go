@@ -0,0 +1,118 @@
+package main
+
+// Prometheus metrics for HTTP requests.
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/kevinburke/rest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultMetricsAllow only lets Prometheus scrape /metrics from the same
+// machine, if no MetricsAllow networks are configured.
+var DefaultMetricsAllow = []string{"127.0.0.0/8", "::1/128"}
+
+// metrics records the number, duration and concurrency of requests. Each
+// metrics has its own registry, so servers in tests don't share counters.
+type metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests, by method and status code.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being served.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.requests, m.duration, m.inFlight,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// instrument records metrics for every request to h.
+func (m *metrics) instrument(h http.Handler) http.Handler {
+	h = promhttp.InstrumentHandlerDuration(m.duration, h)
+	h = promhttp.InstrumentHandlerCounter(m.requests, h)
+	return promhttp.InstrumentHandlerInFlight(m.inFlight, h)
+}
+
+// handler serves the metrics in the Prometheus text format to clients in
+// allow, and a 404 to everyone else. Clients are identified by the address of
+// the connection, so behind a proxy, allow the proxy's address.
+func (m *metrics) handler(allow []*net.IPNet) http.Handler {
+	return allowOnly(allow, promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// allowOnly serves h to clients in allow, and a 404 to everyone else.
+func allowOnly(allow []*net.IPNet, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowedAddr(r.RemoteAddr, allow) {
+			rest.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// allowedAddr reports whether the IP in addr, a "host:port" address, is in one
+// of the networks in allow.
+func allowedAddr(addr string, allow []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworks parses a list of CIDR networks, like "10.0.0.0/8". A plain IP
+// address is treated as a network with just that address.
+func parseNetworks(networks []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(networks))
+	for _, s := range networks {
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR network", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	c := testConfig()
+	if err := c.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	mux := NewServeMux(c)
+	scrape := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	const counter = `http_requests_total{code="200",method="get"}`
+	for i := 0; i < 2; i++ {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	w := scrape("127.0.0.1:5000")
+	if w.Code != 200 {
+		t.Fatalf("GET /metrics: got code %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, counter+" 2\n") {
+		t.Errorf("expected %s to be 2, got:\n%s", counter, body)
+	}
+	for _, name := range []string{"http_request_duration_seconds_bucket", "http_requests_in_flight", "go_goroutines"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("expected %s in the metrics", name)
+		}
+	}
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	// The previous scrape was also a 200 GET.
+	if body := scrape("[::1]:5000").Body.String(); !strings.Contains(body, counter+" 4\n") {
+		t.Errorf("expected %s to be 4 after another request", counter)
+	}
+
+	if w := scrape("192.0.2.1:5000"); w.Code != 404 {
+		t.Errorf("GET /metrics from a remote address: got code %d, want 404", w.Code)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	nets, err := parseNetworks([]string{"10.0.0.0/8", "192.0.2.7", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3:80", true},
+		{"192.0.2.7:80", true},
+		{"192.0.2.8:80", false},
+		{"[2001:db8::1]:80", true},
+		{"[2001:db8::2]:80", false},
+		{"not an address", false},
+	}
+	for _, tt := range tests {
+		if got := allowedAddr(tt.addr, nets); got != tt.want {
+			t.Errorf("allowedAddr(%q): got %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+	if _, err := parseNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected an error for an invalid network")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"unicode"
+)
+
+// rawTags are elements whose contents are copied as-is by minifyHTML, since
+// whitespace and comment-like text inside them is significant.
+var rawTags = []string{"pre", "textarea", "script", "style"}
+
+// minifyHTML returns html with comments removed and runs of whitespace
+// collapsed to a single space. The contents of <pre>, <textarea>, <script>
+// and <style> elements, quoted attribute values, and conditional comments
+// like <!--[if IE]> are left alone.
+func minifyHTML(html []byte) []byte {
+	out := make([]byte, 0, len(html))
+	for i := 0; i < len(html); {
+		c := html[i]
+		switch {
+		case bytes.HasPrefix(html[i:], []byte("<!--")):
+			end := bytes.Index(html[i+4:], []byte("-->"))
+			if end < 0 {
+				return append(out, html[i:]...)
+			}
+			end += i + 4 + 3
+			if bytes.HasPrefix(html[i+4:], []byte("[if")) || bytes.HasPrefix(html[i+4:], []byte("[endif")) {
+				out = append(out, html[i:end]...)
+			}
+			i = end
+		case c == '<':
+			end := tagEnd(html, i)
+			out = append(out, collapseSpace(html[i:end])...)
+			if tag := rawTag(html[i:end]); tag != "" {
+				// Copy everything up to the closing tag.
+				closing := indexFold(html[end:], "</"+tag)
+				if closing < 0 {
+					return append(out, html[end:]...)
+				}
+				out = append(out, html[end:end+closing]...)
+				end += closing
+			}
+			i = end
+		case isSpace(c):
+			j := i
+			for j < len(html) && isSpace(html[j]) {
+				j++
+			}
+			out = append(out, ' ')
+			i = j
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	return out
+}
+
+// tagEnd returns the index just past the end of the tag that starts at
+// html[start], skipping over '>' in quoted attribute values.
+func tagEnd(html []byte, start int) int {
+	var quote byte
+	for i := start + 1; i < len(html); i++ {
+		switch c := html[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1
+		}
+	}
+	return len(html)
+}
+
+// collapseSpace collapses runs of whitespace in a tag to a single space,
+// except inside quoted attribute values.
+func collapseSpace(tag []byte) []byte {
+	out := make([]byte, 0, len(tag))
+	var quote byte
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case isSpace(c):
+			if i > 0 && isSpace(tag[i-1]) {
+				continue
+			}
+			c = ' '
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// rawTag returns the name of the element that tag opens, if it's one of
+// rawTags.
+func rawTag(tag []byte) string {
+	for _, name := range rawTags {
+		if len(tag) < len(name)+2 || !bytes.EqualFold(tag[1:len(name)+1], []byte(name)) {
+			continue
+		}
+		if next := tag[len(name)+1]; next == '>' || next == '/' || isSpace(next) {
+			return name
+		}
+	}
+	return ""
+}
+
+// indexFold returns the index of the first case-insensitive match of s in b,
+// or -1.
+func indexFold(b []byte, s string) int {
+	for i := 0; i+len(s) <= len(b); i++ {
+		if bytes.EqualFold(b[i:i+len(s)], []byte(s)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isSpace(c byte) bool {
+	return c < 0x80 && unicode.IsSpace(rune(c))
+}
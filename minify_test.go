@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"<p>\n    Hello   world\n</p>\n", "<p> Hello world </p> "},
+		{"<p>a</p><!-- a comment --><p>b</p>", "<p>a</p><p>b</p>"},
+		{"<!--[if IE]><p>IE</p><![endif]-->", "<!--[if IE]><p>IE</p><![endif]-->"},
+		{"<a   href=\"/x\"\n   title=\"two  spaces\">x</a>", "<a href=\"/x\" title=\"two  spaces\">x</a>"},
+		{"<pre>\n  keep\n    this\n</pre>  <p> x </p>", "<pre>\n  keep\n    this\n</pre> <p> x </p>"},
+		{"<textarea name=\"t\">  a\n\n b</textarea>", "<textarea name=\"t\">  a\n\n b</textarea>"},
+		{"<script>\nvar a = \"<!-- not a comment -->\";\n  if (a) {}\n</script>", "<script>\nvar a = \"<!-- not a comment -->\";\n  if (a) {}\n</script>"},
+		{"<STYLE>\n  p  { color: red }\n</STYLE>", "<STYLE>\n  p  { color: red }\n</STYLE>"},
+		{"<prefix>  a  </prefix>", "<prefix> a </prefix>"},
+		{"<p title='a > b'>  x</p>", "<p title='a > b'> x</p>"},
+		{"<pre>unterminated  ", "<pre>unterminated  "},
+		{"<p>x</p><!-- unterminated", "<p>x</p><!-- unterminated"},
+	}
+	for _, tt := range tests {
+		if got := string(minifyHTML([]byte(tt.in))); got != tt.want {
+			t.Errorf("minifyHTML(%q):\ngot  %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMinified(t *testing.T) {
+	defer live.Store(getLive())
+	get := func() string {
+		w := httptest.NewRecorder()
+		NewServeMux(testConfig()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w.Body.String()
+	}
+
+	c := testConfig()
+	setLive(c, nil)
+	plain := get()
+	c = testConfig()
+	c.MinifyHTML = true
+	setLive(c, nil)
+	minified := get()
+	if len(minified) >= len(plain) {
+		t.Errorf("expected minified output (%d bytes) to be smaller than plain (%d bytes)", len(minified), len(plain))
+	}
+	if strings.Contains(minified, "\n") {
+		t.Errorf("expected no newlines in minified output, got %q", minified)
+	}
+	if !strings.Contains(minified, "<h1>Hello World!</h1>") {
+		t.Errorf("expected content in minified output, got %q", minified)
+	}
+
+	// Dev mode keeps the source readable.
+	c = testConfig()
+	c.MinifyHTML = true
+	c.Dev = true
+	setLive(c, nil)
+	if got := get(); got != plain {
+		t.Errorf("expected unminified output in dev mode, got %q", got)
+	}
+}
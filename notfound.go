@@ -0,0 +1,43 @@
+package main
+
+// Not found responses.
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/kevinburke/rest"
+)
+
+// wantsHTML reports whether the client asked for an HTML response, like
+// browsers do when they load a page.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// notFoundHandler renders the 404.html template for clients that want HTML,
+// and a JSON error for everyone else, like API clients. load returns the
+// parsed templates. If there's no 404.html template, every client gets JSON.
+func notFoundHandler(load func() (map[string]*template.Template, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wantsHTML(r) {
+			tpls, err := load()
+			if err != nil {
+				renderDevError(w, err)
+				return
+			}
+			if tpl, ok := tpls["404.html"]; ok {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				renderStatus(w, r, tpl, "404.html", http.StatusNotFound, nil)
+				return
+			}
+		}
+		writeJSON(w, http.StatusNotFound, &rest.Error{
+			Title:    "Resource not found",
+			ID:       "not_found",
+			Instance: r.URL.Path,
+			Status:   http.StatusNotFound,
+		})
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotFoundHTML(t *testing.T) {
+	mux := NewServeMux(testConfig())
+	for _, path := range []string{"/missing", "/static/missing.css"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 404 {
+			t.Errorf("GET %s: got code %d, want 404", path, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("GET %s: got Content-Type %q, want HTML", path, ct)
+		}
+		if body := w.Body.String(); !strings.Contains(body, "<h1>Page not found</h1>") || !strings.Contains(body, `href="/"`) {
+			t.Errorf("GET %s: expected the 404 page, got %s", path, body)
+		}
+	}
+}
+
+func TestNotFoundJSON(t *testing.T) {
+	mux := NewServeMux(testConfig())
+	for _, path := range []string{"/api/missing", "/static/missing.css"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 404 {
+			t.Errorf("GET %s: got code %d, want 404", path, w.Code)
+		}
+		var e struct {
+			ID       string `json:"id"`
+			Instance string `json:"instance"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Fatalf("GET %s: %v: %s", path, err, w.Body.String())
+		}
+		if e.ID != "not_found" || e.Instance != path {
+			t.Errorf("GET %s: got error %+v", path, e)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+// Profiling endpoints for debugging a running server.
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/kevinburke/handlers"
+)
+
+// pprofUser is the basic auth username for the pprof endpoints.
+const pprofUser = "pprof"
+
+// pprofHandler serves the net/http/pprof endpoints under /debug/pprof/. If
+// password is set, requests must use basic auth with the username "pprof" and
+// that password.
+//
+// CPU profiles and traces take as long as the "seconds" parameter, so keep it
+// under the server's write_timeout.
+func pprofHandler(password string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	if password == "" {
+		return mux
+	}
+	return handlers.BasicAuth(mux, "pprof", map[string]string{pprofUser: password})
+}
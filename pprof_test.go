@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPprof(t *testing.T) {
+	paths := []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/heap?debug=1", "/debug/pprof/goroutine?debug=1"}
+	get := func(c *FileConfig, path string, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if password != "" {
+			req.SetBasicAuth(pprofUser, password)
+		}
+		w := httptest.NewRecorder()
+		NewServeMux(c).ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range paths {
+		if w := get(testConfig(), path, ""); w.Code != 404 {
+			t.Errorf("disabled: GET %s: got code %d, want 404", path, w.Code)
+		}
+	}
+
+	c := testConfig()
+	c.Pprof = true
+	for _, path := range paths {
+		if w := get(c, path, ""); w.Code != 200 {
+			t.Errorf("enabled: GET %s: got code %d, want 200", path, w.Code)
+		}
+	}
+	if body := get(c, "/debug/pprof/", "").Body.String(); !strings.Contains(body, "goroutine") {
+		t.Errorf("expected the pprof index, got %q", body)
+	}
+
+	c.PprofPassword = "hunter2"
+	if w := get(c, "/debug/pprof/", ""); w.Code != 401 {
+		t.Errorf("no password: got code %d, want 401", w.Code)
+	}
+	if w := get(c, "/debug/pprof/", "wrong"); w.Code != 403 {
+		t.Errorf("wrong password: got code %d, want 403", w.Code)
+	}
+	if w := get(c, "/debug/pprof/", "hunter2"); w.Code != 200 {
+		t.Errorf("right password: got code %d, want 200", w.Code)
+	}
+}
@@ -3,22 +3,34 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
 )
 
 // Push the given resource to the client. Destination is a "request destination"
 // per this spec: https://fetch.spec.whatwg.org/#concept-request-destination.
-// Destination be empty.
-func push(w http.ResponseWriter, resource string, destination string) {
+// Destination may be empty.
+//
+// If the client doesn't support server push (for example, over HTTP/1.1 or
+// plain HTTP), push falls back to a preload Link header. If the current config
+// disables push, the Link header tells proxies not to push the resource
+// either.
+func push(w http.ResponseWriter, r *http.Request, resource string, destination string) {
+	if c := currentConfig(); c != nil && !c.pushEnabled() {
+		addLink(w.Header(), preloadLink(resource, destination)+"; nopush")
+		return
+	}
 	pusher, ok := w.(http.Pusher)
 	if ok {
-		if err := pusher.Push("/static/style.css", nil); err == nil {
+		err := pusher.Push(resource, nil)
+		if err == nil {
 			return
 		}
+		LoggerFrom(r.Context()).Debug("Couldn't push resource", "resource", resource, "err", err)
+	} else {
+		LoggerFrom(r.Context()).Debug("Server push isn't available", "resource", resource)
 	}
 	// HTTP2 push is only supported in Go 1.8 and up; implement the preload spec
 	// in case there's a proxy that supports HTTP2.
 	// https://w3c.github.io/preload/#server-push-http-2
-	w.Header().Add("Link", fmt.Sprintf("<%s>; rel=preload; as=%s", resource, destination))
+	addLink(w.Header(), preloadLink(resource, destination))
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pushRecorder is a ResponseRecorder that supports server push.
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	setLive(c, NewRandomKey())
+	req := httptest.NewRequest("GET", "/", nil)
+
+	w := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	push(w, req, "/static/style.css", "style")
+	if len(w.pushed) != 1 || w.pushed[0] != "/static/style.css" {
+		t.Errorf("pusher: got pushed %v, want the stylesheet", w.pushed)
+	}
+	if got := w.Header().Get("Link"); got != "" {
+		t.Errorf("pusher: got Link %q, want none", got)
+	}
+
+	rec := httptest.NewRecorder()
+	push(rec, req, "/static/style.css", "style")
+	if got := rec.Header().Get("Link"); got != "</static/style.css>; rel=preload; as=style" {
+		t.Errorf("no pusher: got Link %q", got)
+	}
+
+	disabled := false
+	c.EnablePush = &disabled
+	w = &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	push(w, req, "/static/style.css", "style")
+	if len(w.pushed) != 0 {
+		t.Errorf("disabled: got pushed %v, want nothing", w.pushed)
+	}
+	if got := w.Header().Get("Link"); got != "</static/style.css>; rel=preload; as=style; nopush" {
+		t.Errorf("disabled: got Link %q", got)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+// The web app manifest and service worker, for progressive web apps that can
+// be installed and work offline.
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kevinburke/rest"
+)
+
+const (
+	webManifestAsset   = "static/manifest.webmanifest"
+	serviceWorkerAsset = "static/service-worker.js"
+)
+
+func init() {
+	// Not every system's MIME types include it.
+	mime.AddExtensionType(".webmanifest", "application/manifest+json")
+}
+
+// webManifest serves content as /manifest.webmanifest, cached for maxAge. If
+// content is empty, it serves the static/manifest.webmanifest asset from
+// static instead.
+func webManifest(content string, maxAge time.Duration, static func() *static) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if content == "" {
+			serveStaticAs(w, r, static(), webManifestAsset)
+			return
+		}
+		w.Header().Set("Content-Type", "application/manifest+json")
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge/time.Second)))
+		if r.Method == "HEAD" {
+			return
+		}
+		w.Write([]byte(content))
+	})
+}
+
+// serviceWorker serves the static/service-worker.js asset from static. It's
+// served from the root, since a service worker only controls the pages under
+// the path it's served from, and with "Cache-Control: no-cache", so browsers
+// check for a new version every time.
+func serviceWorker(static func() *static) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := static()
+		data, err := s.store.Asset(serviceWorkerAsset)
+		if err != nil {
+			rest.NotFound(w, r)
+			return
+		}
+		if etag, ok := s.etags[serviceWorkerAsset]; ok {
+			w.Header().Set("ETag", etag)
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeContent(w, r, serviceWorkerAsset, s.modTimes[serviceWorkerAsset], bytes.NewReader(data))
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebManifest(t *testing.T) {
+	c := testConfig()
+	mux := NewServeMux(c)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/manifest.webmanifest", nil))
+	if w.Code != 200 {
+		t.Fatalf("got code %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/manifest+json" {
+		t.Errorf("got Content-Type %q, want application/manifest+json", ct)
+	}
+	var manifest struct {
+		StartURL string `json:"start_url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.StartURL != "/" {
+		t.Errorf("got start_url %q, want /", manifest.StartURL)
+	}
+
+	c.WebManifest = `{"name": "Custom"}`
+	w = httptest.NewRecorder()
+	NewServeMux(c).ServeHTTP(w, httptest.NewRequest("GET", "/manifest.webmanifest", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/manifest+json" {
+		t.Errorf("configured manifest: got Content-Type %q, want application/manifest+json", ct)
+	}
+	if body := w.Body.String(); body != c.WebManifest {
+		t.Errorf("configured manifest: got %q", body)
+	}
+
+	// Pages link to it.
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, `<link rel="manifest" href="/manifest.webmanifest">`) {
+		t.Errorf("expected the homepage to link to the manifest, got %s", body)
+	}
+}
+
+func TestServiceWorker(t *testing.T) {
+	mux := NewServeMux(testConfig())
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/service-worker.js", nil))
+	if w.Code != 200 {
+		t.Fatalf("got code %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("got Cache-Control %q, want no-cache", got)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+		t.Errorf("got Content-Type %q, want text/javascript", ct)
+	}
+	if !strings.Contains(w.Body.String(), `addEventListener("install"`) {
+		t.Errorf("expected the service worker, got %s", w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	req := httptest.NewRequest("GET", "/service-worker.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 304 {
+		t.Errorf("If-None-Match: got code %d, want 304", w.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+// Per-client rate limiting.
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kevinburke/rest"
+)
+
+// bucket is a token bucket. It holds up to burst tokens and gains rate tokens
+// per second; each request takes one.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket for each client.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// allow takes a token from the bucket for client, refilled at rate tokens per
+// second up to burst. If the bucket is empty, allow returns false and how long
+// until the next token.
+func (rl *rateLimiter) allow(client string, rate float64, burst int) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.now()
+	// Buckets that have been idle long enough to refill are the same as new
+	// ones, so drop them to keep the map from growing forever.
+	full := time.Duration(float64(burst) / rate * float64(time.Second))
+	if now.Sub(rl.lastSweep) > time.Minute {
+		for k, b := range rl.buckets {
+			if now.Sub(b.last) >= full {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+	b, ok := rl.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		rl.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// rateLimitBurst returns the configured burst, or the rate rounded up if it's
+// not set.
+func rateLimitBurst(c *FileConfig) int {
+	if c.RateLimitBurst > 0 {
+		return c.RateLimitBurst
+	}
+	return int(math.Max(1, math.Ceil(c.RateLimit)))
+}
+
+// withRateLimit limits each client IP to the rate_limit in the current config,
+// responding with a 429 and a Retry-After header to requests over the limit.
+// Health checks and metrics aren't limited.
+func withRateLimit(h http.Handler) http.Handler {
+	rl := newRateLimiter()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := currentConfig()
+		if c == nil || c.RateLimit <= 0 || probePaths[r.URL.Path] {
+			h.ServeHTTP(w, r)
+			return
+		}
+		client := ClientIP(r.Context())
+		if client == "" {
+			// Validate checked the networks when the config was loaded.
+			trusted, _ := parseNetworks(c.TrustedProxies)
+			client = clientIP(r, trusted)
+		}
+		ok, wait := rl.allow(client, c.RateLimit, rateLimitBurst(c))
+		if ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeJSON(w, http.StatusTooManyRequests, &rest.Error{
+			Title:  "Too many requests",
+			ID:     "rate_limited",
+			Status: http.StatusTooManyRequests,
+		})
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.RateLimit = 1
+	c.RateLimitBurst = 3
+	setLive(c, NewRandomKey())
+	h := withRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 3; i++ {
+		if w := get("10.0.0.1:1234"); w.Code != 200 {
+			t.Fatalf("request %d: got code %d, want 200", i, w.Code)
+		}
+	}
+	w := get("10.0.0.1:5678")
+	if w.Code != 429 {
+		t.Fatalf("request over the limit: got code %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("got Retry-After %q, want 1", got)
+	}
+	// Other clients have their own limit.
+	if w := get("10.0.0.2:1234"); w.Code != 200 {
+		t.Errorf("other client: got code %d, want 200", w.Code)
+	}
+	// Health checks aren't limited.
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("/healthz: got code %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	rl := newRateLimiter()
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		if ok, _ := rl.allow("a", 2, 2); !ok {
+			t.Fatalf("request %d: expected it to be allowed", i)
+		}
+	}
+	ok, wait := rl.allow("a", 2, 2)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("got %t, %v, want false, 500ms", ok, wait)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := rl.allow("a", 2, 2); !ok {
+		t.Error("expected a request to be allowed after the bucket refilled")
+	}
+
+	// Idle buckets are removed.
+	now = now.Add(2 * time.Minute)
+	rl.allow("b", 2, 2)
+	if _, ok := rl.buckets["a"]; ok {
+		t.Error("expected the idle bucket to be removed")
+	}
+}
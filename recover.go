@@ -0,0 +1,33 @@
+package main
+
+// Recovering from panics in handlers.
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// withRecover recovers from panics in h, logs them with the stack trace and
+// responds with the error page. In dev mode the page shows the panic and the
+// stack.
+//
+// http.ErrAbortHandler is panicked again, so the server aborts the response
+// like it would without withRecover.
+func withRecover(h http.Handler, e *errorPage) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			stack := debug.Stack()
+			LoggerFrom(r.Context()).Error("Panic serving request", "method", r.Method, "path", r.URL.Path, "err", v, "stack", string(stack))
+			e.render(w, r, fmt.Sprintf("panic: %v\n\n%s", v, stack))
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
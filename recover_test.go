@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	r := newRouter()
+	r.Get("/panic", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oh no")
+	}))
+	r.Get("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	for _, dev := range []bool{false, true} {
+		s := httptest.NewServer(withRecover(r, &errorPage{dev: dev}))
+		resp, err := http.Get(s.URL + "/panic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 500 {
+			t.Errorf("dev %t: got code %d, want 500", dev, resp.StatusCode)
+		}
+		if got := strings.Contains(string(body), "oh no"); got != dev {
+			t.Errorf("dev %t: error page shows the panic: %t", dev, got)
+		}
+
+		resp, err = http.Get(s.URL + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 || string(body) != "ok" {
+			t.Errorf("dev %t: request after the panic: got %d %q", dev, resp.StatusCode, body)
+		}
+		s.Close()
+	}
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	h := withRecover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}), &errorPage{})
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("got panic %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
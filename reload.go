@@ -0,0 +1,234 @@
+package main
+
+// Helpers for reloading the config file while the server is running.
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+)
+
+// liveConfig is the config and secret keys currently in use. It's replaced
+// wholesale when the config is reloaded, so handlers that need a consistent
+// view should call getLive once and use the result.
+type liveConfig struct {
+	config *FileConfig
+	key    *[32]byte
+	// keys is key followed by the config's fallback keys.
+	keys []*[32]byte
+}
+
+var live atomic.Value // *liveConfig
+
+func getLive() *liveConfig {
+	l, _ := live.Load().(*liveConfig)
+	return l
+}
+
+func setLive(c *FileConfig, key *[32]byte) {
+	keys := append([]*[32]byte{key}, c.fallbackKeys()...)
+	live.Store(&liveConfig{config: c, key: key, keys: keys})
+}
+
+// currentConfig returns the config currently in use, or nil if the server
+// hasn't loaded one.
+func currentConfig() *FileConfig {
+	if l := getLive(); l != nil {
+		return l.config
+	}
+	return nil
+}
+
+// currentKey returns the secret key currently in use, or nil if the server
+// hasn't loaded one.
+func currentKey() *[32]byte {
+	if l := getLive(); l != nil {
+		return l.key
+	}
+	return nil
+}
+
+// currentKeys returns the secret key currently in use, followed by any older
+// keys that should still be accepted when decrypting. It returns nil if the
+// server hasn't loaded a key.
+func currentKeys() []*[32]byte {
+	if l := getLive(); l != nil && l.key != nil {
+		return l.keys
+	}
+	return nil
+}
+
+// reloadConfig loads and validates the config at filename, and if it's valid,
+// swaps it in for the current config. Settings that can't be changed without
+// restarting the server keep their old values, and a warning is logged.
+func reloadConfig(filename string) error {
+	c, err := loadConfig(filename)
+	if err != nil {
+		return err
+	}
+	key, err := setupConfig(c)
+	if err != nil {
+		return err
+	}
+	if old := currentConfig(); old != nil {
+		keepRestartOnly(old, c)
+	}
+	setLive(c, key)
+	return nil
+}
+
+// keepRestartOnly copies settings that can only be changed by restarting the
+// server from old to c, logging a warning for each one that differs.
+func keepRestartOnly(old, c *FileConfig) {
+	if *c.Port != *old.Port {
+		logger.Warn("Changing the port requires a restart; ignoring", "old", *old.Port, "new", *c.Port)
+		c.Port = old.Port
+	}
+	if c.BindAddress != old.BindAddress {
+		logger.Warn("Changing bind_address requires a restart; ignoring", "old", old.BindAddress, "new", c.BindAddress)
+		c.BindAddress = old.BindAddress
+	}
+	if c.UnixSocket != old.UnixSocket {
+		logger.Warn("Changing unix_socket requires a restart; ignoring", "old", old.UnixSocket, "new", c.UnixSocket)
+		c.UnixSocket = old.UnixSocket
+	}
+	if c.HTTPOnly != old.HTTPOnly {
+		logger.Warn("Changing http_only requires a restart; ignoring", "old", old.HTTPOnly, "new", c.HTTPOnly)
+		c.HTTPOnly = old.HTTPOnly
+	}
+	if c.RedirectHTTP != old.RedirectHTTP || c.HTTPPort != old.HTTPPort {
+		logger.Warn("Changing redirect_http or http_port requires a restart; ignoring")
+		c.RedirectHTTP = old.RedirectHTTP
+		c.HTTPPort = old.HTTPPort
+	}
+	if c.ReadTimeout != old.ReadTimeout || c.WriteTimeout != old.WriteTimeout {
+		logger.Warn("Changing read_timeout or write_timeout requires a restart; ignoring")
+		c.ReadTimeout = old.ReadTimeout
+		c.WriteTimeout = old.WriteTimeout
+	}
+	if c.IdleTimeout != old.IdleTimeout || c.ReadHeaderTimeout != old.ReadHeaderTimeout {
+		logger.Warn("Changing idle_timeout or read_header_timeout requires a restart; ignoring")
+		c.IdleTimeout = old.IdleTimeout
+		c.ReadHeaderTimeout = old.ReadHeaderTimeout
+	}
+	if c.MaxHeaderBytes != old.MaxHeaderBytes {
+		logger.Warn("Changing max_header_bytes requires a restart; ignoring", "old", old.MaxHeaderBytes, "new", c.MaxHeaderBytes)
+		c.MaxHeaderBytes = old.MaxHeaderBytes
+	}
+	if c.CertFile != old.CertFile || c.KeyFile != old.KeyFile || !reflect.DeepEqual(c.Certificates, old.Certificates) {
+		logger.Warn("Changing cert_file, key_file or certificates requires a restart; ignoring")
+		c.CertFile = old.CertFile
+		c.KeyFile = old.KeyFile
+		c.Certificates = old.Certificates
+	}
+	if c.DevCert != old.DevCert {
+		logger.Warn("Changing dev_cert requires a restart; ignoring", "old", old.DevCert, "new", c.DevCert)
+		c.DevCert = old.DevCert
+	}
+	if c.MinTLSVersion != old.MinTLSVersion {
+		logger.Warn("Changing min_tls_version requires a restart; ignoring", "old", old.MinTLSVersion, "new", c.MinTLSVersion)
+		c.MinTLSVersion = old.MinTLSVersion
+	}
+	if !reflect.DeepEqual(c.CipherSuites, old.CipherSuites) {
+		logger.Warn("Changing cipher_suites requires a restart; ignoring")
+		c.CipherSuites = old.CipherSuites
+	}
+	if c.ClientCAFile != old.ClientCAFile || c.RequireClientCert != old.RequireClientCert {
+		logger.Warn("Changing client_ca_file or require_client_cert requires a restart; ignoring")
+		c.ClientCAFile = old.ClientCAFile
+		c.RequireClientCert = old.RequireClientCert
+	}
+	if c.StaticPrefix != old.StaticPrefix || !reflect.DeepEqual(c.StaticDirs, old.StaticDirs) {
+		logger.Warn("Changing static_prefix or static_dirs requires a restart; ignoring")
+		c.StaticPrefix = old.StaticPrefix
+		c.StaticDirs = old.StaticDirs
+	}
+	if c.StaticCacheMaxAge != old.StaticCacheMaxAge {
+		logger.Warn("Changing static_cache_max_age requires a restart; ignoring", "old", old.StaticCacheMaxAge, "new", c.StaticCacheMaxAge)
+		c.StaticCacheMaxAge = old.StaticCacheMaxAge
+	}
+	if !reflect.DeepEqual(c.AutoTLS, old.AutoTLS) {
+		logger.Warn("Changing auto_tls requires a restart; ignoring")
+		c.AutoTLS = old.AutoTLS
+	}
+	if c.LogFormat != old.LogFormat {
+		logger.Warn("Changing log_format requires a restart; ignoring", "old", old.LogFormat, "new", c.LogFormat)
+		c.LogFormat = old.LogFormat
+	}
+	if c.LogFile != old.LogFile || c.LogMaxSize != old.LogMaxSize || !reflect.DeepEqual(c.LogMaxBackups, old.LogMaxBackups) {
+		logger.Warn("Changing log_file, log_max_size or log_max_backups requires a restart; ignoring")
+		c.LogFile = old.LogFile
+		c.LogMaxSize = old.LogMaxSize
+		c.LogMaxBackups = old.LogMaxBackups
+	}
+	if c.Pprof != old.Pprof || c.PprofPassword != old.PprofPassword {
+		logger.Warn("Changing pprof or pprof_password requires a restart; ignoring")
+		c.Pprof = old.Pprof
+		c.PprofPassword = old.PprofPassword
+	}
+	if c.Expvar != old.Expvar || c.DebugConfig != old.DebugConfig || c.WebSocketEcho != old.WebSocketEcho {
+		logger.Warn("Changing expvar, debug_config or websocket_echo requires a restart; ignoring")
+		c.Expvar = old.Expvar
+		c.DebugConfig = old.DebugConfig
+		c.WebSocketEcho = old.WebSocketEcho
+	}
+	if !reflect.DeepEqual(c.MetricsAllow, old.MetricsAllow) {
+		logger.Warn("Changing metrics_allow requires a restart; ignoring")
+		c.MetricsAllow = old.MetricsAllow
+	}
+	if c.AdminUser != old.AdminUser || c.AdminPasswordHash != old.AdminPasswordHash {
+		logger.Warn("Changing admin_user or admin_password_hash requires a restart; ignoring")
+		c.AdminUser = old.AdminUser
+		c.AdminPasswordHash = old.AdminPasswordHash
+	}
+	if c.RobotsTxt != old.RobotsTxt {
+		logger.Warn("Changing robots_txt requires a restart; ignoring")
+		c.RobotsTxt = old.RobotsTxt
+	}
+	if c.WebManifest != old.WebManifest {
+		logger.Warn("Changing web_manifest requires a restart; ignoring")
+		c.WebManifest = old.WebManifest
+	}
+	if c.SessionStore != old.SessionStore || c.RedisAddr != old.RedisAddr {
+		logger.Warn("Changing session_store or redis_addr requires a restart; ignoring")
+		c.SessionStore = old.SessionStore
+		c.RedisAddr = old.RedisAddr
+	}
+	// Dev mode can be turned on with the -dev flag, which isn't applied to the
+	// reloaded config, so don't warn if it differs.
+	c.Dev = old.Dev
+	c.DevDir = old.DevDir
+}
+
+// reloadOnSIGHUP reloads the config at filename every time the process
+// receives SIGHUP. If the new config is invalid, the error is logged and the
+// old config stays in use. Call stop to stop reloading; it returns once any
+// reload in progress has finished.
+func reloadOnSIGHUP(filename string) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ch:
+			case <-quit:
+				return
+			}
+			if err := reloadConfig(filename); err != nil {
+				logger.Error("Couldn't reload config; keeping the old one", "file", filename, "err", err)
+				continue
+			}
+			logger.Info("Reloaded config", "file", filename)
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(quit)
+		<-done
+	}
+}
@@ -0,0 +1,103 @@
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config.yml")
+	oldKey := "1111111111111111111111111111111111111111111111111111111111111111"
+	newKey := "2222222222222222222222222222222222222222222222222222222222222222"
+	if err := ioutil.WriteFile(filename, []byte("http_only: true\nport: 7065\nsecret_key: "+oldKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer live.Store((*liveConfig)(nil))
+	if err := reloadConfig(filename); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := getSecretKey(oldKey)
+	if *currentKey() != *want {
+		t.Fatal("expected the old key to be loaded")
+	}
+
+	stop := reloadOnSIGHUP(filename)
+	defer stop()
+	// The port can't change without a restart, so this should be ignored.
+	if err := ioutil.WriteFile(filename, []byte("http_only: true\nport: 8080\nsecret_key: "+newKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	want, _ = getSecretKey(newKey)
+	deadline := time.Now().Add(5 * time.Second)
+	for *currentKey() != *want {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the config to reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if *currentConfig().Port != 7065 {
+		t.Errorf("Port: got %d, want 7065 (unchanged)", *currentConfig().Port)
+	}
+
+	// Subsequent requests should encrypt data with the new key.
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FlashSuccess(w, "saved", currentKey())
+	})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one cookie, got %d", len(cookies))
+	}
+	if msg, err := unopaque(cookies[0].Value, want); err != nil || msg != "saved" {
+		t.Errorf("decrypting with new key: got (%q, %v), want (\"saved\", nil)", msg, err)
+	}
+}
+
+func TestKeepRestartOnly(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *FileConfig)
+	}{
+		{"read_timeout", func(c *FileConfig) { c.ReadTimeout.Duration = time.Minute }},
+		{"write_timeout", func(c *FileConfig) { c.WriteTimeout.Duration = time.Minute }},
+		{"idle_timeout", func(c *FileConfig) { c.IdleTimeout.Duration = time.Minute }},
+		{"read_header_timeout", func(c *FileConfig) { c.ReadHeaderTimeout.Duration = time.Minute }},
+		{"max_header_bytes", func(c *FileConfig) { c.MaxHeaderBytes = 4096 }},
+		{"dev_cert", func(c *FileConfig) { c.DevCert = true }},
+		{"min_tls_version", func(c *FileConfig) { c.MinTLSVersion = "1.3" }},
+		{"cipher_suites", func(c *FileConfig) { c.CipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"} }},
+		{"client_ca_file", func(c *FileConfig) { c.ClientCAFile = "ca.pem" }},
+		{"require_client_cert", func(c *FileConfig) { c.RequireClientCert = true }},
+		{"static_cache_max_age", func(c *FileConfig) { c.StaticCacheMaxAge.Duration = time.Hour }},
+		{"metrics_allow", func(c *FileConfig) { c.MetricsAllow = []string{"10.0.0.0/8"} }},
+		{"web_manifest", func(c *FileConfig) { c.WebManifest = `{"name": "New"}` }},
+	}
+	for _, tt := range tests {
+		old, c := testConfig(), testConfig()
+		p := 7065
+		old.Port, c.Port = &p, &p
+		tt.change(c)
+		keepRestartOnly(old, c)
+		if !reflect.DeepEqual(c, old) {
+			t.Errorf("%s: got %v after a reload, want the old value kept", tt.name, c)
+		}
+	}
+}
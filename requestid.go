@@ -0,0 +1,74 @@
+package main
+
+// Request IDs, for tying log lines to the request that caused them.
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	log "github.com/inconshreveable/log15"
+)
+
+// RequestIDHeader holds the request ID in requests and responses.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength limits the length of request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// withRequestID gives every request an ID, and sets it on the request context,
+// the request headers, and the X-Request-Id response header. A valid ID set
+// by the client or a proxy in the X-Request-Id header is kept, so requests can
+// be traced across services.
+//
+// Handlers get the ID with RequestID, and a logger that adds the ID to every
+// line with LoggerFrom.
+func withRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.Must(uuid.NewV4()).String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, loggerKey, logger.New("request_id", id))
+		r = r.Clone(ctx)
+		// handlers.Log reads the ID from the request header.
+		r.Header.Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID reports whether id is safe to log and echo back: not too
+// long, and only letters, digits and a few separators.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID returns the ID of the request with ctx, or the empty string if
+// the request didn't go through withRequestID.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// LoggerFrom returns a logger that adds the request ID to every line, or the
+// server's logger if ctx has no request ID.
+func LoggerFrom(ctx context.Context) log.Logger {
+	if l, ok := ctx.Value(loggerKey).(log.Logger); ok {
+		return l
+	}
+	return logger
+}
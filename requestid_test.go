@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+)
+
+func TestRequestID(t *testing.T) {
+	var fromCtx, fromHeader string
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromCtx = RequestID(r.Context())
+		fromHeader = r.Header.Get(RequestIDHeader)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	id := w.Header().Get(RequestIDHeader)
+	if len(id) != 36 {
+		t.Errorf("expected a UUID in the X-Request-Id header, got %q", id)
+	}
+	if fromCtx != id || fromHeader != id {
+		t.Errorf("got ID %q in the context and %q in the request, want %q", fromCtx, fromHeader, id)
+	}
+
+	tests := []struct {
+		sent string
+		keep bool
+	}{
+		{"abc-123_def.ghi:jkl", true},
+		{"has spaces", false},
+		{"<script>", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, tt.sent)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		got := w.Header().Get(RequestIDHeader)
+		if (got == tt.sent) != tt.keep {
+			t.Errorf("sent %q: got ID %q, want it kept: %v", tt.sent, got, tt.keep)
+		}
+		if fromCtx != got {
+			t.Errorf("sent %q: got %q in the context, want %q", tt.sent, fromCtx, got)
+		}
+	}
+}
+
+func TestLoggerFrom(t *testing.T) {
+	var records []*log.Record
+	old := logger.GetHandler()
+	defer logger.SetHandler(old)
+	logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LoggerFrom(r.Context()).Info("handling request", "user", "alice")
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if len(records) != 1 {
+		t.Fatalf("got %d log lines, want 1", len(records))
+	}
+	got := map[interface{}]interface{}{}
+	ctx := records[0].Ctx
+	for i := 0; i+1 < len(ctx); i += 2 {
+		got[ctx[i]] = ctx[i+1]
+	}
+	if got["request_id"] != "req-1" || got["user"] != "alice" {
+		t.Errorf("got log fields %v, want request_id and user", ctx)
+	}
+
+	if l := LoggerFrom(httptest.NewRequest("GET", "/", nil).Context()); l != logger {
+		t.Error("expected the server logger for a request with no ID")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+// robots.txt, which tells crawlers what they may index.
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DisallowAllRobots is a robots.txt that asks every crawler to stay away, for
+// example from a staging server.
+const DisallowAllRobots = "User-agent: *\nDisallow: /\n"
+
+// robotsTxt serves content as /robots.txt, cached for maxAge. If content is
+// empty, it serves the static/robots.txt asset from static instead.
+func robotsTxt(content string, maxAge time.Duration, static func() *static) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if content == "" {
+			serveStaticAs(w, r, static(), "static/robots.txt")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge/time.Second)))
+		if r.Method == "HEAD" {
+			return
+		}
+		w.Write([]byte(content))
+	})
+}
+
+// serveStaticAs serves the static asset name, like "static/robots.txt", in
+// response to r, which was for a different path.
+func serveStaticAs(w http.ResponseWriter, r *http.Request, s *static, name string) {
+	// Copy the request so the access log shows the original path.
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	u.Path = s.prefix + strings.TrimPrefix(name, "static/")
+	r2.URL = &u
+	s.ServeHTTP(w, r2)
+}
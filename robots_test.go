@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/handlers"
+)
+
+func TestRobotsTxt(t *testing.T) {
+	get := func(c *FileConfig) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		NewServeMux(c).ServeHTTP(w, httptest.NewRequest("GET", "/robots.txt", nil))
+		return w
+	}
+
+	// Production: the bundled asset, which allows everything.
+	c := testConfig()
+	c.StaticCacheMaxAge = Duration{time.Hour}
+	w := get(c)
+	if w.Code != 200 {
+		t.Fatalf("asset: got code %d, want 200", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "User-agent: *\nDisallow:\n") {
+		t.Errorf("asset: got body %q", body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("asset: got Content-Type %q", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Errorf("asset: got Cache-Control %q", cc)
+	}
+
+	// Staging: keep crawlers out.
+	c.RobotsTxt = DisallowAllRobots
+	w = get(c)
+	if w.Code != 200 || w.Body.String() != DisallowAllRobots {
+		t.Errorf("config: got %d %q, want %q", w.Code, w.Body.String(), DisallowAllRobots)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("config: got Content-Type %q", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Errorf("config: got Cache-Control %q", cc)
+	}
+}
+
+func TestRobotsTxtAccessLog(t *testing.T) {
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	buf := new(bytes.Buffer)
+	handlers.Logger.SetHandler(log.StreamHandler(buf, log.LogfmtFormat()))
+
+	w := httptest.NewRecorder()
+	logRequests(NewServeMux(testConfig())).ServeHTTP(w, httptest.NewRequest("GET", "/robots.txt", nil))
+	if w.Code != 200 {
+		t.Fatalf("got code %d, want 200", w.Code)
+	}
+	if !strings.Contains(buf.String(), "path=/robots.txt") {
+		t.Errorf("expected the access log to show /robots.txt, got %q", buf.String())
+	}
+}
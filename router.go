@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/kevinburke/rest"
+)
+
+// router matches request paths against patterns, and calls the handler
+// registered for the path and the request method.
+//
+// A pattern that starts with a slash is a path, like "/users/:id". It matches
+// the whole request path, and each segment that starts with a colon matches
+// any one path segment; handlers can retrieve the value with Param. Any other
+// pattern is a regular expression, like `^/static/`, and the values of its
+// named groups can be retrieved with Param too.
+//
+// If the path matches a route but the method doesn't, the response is a 405
+// with an Allow header listing the methods that are registered for the path.
+//
+// OPTIONS requests for a registered path get a 204 with an Allow header that
+// lists OPTIONS as well. To handle OPTIONS yourself for a path, for example to
+// answer CORS preflight requests, register a route for the OPTIONS method.
+//
+// If no route matches a path, but one would match with the trailing slash
+// removed (or added; see SetTrailingSlash), the request is redirected there.
+type router struct {
+	table *routeTable
+
+	// prefix and middleware are applied to every route registered on this
+	// router. They're set for groups created with Group.
+	prefix     string
+	middleware []func(http.Handler) http.Handler
+}
+
+// routeTable is shared by a router and every group created from it.
+type routeTable struct {
+	routes        []*route
+	trailingSlash TrailingSlash
+	fallback      http.Handler
+}
+
+// TrailingSlash controls which form of a path the router redirects to, when
+// no route matches the requested form.
+type TrailingSlash int
+
+const (
+	// StripTrailingSlash redirects "/about/" to "/about". It's the default.
+	StripTrailingSlash TrailingSlash = iota
+	// AddTrailingSlash redirects "/about" to "/about/".
+	AddTrailingSlash
+)
+
+type route struct {
+	pattern *regexp.Regexp
+	method  string
+	handler http.Handler
+
+	// path is the path pattern, including any group prefix, or the empty
+	// string if the route was registered with a regular expression.
+	path    string
+	name    string
+	sitemap *sitemapEntry
+}
+
+// Name sets the name of the route, so its path can be built with URL. Only
+// routes registered with a path pattern can be named, and names should be
+// unique; if two routes have the same name, URL uses the first.
+func (r *route) Name(name string) *route {
+	if r.path == "" {
+		panic(fmt.Sprintf("router: can't name route %q: only path patterns can be named", r.pattern))
+	}
+	r.name = name
+	return r
+}
+
+func newRouter() *router {
+	return &router{table: new(routeTable)}
+}
+
+// Group returns a router that registers routes on rt, under prefix and wrapped
+// in middleware. Patterns registered on the group match the rest of the path
+// after prefix, and are always anchored to the end of prefix. The first
+// middleware is the outermost, so it sees the request first.
+//
+// A group's middleware runs after any middleware of the router it was created
+// from.
+func (rt *router) Group(prefix string, middleware ...func(http.Handler) http.Handler) *router {
+	mw := make([]func(http.Handler) http.Handler, 0, len(rt.middleware)+len(middleware))
+	mw = append(mw, rt.middleware...)
+	mw = append(mw, middleware...)
+	return &router{
+		table:      rt.table,
+		prefix:     rt.prefix + prefix,
+		middleware: mw,
+	}
+}
+
+// SetTrailingSlash sets the direction of trailing slash redirects for rt and
+// every group that shares its routes.
+func (rt *router) SetTrailingSlash(t TrailingSlash) {
+	rt.table.trailingSlash = t
+}
+
+// Fallback calls h for GET and HEAD requests that don't match any route, on rt
+// or any group that shares its routes, instead of responding with a 404. h
+// can call rest.NotFound for paths it doesn't handle. Requests that would be
+// redirected to add or remove a trailing slash still are.
+func (rt *router) Fallback(h http.Handler) {
+	rt.table.fallback = h
+}
+
+// Get calls h for GET and HEAD requests whose path matches pattern. Get panics
+// if pattern is not a valid regular expression.
+func (rt *router) Get(pattern string, h http.Handler) *route {
+	return rt.Handle("GET", pattern, h)
+}
+
+// Post calls h for POST requests whose path matches pattern. Post panics if
+// pattern is not a valid regular expression.
+func (rt *router) Post(pattern string, h http.Handler) *route {
+	return rt.Handle("POST", pattern, h)
+}
+
+// Put calls h for PUT requests whose path matches pattern. Put panics if
+// pattern is not a valid regular expression.
+func (rt *router) Put(pattern string, h http.Handler) *route {
+	return rt.Handle("PUT", pattern, h)
+}
+
+// Delete calls h for DELETE requests whose path matches pattern. Delete panics
+// if pattern is not a valid regular expression.
+func (rt *router) Delete(pattern string, h http.Handler) *route {
+	return rt.Handle("DELETE", pattern, h)
+}
+
+// Handle calls h for requests with the given method whose path matches
+// pattern. Routes are checked in the order they're registered, and the first
+// match is called. Handle panics if pattern is not a valid regular expression.
+func (rt *router) Handle(method string, pattern string, h http.Handler) *route {
+	var path string
+	if strings.HasPrefix(pattern, "/") {
+		path = rt.prefix + pattern
+		pattern = pathRegexp(path)
+	} else if rt.prefix != "" {
+		pattern = "^" + regexp.QuoteMeta(rt.prefix) + strings.TrimPrefix(pattern, "^")
+	}
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		h = rt.middleware[i](h)
+	}
+	r := &route{
+		pattern: regexp.MustCompile(pattern),
+		method:  strings.ToUpper(method),
+		handler: h,
+		path:    path,
+	}
+	rt.table.routes = append(rt.table.routes, r)
+	return r
+}
+
+// URL returns the path of the route with the given name, with each parameter
+// in the route's path pattern replaced by the next value in params. It's an
+// error if there's no such route, or the number of params doesn't match.
+func (rt *router) URL(name string, params ...string) (string, error) {
+	for _, r := range rt.table.routes {
+		if r.name != name {
+			continue
+		}
+		segments := strings.Split(r.path, "/")
+		n := 0
+		for i, seg := range segments {
+			if !strings.HasPrefix(seg, ":") || len(seg) == 1 {
+				continue
+			}
+			if n < len(params) {
+				segments[i] = url.PathEscape(params[n])
+			}
+			n++
+		}
+		if n != len(params) {
+			return "", fmt.Errorf("route %q has %d parameters, got %d", name, n, len(params))
+		}
+		return strings.Join(segments, "/"), nil
+	}
+	return "", fmt.Errorf("no route named %q", name)
+}
+
+// templateFuncs returns functions for templates that use the routes in rt:
+//
+//	{{ url "user" .ID }}
+//
+// returns the path of the route named "user", like URL.
+func (rt *router) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"url": rt.URL,
+	}
+}
+
+// pathRegexp translates a path pattern like "/users/:id" to a regular
+// expression that matches the whole path, with a named group for each
+// parameter.
+func pathRegexp(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") && len(seg) > 1 {
+			segments[i] = "(?P<" + seg[1:] + ">[^/]+)"
+		} else {
+			segments[i] = regexp.QuoteMeta(seg)
+		}
+	}
+	return "^" + strings.Join(segments, "/") + "$"
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.ToUpper(r.Method)
+	var allowed []string
+	for _, route := range rt.table.routes {
+		if !route.pattern.MatchString(r.URL.Path) {
+			continue
+		}
+		if route.method == method || method == "HEAD" && route.method == "GET" {
+			route.handler.ServeHTTP(w, withParams(r, route.pattern))
+			return
+		}
+		allowed = appendMethod(allowed, route.method)
+	}
+	if len(allowed) == 0 {
+		if path, ok := rt.slashRedirect(r.URL.Path); ok {
+			u := *r.URL
+			u.Path = path
+			code := http.StatusMovedPermanently
+			if method != "GET" && method != "HEAD" {
+				// Keep the method and body.
+				code = http.StatusPermanentRedirect
+			}
+			http.Redirect(w, r, u.RequestURI(), code)
+			return
+		}
+		if rt.table.fallback != nil && (method == "GET" || method == "HEAD") {
+			rt.table.fallback.ServeHTTP(w, r)
+			return
+		}
+		rest.NotFound(w, r)
+		return
+	}
+	if method == "OPTIONS" {
+		w.Header().Set("Allow", strings.Join(appendMethod(allowed, "OPTIONS"), ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	rest.NotAllowed(w, r)
+}
+
+// slashRedirect returns path with the trailing slash removed or added, if a
+// route matches the new path.
+func (rt *router) slashRedirect(path string) (string, bool) {
+	if rt.table.trailingSlash == AddTrailingSlash {
+		if strings.HasSuffix(path, "/") {
+			return "", false
+		}
+		path += "/"
+	} else {
+		if path == "/" || !strings.HasSuffix(path, "/") {
+			return "", false
+		}
+		path = strings.TrimSuffix(path, "/")
+	}
+	// Don't redirect "//example.com/" to "//example.com", which browsers
+	// treat as another host.
+	if strings.HasPrefix(path, "//") {
+		return "", false
+	}
+	for _, route := range rt.table.routes {
+		if route.pattern.MatchString(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// withParams stores the values of the named groups in pattern, matched
+// against the request path, in the request context.
+func withParams(r *http.Request, pattern *regexp.Regexp) *http.Request {
+	names := pattern.SubexpNames()
+	var params map[string]string
+	for i, value := range pattern.FindStringSubmatch(r.URL.Path) {
+		if i == 0 || names[i] == "" {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[names[i]] = value
+	}
+	if params == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), paramsKey, params))
+}
+
+// Param returns the value of the named path parameter in the route that
+// matched the request, or the empty string if there is no such parameter.
+func Param(ctx context.Context, name string) string {
+	params, _ := ctx.Value(paramsKey).(map[string]string)
+	return params[name]
+}
+
+// appendMethod appends method to methods if it's not already there.
+func appendMethod(methods []string, method string) []string {
+	for _, m := range methods {
+		if m == method {
+			return methods
+		}
+	}
+	return append(methods, method)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterMethods(t *testing.T) {
+	r := newRouter()
+	called := false
+	r.Post(`^/users$`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users", nil))
+	if w.Code != http.StatusCreated || !called {
+		t.Errorf("POST /users: got code %d, want 201", w.Code)
+	}
+
+	called = false
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	if called {
+		t.Error("GET /users: POST handler should not be called")
+	}
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /users: got code %d, want 405", w.Code)
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	r := newRouter()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r.Get(`^/$`, ok)
+	r.Get(`^/items$`, ok)
+	r.Post(`^/items$`, ok)
+	r.Delete(`^/items$`, ok)
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		allow  string
+	}{
+		{"POST", "/", 405, "GET"},
+		{"PUT", "/items", 405, "GET, POST, DELETE"},
+		{"POST", "/missing", 404, ""},
+		{"GET", "/missing", 404, ""},
+		{"HEAD", "/", 200, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s: got code %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s: got Allow %q, want %q", tt.method, tt.path, allow, tt.allow)
+		}
+	}
+}
+
+func TestRouterHelpers(t *testing.T) {
+	r := newRouter()
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		method := method
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(method))
+		})
+		switch method {
+		case "GET":
+			r.Get(`^/thing$`, h)
+		case "POST":
+			r.Post(`^/thing$`, h)
+		case "PUT":
+			r.Put(`^/thing$`, h)
+		case "DELETE":
+			r.Delete(`^/thing$`, h)
+		}
+	}
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/thing", nil))
+		if w.Body.String() != method {
+			t.Errorf("%s /thing: got body %q, want %q", method, w.Body.String(), method)
+		}
+	}
+}
+
+func TestRouterGroup(t *testing.T) {
+	r := newRouter()
+	ok := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		})
+	}
+	requireAuth := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+	r.Get(`^/$`, ok("home"))
+	admin := r.Group("/admin", requireAuth)
+	admin.Get(`^$`, ok("admin"))
+	admin.Get(`^/users$`, ok("users"))
+
+	tests := []struct {
+		path string
+		auth string
+		code int
+		body string
+	}{
+		{"/", "", 200, "home"},
+		{"/admin", "", 401, ""},
+		{"/admin/users", "", 401, ""},
+		{"/admin", "secret", 200, "admin"},
+		{"/admin/users", "secret", 200, "users"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("GET %s (auth %q): got code %d, want %d", tt.path, tt.auth, w.Code, tt.code)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("GET %s (auth %q): got body %q, want %q", tt.path, tt.auth, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestRouterNestedGroup(t *testing.T) {
+	r := newRouter()
+	var order []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	api := r.Group("/api", mw("api"))
+	v1 := api.Group("/v1", mw("v1"))
+	v1.Get(`^/ping$`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/ping", nil))
+	if got := strings.Join(order, ","); got != "api,v1,handler" {
+		t.Errorf("got call order %q, want %q", got, "api,v1,handler")
+	}
+}
+
+func TestRouterOptions(t *testing.T) {
+	r := newRouter()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r.Get(`^/items$`, ok)
+	r.Post(`^/items$`, ok)
+	r.Put(`^/items/\d+$`, ok)
+	r.Delete(`^/items/\d+$`, ok)
+	r.Get(`^/cors$`, ok)
+	r.Handle("OPTIONS", `^/cors$`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path  string
+		code  int
+		allow string
+	}{
+		{"/items", 204, "GET, POST, OPTIONS"},
+		{"/items/3", 204, "PUT, DELETE, OPTIONS"},
+		{"/cors", 200, ""},
+		{"/missing", 404, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("OPTIONS", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("OPTIONS %s: got code %d, want %d", tt.path, w.Code, tt.code)
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("OPTIONS %s: got Allow %q, want %q", tt.path, allow, tt.allow)
+		}
+	}
+}
+
+func TestRouterParams(t *testing.T) {
+	r := newRouter()
+	echo := func(names ...string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			values := make([]string, len(names))
+			for i, name := range names {
+				values[i] = Param(r.Context(), name)
+			}
+			w.Write([]byte(strings.Join(values, ",")))
+		})
+	}
+	r.Get("/users/:id", echo("id"))
+	r.Get("/users/:id/posts/:post", echo("id", "post"))
+	r.Get(`^/files/(?P<name>.+)$`, echo("name"))
+	r.Group("/api").Get("/teams/:team", echo("team"))
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/users/42", 200, "42"},
+		{"/users/42/posts/hello-world", 200, "42,hello-world"},
+		{"/files/a/b.txt", 200, "a/b.txt"},
+		{"/api/teams/red", 200, "red"},
+		{"/users", 404, ""},
+		{"/users/42/extra", 404, ""},
+		{"/users/42/posts/", 404, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("GET %s: got code %d, want %d", tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.code == 200 && w.Body.String() != tt.body {
+			t.Errorf("GET %s: got body %q, want %q", tt.path, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestRouterTrailingSlash(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		mode     TrailingSlash
+		register string
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{StripTrailingSlash, "/about", "GET", "/about/", 301, "/about"},
+		{StripTrailingSlash, "/about", "GET", "/about/?x=1", 301, "/about?x=1"},
+		{StripTrailingSlash, "/about", "POST", "/about/", 308, "/about"},
+		{StripTrailingSlash, "/about", "GET", "/about", 200, ""},
+		{StripTrailingSlash, "/about/", "GET", "/about", 404, ""},
+		{StripTrailingSlash, "/about/", "GET", "/about/", 200, ""},
+		{StripTrailingSlash, "/", "GET", "//", 301, "/"},
+		{StripTrailingSlash, "/about", "GET", "//about/", 404, ""},
+		{AddTrailingSlash, "/about/", "GET", "/about", 301, "/about/"},
+		{AddTrailingSlash, "/about/", "GET", "/about/", 200, ""},
+		{AddTrailingSlash, "/about", "GET", "/about/", 404, ""},
+	}
+	for _, tt := range tests {
+		r := newRouter()
+		r.SetTrailingSlash(tt.mode)
+		r.Get(tt.register, ok)
+		r.Post(tt.register, ok)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s (registered %s): got code %d, want %d", tt.method, tt.path, tt.register, w.Code, tt.code)
+		}
+		if loc := w.Header().Get("Location"); loc != tt.location {
+			t.Errorf("%s %s (registered %s): got Location %q, want %q", tt.method, tt.path, tt.register, loc, tt.location)
+		}
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	r := newRouter()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/about", ok).Name("about")
+	r.Get("/users/:id/posts/:post", ok).Name("post")
+	r.Group("/admin").Get("/users/:id", ok).Name("admin-user")
+
+	tests := []struct {
+		name   string
+		params []string
+		want   string
+		err    string
+	}{
+		{"about", nil, "/about", ""},
+		{"post", []string{"42", "hello world"}, "/users/42/posts/hello%20world", ""},
+		{"admin-user", []string{"7"}, "/admin/users/7", ""},
+		{"about", []string{"1"}, "", `route "about" has 0 parameters, got 1`},
+		{"post", []string{"42"}, "", `route "post" has 2 parameters, got 1`},
+		{"missing", nil, "", `no route named "missing"`},
+	}
+	for _, tt := range tests {
+		got, err := r.URL(tt.name, tt.params...)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("URL(%q, %q): got error %v, want %q", tt.name, tt.params, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("URL(%q, %q): %v", tt.name, tt.params, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("URL(%q, %q): got %q, want %q", tt.name, tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestRouterURLTemplate(t *testing.T) {
+	r := newRouter()
+	r.Get("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).Name("user")
+	tpl := template.Must(template.New("t").Funcs(r.templateFuncs()).Parse(`<a href="{{ url "user" .ID }}">`))
+	buf := new(bytes.Buffer)
+	if err := tpl.Execute(buf, map[string]string{"ID": "42"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<a href="/users/42">`; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRouterNameRegexp(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Name to panic for a regexp route")
+		}
+	}()
+	r := newRouter()
+	r.Get(`^/static/`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).Name("static")
+}
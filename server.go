@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevinburke/handlers"
+)
+
+// Server timeouts, if none are configured.
+const (
+	DefaultReadTimeout       = 15 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultShutdownTimeout   = 30 * time.Second
+)
+
+// newServer returns a HTTP server that serves h with the settings in c. Call
+// setupConfig on c first to apply defaults.
+func newServer(c *FileConfig, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              listenAddr(c),
+		Handler:           h,
+		ReadTimeout:       c.ReadTimeout.Duration,
+		WriteTimeout:      c.WriteTimeout.Duration,
+		IdleTimeout:       c.IdleTimeout.Duration,
+		ReadHeaderTimeout: c.ReadHeaderTimeout.Duration,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+}
+
+// listenAddr returns the host:port address to listen on for c.
+func listenAddr(c *FileConfig) string {
+	return net.JoinHostPort(c.BindAddress, strconv.Itoa(*c.Port))
+}
+
+// listen returns a listener for the server: the socket passed by systemd, if
+// the server was started with socket activation, a Unix socket if c.UnixSocket
+// is set, or a TCP socket on listenAddr(c) otherwise. A stale socket file left
+// over from a previous process is removed first.
+func listen(c *FileConfig) (net.Listener, error) {
+	if ln, err := inheritedListener(); ln != nil || err != nil {
+		if ln != nil {
+			logger.Info("Using socket from systemd", "addr", ln.Addr().String())
+		}
+		return ln, err
+	}
+	if c.UnixSocket != "" {
+		if err := os.Remove(c.UnixSocket); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", c.UnixSocket)
+	}
+	return net.Listen("tcp", listenAddr(c))
+}
+
+// boundPort returns the TCP port ln is listening on, or 0 if it's not a TCP
+// listener. If the server was configured with port 0, this is the port that
+// was chosen.
+func boundPort(ln net.Listener) int {
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
+
+// writePortFile writes port to filename, followed by a newline. The file is
+// written to a temporary file and renamed, so readers never see a partial
+// port.
+func writePortFile(filename string, port int) error {
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(port)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// serve accepts connections on ln and serves them with srv. Connections use
+// TLS unless c.HTTPOnly is set; if srv.TLSConfig is nil, the certificate is
+// loaded from c.CertFile and c.KeyFile.
+func serve(srv *http.Server, ln net.Listener, c *FileConfig) error {
+	if c.HTTPOnly {
+		return srv.Serve(ln)
+	}
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.ServeTLS(ln, c.CertFile, c.KeyFile)
+}
+
+// shutdown stops srv from accepting new connections, and waits up to timeout
+// for requests in flight to finish. If the timeout expires first, shutdown
+// closes the remaining connections and returns context.DeadlineExceeded.
+func shutdown(srv *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		logger.Warn("Requests still running after the shutdown timeout; closing connections", "timeout", timeout)
+		srv.Close()
+	}
+	return err
+}
+
+// newRedirectServer returns a HTTP server that listens on c.HTTPPort and
+// redirects every request to the HTTPS server. If m is not nil, m answers
+// certificate challenges before requests are redirected.
+func newRedirectServer(c *FileConfig, m certManager) *http.Server {
+	h := redirectHandler(*c.Port)
+	if m != nil {
+		h = m.HTTPHandler(h)
+	}
+	return &http.Server{
+		Addr:              net.JoinHostPort(c.BindAddress, strconv.Itoa(c.HTTPPort)),
+		Handler:           h,
+		ReadTimeout:       c.ReadTimeout.Duration,
+		WriteTimeout:      c.WriteTimeout.Duration,
+		IdleTimeout:       c.IdleTimeout.Duration,
+		ReadHeaderTimeout: c.ReadHeaderTimeout.Duration,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+}
+
+// redirectHandler permanently redirects requests to the same host, path and
+// query on tlsPort, over HTTPS. Any port in the Host header is replaced.
+func redirectHandler(tlsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			// No port in the Host header.
+			host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		}
+		if tlsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(tlsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// A Server serves the site with the settings in a config. Create one with New.
+type Server struct {
+	config   *FileConfig
+	handler  http.Handler
+	srv      *http.Server
+	redirect *http.Server
+	drain    *drainer
+}
+
+// New applies defaults to c, validates it, and returns a Server for it. c and
+// its secret key become the live config, returned by currentConfig and
+// currentKey.
+func New(c *FileConfig) (*Server, error) {
+	key, err := setupConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	// You can use the secret key with Encrypt and Decrypt in crypto.go, which
+	// use secretbox (godoc.org/golang.org/x/crypto/nacl/secretbox/), to
+	// generate cookies and secrets. See session.go and flash.go for examples.
+	// Handlers should call currentKey() to get it, since the key can change
+	// when the config is reloaded.
+	setLive(c, key)
+
+	drain := new(drainer)
+	mux := NewServeMux(c)
+	mux = withCSRF(mux)                                        // check CSRF tokens on POST, PUT, etc.
+	mux = withSession(mux, newSessionStore(c))                 // decode and save the session
+	mux = withTimeout(mux)                                     // cancel requests that take too long
+	mux = withClientSubject(mux)                               // add client cert subject to context
+	mux = withCORS(mux)                                        // add CORS headers and answer preflight requests
+	mux = withRateLimit(mux)                                   // limit requests per client IP
+	mux = withBodyLimit(mux)                                   // limit the size of request bodies
+	mux = handlers.Server(mux, "go-html-boilerplate/"+version) // add Server header
+	mux = withClientIP(mux)                                    // find the client IP behind trusted proxies
+	mux = withByteCounts(mux)                                  // log request and response sizes
+	mux = withTLSInfo(mux)                                     // log the TLS version and cipher suite
+	mux = drain.wrap(mux)                                      // reject new requests during shutdown
+	mux = logRequests(mux)                                     // log requests/responses
+	mux = withRequestID(mux)                                   // add X-Request-Id header and request logger
+	mux = handlers.Duration(mux)                               // add Duration header
+	mux = withServerWriter(mux)                                // let handlers flush and hijack the connection
+	// Only the http.Server's ResponseWriter can send 103 Early Hints, so the
+	// handler returned by Handler doesn't.
+	s := &Server{config: c, handler: mux, srv: newServer(c, withEarlyHints(mux)), drain: drain}
+
+	var m certManager
+	if c.AutoTLS.Enabled() {
+		m = newCertManager(c)
+	}
+	if !c.HTTPOnly {
+		var certs certSource = m
+		if m == nil {
+			store, err := newCertStore(c)
+			if err != nil {
+				return nil, fmt.Errorf("loading certificates: %v", err)
+			}
+			store.watch(DefaultCertPollInterval)
+			certs = store
+		}
+		s.srv.TLSConfig, err = newTLSConfig(c, certs)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS config: %v", err)
+		}
+	}
+	if c.RedirectHTTP || c.AutoTLS.Enabled() {
+		s.redirect = newRedirectServer(c, m)
+	}
+	return s, nil
+}
+
+// Handler returns the handler for every request to the server, including the
+// middleware for sessions, logging and so on.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Run listens on the configured port or socket and serves requests until ctx
+// is done. Then it stops accepting connections, responds to new requests on
+// open connections with a 503, waits up to shutdown_timeout for requests in
+// flight to finish, and returns nil. Closing the listener also removes the
+// Unix socket file, if there is one.
+func (s *Server) Run(ctx context.Context) error {
+	c := s.config
+	ln, err := listen(c)
+	if err != nil {
+		return err
+	}
+	if s.redirect != nil {
+		go func() {
+			logger.Info("Started HTTP redirect server", "addr", s.redirect.Addr)
+			if err := s.redirect.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Error("HTTP redirect server shut down", "err", err)
+			}
+		}()
+	}
+	// failed is closed if Run returns an error before ctx is done, so the
+	// goroutine below stops waiting and the redirect server is closed.
+	failed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+		case <-failed:
+			if s.redirect != nil {
+				s.redirect.Close()
+			}
+			return
+		}
+		// Use the current config, since shutdown_timeout can be reloaded.
+		timeout := currentConfig().ShutdownTimeout.Duration
+		logger.Info("Shutting down; waiting for requests to finish", "timeout", timeout)
+		s.drain.start()
+		if s.redirect != nil {
+			go shutdown(s.redirect, timeout)
+		}
+		if err := shutdown(s.srv, timeout); err != nil {
+			logger.Error("Error shutting down", "err", err)
+		}
+	}()
+	port := boundPort(ln)
+	b := getBuildInfo()
+	logger.Info("Started server", "addr", ln.Addr().String(), "port", port, "version", b.Version, "commit", b.Commit)
+	if c.PortFile != "" && c.UnixSocket == "" {
+		if err := writePortFile(c.PortFile, port); err != nil {
+			ln.Close()
+			close(failed)
+			<-done
+			return fmt.Errorf("writing port file: %v", err)
+		}
+		defer os.Remove(c.PortFile)
+	}
+	if err := serve(s.srv, ln, c); err != http.ErrServerClosed {
+		close(failed)
+		<-done
+		return err
+	}
+	// Serve returns as soon as shutdown starts; wait for it to finish.
+	<-done
+	return nil
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecretKey = "d7211b215341871968869d0e3f48ac0ff1789fc88e0ac6e296ba36703edf8ab1"
+
+// testConfig returns a config for a plain HTTP server with a fixed secret key,
+// so tests don't generate and save a key to disk.
+func testConfig() *FileConfig {
+	return &FileConfig{HTTPOnly: true, SecretKey: testSecretKey}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	c := new(FileConfig)
+	data := []byte("http_only: true\nread_timeout: 5s\nwrite_timeout: 1m30s\nsecret_key: " + testSecretKey)
+	if err := parseConfig("config.yml", data, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(c, NewServeMux(c))
+	if srv.ReadTimeout != 5*time.Second {
+		t.Errorf("ReadTimeout: got %v, want 5s", srv.ReadTimeout)
+	}
+	if srv.WriteTimeout != 90*time.Second {
+		t.Errorf("WriteTimeout: got %v, want 1m30s", srv.WriteTimeout)
+	}
+}
+
+func TestNewServerDefaultTimeouts(t *testing.T) {
+	c := testConfig()
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(c, NewServeMux(c))
+	if srv.ReadTimeout != DefaultReadTimeout {
+		t.Errorf("ReadTimeout: got %v, want %v", srv.ReadTimeout, DefaultReadTimeout)
+	}
+	if srv.WriteTimeout != DefaultWriteTimeout {
+		t.Errorf("WriteTimeout: got %v, want %v", srv.WriteTimeout, DefaultWriteTimeout)
+	}
+	if srv.IdleTimeout != DefaultIdleTimeout {
+		t.Errorf("IdleTimeout: got %v, want %v", srv.IdleTimeout, DefaultIdleTimeout)
+	}
+	if srv.ReadHeaderTimeout != DefaultReadHeaderTimeout {
+		t.Errorf("ReadHeaderTimeout: got %v, want %v", srv.ReadHeaderTimeout, DefaultReadHeaderTimeout)
+	}
+	if c.ShutdownTimeout.Duration != DefaultShutdownTimeout {
+		t.Errorf("ShutdownTimeout: got %v, want %v", c.ShutdownTimeout, DefaultShutdownTimeout)
+	}
+}
+
+func TestReadHeaderTimeoutClosesSlowClients(t *testing.T) {
+	c := testConfig()
+	c.ReadHeaderTimeout.Duration = 100 * time.Millisecond
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(c, NewServeMux(c))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Send part of the headers, then stall.
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Fatalf("expected the server to close the connection, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("server took %v to close the connection", elapsed)
+	}
+}
+
+func TestParseDurationFormats(t *testing.T) {
+	tests := []struct {
+		filename string
+		data     string
+	}{
+		{"config.json", `{"read_timeout": "5s"}`},
+		{"config.toml", `read_timeout = "5s"`},
+		{"config.yml", `read_timeout: 5s`},
+	}
+	for _, tt := range tests {
+		c := new(FileConfig)
+		if err := parseConfig(tt.filename, []byte(tt.data), c); err != nil {
+			t.Errorf("%s: %v", tt.filename, err)
+			continue
+		}
+		if c.ReadTimeout.Duration != 5*time.Second {
+			t.Errorf("%s: got %v, want 5s", tt.filename, c.ReadTimeout)
+		}
+	}
+	c := new(FileConfig)
+	if err := parseConfig("config.yml", []byte("read_timeout: soon"), c); err == nil {
+		t.Error("expected an error for an invalid duration, got nil")
+	}
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	c := testConfig()
+	data := []byte("max_header_bytes: 1024\n")
+	if err := parseConfig("config.yml", data, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(c, NewServeMux(c))
+	if srv.MaxHeaderBytes != 1024 {
+		t.Fatalf("MaxHeaderBytes: got %d, want 1024", srv.MaxHeaderBytes)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	get := func(cookie string) int {
+		req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/", nil)
+		req.Header.Set("Cookie", cookie)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := get("a=b"); code != 200 {
+		t.Errorf("small headers: got code %d, want 200", code)
+	}
+	// net/http allows some slack over MaxHeaderBytes, so go well over it.
+	if code := get("a=" + strings.Repeat("b", 16*1024)); code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("large headers: got code %d, want 431", code)
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	tests := []struct {
+		bind string
+		want string
+	}{
+		{"", ":7065"},
+		{"0.0.0.0", "0.0.0.0:7065"},
+		{"10.0.0.5", "10.0.0.5:7065"},
+		{"::1", "[::1]:7065"},
+	}
+	for _, tt := range tests {
+		c := testConfig()
+		c.BindAddress = tt.bind
+		port := 7065
+		c.Port = &port
+		if err := c.Validate(); err != nil {
+			t.Errorf("%q: %v", tt.bind, err)
+		}
+		if got := newServer(c, nil).Addr; got != tt.want {
+			t.Errorf("%q: got addr %q, want %q", tt.bind, got, tt.want)
+		}
+	}
+	c := testConfig()
+	c.BindAddress = "not-an-ip"
+	if err := c.Validate(); err == nil {
+		t.Error("expected an error for an invalid bind_address, got nil")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := testConfig()
+	c.UnixSocket = filepath.Join(dir, "server.sock")
+	// A stale socket file should be removed on startup.
+	if err := ioutil.WriteFile(c.UnixSocket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(c, NewServeMux(c))
+	ln, err := listen(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", c.UnixSocket)
+			},
+		},
+	}
+	res, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("GET /: got code %d, want 200", res.StatusCode)
+	}
+	if !strings.Contains(string(body), "Hello World") {
+		t.Errorf("GET /: expected 'Hello World' in body, got %s", body)
+	}
+
+	srv.Close()
+	if _, err := os.Stat(c.UnixSocket); !os.IsNotExist(err) {
+		t.Errorf("expected socket file to be removed on close, got %v", err)
+	}
+}
+
+func TestServePlainHTTP(t *testing.T) {
+	c := testConfig()
+	c.BindAddress = "127.0.0.1"
+	port := 0
+	c.Port = &port
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(c, NewServeMux(c))
+	ln, err := listen(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(srv, ln, c)
+	defer srv.Close()
+
+	res, err := http.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("GET /: got code %d, want 200", res.StatusCode)
+	}
+	if res.TLS != nil {
+		t.Error("expected a plain HTTP response, got TLS")
+	}
+	// Push isn't available over HTTP/1, so the resource should be preloaded.
+	styleURL, err := newStatic(embedded{}, time.Now(), time.Hour).URL("style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link, want := res.Header.Get("Link"), "<"+styleURL+">; rel=preload; as=style"; link != want {
+		t.Errorf("Link header: got %q, want %q", link, want)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		port   int
+		host   string
+		target string
+		want   string
+	}{
+		{443, "example.com", "/", "https://example.com/"},
+		{443, "example.com:80", "/a/b?c=d&e=f", "https://example.com/a/b?c=d&e=f"},
+		{7065, "example.com:8080", "/foo?bar=baz", "https://example.com:7065/foo?bar=baz"},
+		{7065, "[::1]:8080", "/", "https://[::1]:7065/"},
+		{443, "[::1]", "/", "https://[::1]/"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		req.Host = tt.host
+		w := httptest.NewRecorder()
+		redirectHandler(tt.port).ServeHTTP(w, req)
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("%s%s: got code %d, want 301", tt.host, tt.target, w.Code)
+		}
+		if loc := w.Header().Get("Location"); loc != tt.want {
+			t.Errorf("%s%s: got Location %q, want %q", tt.host, tt.target, loc, tt.want)
+		}
+	}
+}
+
+func TestRedirectServer(t *testing.T) {
+	c := testConfig()
+	c.HTTPOnly = false
+	c.RedirectHTTP = true
+	port := 8443
+	c.Port = &port
+	if err := c.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if c.HTTPPort != 80 {
+		t.Errorf("HTTPPort: got %d, want default 80", c.HTTPPort)
+	}
+	s := httptest.NewServer(newRedirectServer(c, nil).Handler)
+	defer s.Close()
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get(s.URL + "/static/style.css?v=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("got code %d, want 301", res.StatusCode)
+	}
+	if loc := res.Header.Get("Location"); loc != "https://127.0.0.1:8443/static/style.css?v=1" {
+		t.Errorf("got Location %q", loc)
+	}
+}
+
+func TestShutdownWaitsForRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("finished"))
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	go srv.Serve(ln)
+
+	type result struct {
+		body string
+		err  error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		res, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		inFlight <- result{string(body), err}
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- shutdown(srv, 5*time.Second) }()
+	// Wait for the listener to close.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("server still accepting connections after shutdown started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("shutdown returned before the request finished: %v", err)
+	default:
+	}
+
+	close(release)
+	if r := <-inFlight; r.err != nil || r.body != "finished" {
+		t.Errorf("in-flight request: got %q, %v, want it to finish", r.body, r.err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	c := testConfig()
+	data := []byte("shutdown_timeout: 100ms\n")
+	if err := parseConfig("config.yml", data, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.ShutdownTimeout.Duration != 100*time.Millisecond {
+		t.Fatalf("ShutdownTimeout: got %v, want 100ms", c.ShutdownTimeout)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv := newServer(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	clientErr := make(chan error, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err == nil {
+			res.Body.Close()
+		}
+		clientErr <- err
+	}()
+	<-started
+
+	start := time.Now()
+	if err := shutdown(srv, c.ShutdownTimeout.Duration); err != context.DeadlineExceeded {
+		t.Errorf("shutdown: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("shutdown took %v, want about 100ms", elapsed)
+	}
+	select {
+	case err := <-clientErr:
+		if err == nil {
+			t.Error("expected the slow request's connection to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("slow request still open after shutdown")
+	}
+}
+
+func TestRandomPort(t *testing.T) {
+	c := testConfig()
+	c.BindAddress = "127.0.0.1"
+	port := 0
+	c.Port = &port
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listen(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(c, NewServeMux(c))
+	go serve(srv, ln, c)
+	defer srv.Close()
+
+	got := boundPort(ln)
+	if got == 0 {
+		t.Fatal("expected a port to be chosen, got 0")
+	}
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	portFile := filepath.Join(dir, "port")
+	if err := writePortFile(portFile, got); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(portFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != strconv.Itoa(got)+"\n" {
+		t.Errorf("port file: got %q, want %d", data, got)
+	}
+
+	res, err := http.Get("http://127.0.0.1:" + strings.TrimSpace(string(data)) + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("GET /healthz on port %d: got code %d, want 200", got, res.StatusCode)
+	}
+}
+
+func TestServerHandler(t *testing.T) {
+	defer live.Store(getLive())
+	s, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 {
+		t.Errorf("GET /: got code %d, want 200", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Hello World") {
+		t.Errorf("GET /: expected 'Hello World' in body, got %s", body)
+	}
+	// The middleware runs too.
+	if w.Header().Get(RequestIDHeader) == "" {
+		t.Error("expected a X-Request-Id header")
+	}
+	if server := w.Header().Get("Server"); server != "go-html-boilerplate/"+Version {
+		t.Errorf("Server header: got %q", server)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.SecretKey = "abc"
+	if _, err := New(c); err == nil {
+		t.Error("expected an error for an invalid config, got nil")
+	}
+}
+
+func TestServerRun(t *testing.T) {
+	defer live.Store(getLive())
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := testConfig()
+	c.BindAddress = "127.0.0.1"
+	port := 0
+	c.Port = &port
+	c.PortFile = filepath.Join(dir, "port")
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run(ctx) }()
+
+	var data []byte
+	for i := 0; i < 500; i++ {
+		if data, err = ioutil.ReadFile(c.PortFile); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("server didn't write the port file: %v", err)
+	}
+	res, err := http.Get("http://127.0.0.1:" + strings.TrimSpace(string(data)) + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("GET /: got code %d, want 200", res.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after the context was canceled")
+	}
+	if _, err := os.Stat(c.PortFile); !os.IsNotExist(err) {
+		t.Errorf("expected the port file to be removed, got %v", err)
+	}
+}
+
+func TestServerRunFails(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.BindAddress = "127.0.0.1"
+	port := 0
+	c.Port = &port
+	c.PortFile = filepath.Join("does-not-exist", "port")
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.redirect = &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Run(ctx); err == nil {
+		t.Fatal("expected an error writing the port file, got nil")
+	}
+	// A closed server can't be started again.
+	redirectErr := make(chan error, 1)
+	go func() { redirectErr <- s.redirect.ListenAndServe() }()
+	select {
+	case err := <-redirectErr:
+		if err != http.ErrServerClosed {
+			t.Errorf("redirect server: got %v, want %v", err, http.ErrServerClosed)
+		}
+	case <-time.After(time.Second):
+		s.redirect.Close()
+		t.Error("expected the redirect server to be closed")
+	}
+}
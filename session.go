@@ -0,0 +1,241 @@
+package main
+
+// Sessions stored in an encrypted cookie, or in a SessionStore with the
+// session ID in the cookie.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// DefaultSessionMaxAge is how long a session lasts after it was last saved.
+const DefaultSessionMaxAge = 30 * 24 * time.Hour
+
+const sessionCookie = "session"
+
+// Session holds values for a single client across requests. Values are
+// encoded as JSON, so numbers come back as float64 and structs as maps.
+type Session map[string]interface{}
+
+// sessionData is the payload sealed in the session cookie.
+type sessionData struct {
+	Expires int64   `json:"e"`
+	Values  Session `json:"v"`
+}
+
+// GetSession returns the session for r, or nil if the request didn't go
+// through withSession. Changes to the session are saved when the response is
+// written.
+func GetSession(r *http.Request) Session {
+	return sessionFromContext(r.Context())
+}
+
+func sessionFromContext(ctx context.Context) Session {
+	s, _ := ctx.Value(sessionKey).(*sessionState)
+	if s == nil {
+		return nil
+	}
+	return s.values
+}
+
+// sessionState tracks a request's session so it can be saved if it changes.
+type sessionState struct {
+	values Session
+	// original is the JSON encoding of values when the request started.
+	original []byte
+	key      *[32]byte
+	secure   bool
+	// store and id are set if the session is kept in a SessionStore.
+	store SessionStore
+	id    string
+}
+
+// withSession decodes the session into the request context, and saves it
+// when the response is written if a handler changed the session. A missing,
+// tampered or expired cookie starts a new, empty session.
+//
+// If store is nil, the session values are kept in the cookie. Otherwise they
+// are kept in store, and the cookie only holds the session ID.
+//
+// The cookie is sealed with the current secret key, and is only sent over
+// HTTPS unless the server is configured with http_only. Cookies sealed with
+// one of the fallback keys in secret_keys are still accepted, and are sealed
+// again with the current key.
+func withSession(h http.Handler, store SessionStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := currentKeys()
+		if keys == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		s := &sessionState{key: keys[0], store: store}
+		var oldKey bool
+		if store == nil {
+			s.values, oldKey = readSession(r, keys, time.Now())
+		} else {
+			s.id, s.values, oldKey = readStoredSession(r, keys, store)
+		}
+		if c := currentConfig(); c != nil {
+			s.secure = !c.HTTPOnly
+		}
+		// Leave original empty for a cookie sealed with an old key, so the
+		// session is saved with the current one.
+		if !oldKey {
+			s.original, _ = json.Marshal(s.values)
+		}
+		sw := &sessionWriter{ResponseWriter: w, session: s, log: LoggerFrom(r.Context())}
+		h.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), sessionKey, s)))
+		// Save the session even if the handler never wrote a body.
+		sw.save()
+	})
+}
+
+// readSessionCookie decrypts r's session cookie with the first of keys that
+// works, and reports whether that was one of the older keys.
+func readSessionCookie(r *http.Request, keys []*[32]byte) ([]byte, bool, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, false, err
+	}
+	b, err := Decrypt(keys[0], cookie.Value)
+	if err == nil || len(keys) == 1 {
+		return b, false, err
+	}
+	b, err = DecryptAny(keys[1:], cookie.Value)
+	return b, err == nil, err
+}
+
+// readSession returns the values in r's session cookie, or an empty session if
+// the cookie is missing or invalid. The bool is true if the cookie was sealed
+// with an older key.
+func readSession(r *http.Request, keys []*[32]byte, now time.Time) (Session, bool) {
+	b, oldKey, err := readSessionCookie(r, keys)
+	if err != nil {
+		return Session{}, false
+	}
+	data := new(sessionData)
+	if err := json.Unmarshal(b, data); err != nil || data.Values == nil {
+		return Session{}, false
+	}
+	if now.Unix() >= data.Expires {
+		return Session{}, false
+	}
+	return data.Values, oldKey
+}
+
+// readStoredSession returns the session ID in r's session cookie and the
+// session for that ID in store. If the cookie is invalid or the session
+// doesn't exist, it returns a new ID and an empty session. The bool is true if
+// the cookie was sealed with an older key.
+func readStoredSession(r *http.Request, keys []*[32]byte, store SessionStore) (string, Session, bool) {
+	b, oldKey, err := readSessionCookie(r, keys)
+	if err != nil {
+		return newSessionID(), Session{}, false
+	}
+	id := string(b)
+	values, err := store.Get(id)
+	if err != nil {
+		LoggerFrom(r.Context()).Error("Couldn't load session", "err", err)
+	}
+	if values == nil {
+		// Don't reuse the ID; it may have been set by an attacker.
+		return newSessionID(), Session{}, false
+	}
+	return id, values, oldKey
+}
+
+// sessionCookieFor returns a cookie holding values, sealed with key.
+func sessionCookieFor(values Session, key *[32]byte, secure bool, now time.Time) (*http.Cookie, error) {
+	b, err := json.Marshal(sessionData{Expires: now.Add(DefaultSessionMaxAge).Unix(), Values: values})
+	if err != nil {
+		return nil, err
+	}
+	value, err := Encrypt(key, b)
+	if err != nil {
+		return nil, err
+	}
+	return newSessionCookie(value, secure, now), nil
+}
+
+// newSessionCookie returns a session cookie with the given value.
+func newSessionCookie(value string, secure bool, now time.Time) *http.Cookie {
+	expires := now.Add(DefaultSessionMaxAge)
+	return &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		Value:    value,
+		Expires:  expires,
+		MaxAge:   int(DefaultSessionMaxAge / time.Second),
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// sessionWriter sets the session cookie before the first byte of the response
+// is written, since headers can't change after that.
+type sessionWriter struct {
+	http.ResponseWriter
+	session *sessionState
+	saved   bool
+	log     log.Logger
+}
+
+func (w *sessionWriter) save() {
+	if w.saved {
+		return
+	}
+	w.saved = true
+	s := w.session
+	b, err := json.Marshal(s.values)
+	if err != nil {
+		w.log.Error("Couldn't encode session", "err", err)
+		return
+	}
+	if bytes.Equal(b, s.original) {
+		return
+	}
+	if s.store != nil {
+		if err := s.store.Save(s.id, s.values, DefaultSessionMaxAge); err != nil {
+			w.log.Error("Couldn't save session", "err", err)
+			return
+		}
+		http.SetCookie(w.ResponseWriter, newSessionCookie(opaque(s.id, s.key), s.secure, time.Now()))
+		return
+	}
+	cookie, err := sessionCookieFor(s.values, s.key, s.secure, time.Now())
+	if err != nil {
+		w.log.Error("Couldn't encode session", "err", err)
+		return
+	}
+	http.SetCookie(w.ResponseWriter, cookie)
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.save()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.save()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionWriter) Flush() {
+	w.save()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *sessionWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newSessionHandler returns a handler that stores the "n" query parameter in
+// the session if it's set, and writes the session's current "n" value.
+func newSessionHandler(store SessionStore) http.Handler {
+	return withSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := GetSession(r)
+		if n := r.URL.Query().Get("n"); n != "" {
+			s["n"] = n
+		}
+		if n, ok := s["n"].(string); ok {
+			w.Write([]byte(n))
+		}
+	}), store)
+}
+
+var sessionHandler = newSessionHandler(nil)
+
+func sessionRequest(target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	return sessionRequestTo(sessionHandler, target, cookie)
+}
+
+func sessionRequestTo(h http.Handler, target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func getSessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookie {
+			return c
+		}
+	}
+	t.Fatal("expected a session cookie on the response")
+	return nil
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	defer live.Store(getLive())
+	setLive(testConfig(), NewRandomKey())
+
+	cookie := getSessionCookie(t, sessionRequest("/?n=hello", nil))
+	w := sessionRequest("/", cookie)
+	if body := w.Body.String(); body != "hello" {
+		t.Errorf("got session value %q, want hello", body)
+	}
+	// The session didn't change, so it shouldn't be written again.
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("expected no cookie for an unchanged session, got %v", w.Result().Cookies())
+	}
+}
+
+func TestSessionTampered(t *testing.T) {
+	defer live.Store(getLive())
+	setLive(testConfig(), NewRandomKey())
+
+	cookie := getSessionCookie(t, sessionRequest("/?n=hello", nil))
+	b := []byte(cookie.Value)
+	if b[40] == 'A' {
+		b[40] = 'B'
+	} else {
+		b[40] = 'A'
+	}
+	cookie.Value = string(b)
+	if body := sessionRequest("/", cookie).Body.String(); body != "" {
+		t.Errorf("expected a fresh session for a tampered cookie, got %q", body)
+	}
+
+	// A cookie sealed with another key is also rejected.
+	other, err := sessionCookieFor(Session{"n": "hello"}, NewRandomKey(), false, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := sessionRequest("/", other).Body.String(); body != "" {
+		t.Errorf("expected a fresh session for a cookie with the wrong key, got %q", body)
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	key := NewRandomKey()
+	defer live.Store(getLive())
+	setLive(testConfig(), key)
+
+	cookie, err := sessionCookieFor(Session{"n": "hello"}, key, false, time.Now().Add(-DefaultSessionMaxAge-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := sessionRequest("/", cookie).Body.String(); body != "" {
+		t.Errorf("expected a fresh session for an expired cookie, got %q", body)
+	}
+}
+
+func TestSessionCookieFlags(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.HTTPOnly = false
+	setLive(c, NewRandomKey())
+
+	cookie := getSessionCookie(t, sessionRequest("/?n=hello", nil))
+	if !cookie.Secure {
+		t.Error("expected the session cookie to be Secure")
+	}
+	if !cookie.HttpOnly {
+		t.Error("expected the session cookie to be HttpOnly")
+	}
+
+	// Plain HTTP servers can't use Secure cookies.
+	setLive(testConfig(), NewRandomKey())
+	if cookie := getSessionCookie(t, sessionRequest("/?n=hello", nil)); cookie.Secure {
+		t.Error("expected the session cookie not to be Secure with http_only")
+	}
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	defer live.Store(getLive())
+	oldHex := testSecretKey
+	newHex := "4a8ec1b6e3f0d25a7c9b18e4f6a3d0c2b5e8f1a4d7c0b3e6f9a2d5c8b1e4f7a0"
+	c := testConfig()
+	c.SecretKey = ""
+	c.SecretKeys = []string{oldHex}
+	key, err := setupConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, store := range []SessionStore{nil, newMemoryStore()} {
+		h := newSessionHandler(store)
+		setLive(c, key)
+		oldCookie := getSessionCookie(t, sessionRequestTo(h, "/?n=hello", nil))
+
+		// Rotate: the new key goes first, and the old key is kept for
+		// decryption.
+		rotated := testConfig()
+		rotated.SecretKey = ""
+		rotated.SecretKeys = []string{newHex, oldHex}
+		newKey, err := setupConfig(rotated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setLive(rotated, newKey)
+
+		w := sessionRequestTo(h, "/", oldCookie)
+		if body := w.Body.String(); body != "hello" {
+			t.Errorf("store %T: cookie sealed with the old key: got %q, want hello", store, body)
+		}
+		// The cookie is sealed again with the new key.
+		newCookie := getSessionCookie(t, w)
+		if _, err := Decrypt(newKey, newCookie.Value); err != nil {
+			t.Errorf("store %T: expected the new cookie to use the new key: %v", store, err)
+		}
+		if _, err := Decrypt(key, newCookie.Value); err == nil {
+			t.Errorf("store %T: expected the new cookie not to open with the old key", store)
+		}
+		if body := sessionRequestTo(h, "/", newCookie).Body.String(); body != "hello" {
+			t.Errorf("store %T: cookie sealed with the new key: got %q, want hello", store, body)
+		}
+
+		// Once the old key is removed, its cookies are rejected.
+		rotated.SecretKeys = rotated.SecretKeys[:1]
+		setLive(rotated, newKey)
+		if body := sessionRequestTo(h, "/", oldCookie).Body.String(); body != "" {
+			t.Errorf("store %T: expected the old key to be rejected after removal, got %q", store, body)
+		}
+	}
+}
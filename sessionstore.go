@@ -0,0 +1,289 @@
+package main
+
+// Server-side storage for sessions.
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A SessionStore keeps session values on the server, keyed by a random session
+// ID. The session cookie only holds the ID.
+type SessionStore interface {
+	// Get returns the session with the given ID, or nil if there is no such
+	// session or it has expired.
+	Get(id string) (Session, error)
+	// Save stores s under id. The session expires after maxAge.
+	Save(id string, s Session, maxAge time.Duration) error
+	// Delete removes the session with the given ID, if it exists.
+	Delete(id string) error
+}
+
+// DefaultRedisAddr is the Redis server for the "redis" session store if no
+// RedisAddr is configured.
+const DefaultRedisAddr = "localhost:6379"
+
+// newSessionStore returns the store configured in c, or nil if sessions are
+// kept in the cookie.
+func newSessionStore(c *FileConfig) SessionStore {
+	switch c.SessionStore {
+	case "memory":
+		return newMemoryStore()
+	case "redis":
+		return newRedisStore(c.RedisAddr)
+	default:
+		return nil
+	}
+}
+
+// newSessionID returns a random, URL-safe session ID.
+func newSessionID() string {
+	b := make([]byte, 24)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeSession decodes a session saved by a store. Sessions are stored as
+// JSON, like in the cookie, so values read back the same way from every
+// store.
+func decodeSession(b []byte) (Session, error) {
+	var s Session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// memorySweepInterval is how often a memoryStore removes expired sessions.
+const memorySweepInterval = time.Minute
+
+// memoryStore keeps sessions in memory. Sessions are lost when the server
+// restarts, and aren't shared between servers.
+type memoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{sessions: make(map[string]memorySession), now: time.Now}
+}
+
+func (m *memoryStore) Get(id string) (Session, error) {
+	m.mu.Lock()
+	ms, ok := m.sessions[id]
+	if ok && !m.now().Before(ms.expires) {
+		delete(m.sessions, id)
+		ok = false
+	}
+	m.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	return decodeSession(ms.data)
+}
+
+func (m *memoryStore) Save(id string, s Session, maxAge time.Duration) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sessions[id] = memorySession{data: b, expires: now.Add(maxAge)}
+	// Abandoned sessions are never read again, so clean them up here.
+	if now.Sub(m.lastSweep) >= memorySweepInterval {
+		for id, ms := range m.sessions {
+			if !now.Before(ms.expires) {
+				delete(m.sessions, id)
+			}
+		}
+		m.lastSweep = now
+	}
+	return nil
+}
+
+func (m *memoryStore) Delete(id string) error {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	return nil
+}
+
+// redisKeyPrefix is prepended to session IDs to get their Redis key.
+const redisKeyPrefix = "session:"
+
+// redisMaxIdle is how many idle connections a redisStore keeps open.
+const redisMaxIdle = 8
+
+// redisStore keeps sessions in Redis, so they survive restarts and can be
+// shared between servers. It speaks just enough of the Redis protocol to get,
+// set and delete keys. Each command takes a connection from a pool of idle
+// ones, or opens a new one, so concurrent requests don't wait on each other.
+type redisStore struct {
+	addr string
+	dial func(addr string) (net.Conn, error)
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+// redisConn is a connection to Redis and a reader for its replies.
+type redisConn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+func newRedisStore(addr string) *redisStore {
+	return &redisStore{addr: addr, dial: func(addr string) (net.Conn, error) {
+		return net.DialTimeout("tcp", addr, 5*time.Second)
+	}}
+}
+
+func (rs *redisStore) Get(id string) (Session, error) {
+	reply, err := rs.do("GET", redisKeyPrefix+id)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	b, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply to GET: %v", reply)
+	}
+	return decodeSession(b)
+}
+
+func (rs *redisStore) Save(id string, s Session, maxAge time.Duration) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ms := strconv.FormatInt(int64(maxAge/time.Millisecond), 10)
+	_, err = rs.do("SET", redisKeyPrefix+id, string(b), "PX", ms)
+	return err
+}
+
+func (rs *redisStore) Delete(id string) error {
+	_, err := rs.do("DEL", redisKeyPrefix+id)
+	return err
+}
+
+// redisError is an error reply from the Redis server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do sends a command and returns the reply: nil, a string for a status reply,
+// an int64, or a []byte for a bulk reply. Error replies are returned as a
+// redisError.
+func (rs *redisStore) do(args ...string) (interface{}, error) {
+	c, err := rs.get()
+	if err != nil {
+		return nil, err
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	reply, err := c.roundTrip(args)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			// The connection is in an unknown state, so don't reuse it.
+			c.Close()
+			return nil, err
+		}
+	}
+	rs.put(c)
+	return reply, err
+}
+
+// get returns an idle connection, or opens a new one if there aren't any.
+func (rs *redisStore) get() (*redisConn, error) {
+	rs.mu.Lock()
+	if n := len(rs.idle); n > 0 {
+		c := rs.idle[n-1]
+		rs.idle = rs.idle[:n-1]
+		rs.mu.Unlock()
+		return c, nil
+	}
+	rs.mu.Unlock()
+	conn, err := rs.dial(rs.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &redisConn{Conn: conn, rd: bufio.NewReader(conn)}, nil
+}
+
+// put returns c to the pool, or closes it if there are already redisMaxIdle
+// idle connections.
+func (rs *redisStore) put(c *redisConn) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if len(rs.idle) >= redisMaxIdle {
+		c.Close()
+		return
+	}
+	rs.idle = append(rs.idle, c)
+}
+
+func (c *redisConn) roundTrip(args []string) (interface{}, error) {
+	w := bufio.NewWriter(c.Conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.rd)
+}
+
+var errRedisProtocol = errors.New("redis: invalid reply")
+
+func readRedisReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errRedisProtocol
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, errRedisProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	default:
+		return nil, errRedisProtocol
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var _ SessionStore = (*memoryStore)(nil)
+var _ SessionStore = (*redisStore)(nil)
+
+// testSessionStore checks the behavior every SessionStore should have.
+func testSessionStore(t *testing.T, store SessionStore) {
+	t.Helper()
+	if s, err := store.Get("missing"); err != nil || s != nil {
+		t.Errorf("Get missing: got %v, %v, want nil, nil", s, err)
+	}
+	if err := store.Save("abc", Session{"n": "hello", "count": 3}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Get("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Values come back as JSON, like they do from a cookie.
+	if s["n"] != "hello" || s["count"] != float64(3) {
+		t.Errorf("Get: got %v", s)
+	}
+	if err := store.Save("abc", Session{"n": "bye"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := store.Get("abc"); s["n"] != "bye" || len(s) != 1 {
+		t.Errorf("Get after overwrite: got %v", s)
+	}
+	if err := store.Delete("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := store.Get("abc"); err != nil || s != nil {
+		t.Errorf("Get after Delete: got %v, %v, want nil, nil", s, err)
+	}
+	if err := store.Delete("abc"); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testSessionStore(t, newMemoryStore())
+}
+
+func TestMemoryStoreExpires(t *testing.T) {
+	m := newMemoryStore()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	if err := m.Save("old", Session{"n": "a"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	if s, _ := m.Get("old"); s["n"] != "a" {
+		t.Errorf("before expiry: got %v", s)
+	}
+	if err := m.Save("new", Session{"n": "b"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	if s, _ := m.Get("old"); s != nil {
+		t.Errorf("after expiry: got %v, want nil", s)
+	}
+
+	// Saving removes expired sessions that were never read again.
+	if err := m.Save("other", Session{}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := m.Save("another", Session{}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.sessions["other"]; ok {
+		t.Error("expected the expired session to be removed")
+	}
+	if _, ok := m.sessions["new"]; !ok {
+		t.Error("expected the unexpired session to be kept")
+	}
+}
+
+// fakeRedis is a Redis server that supports GET, SET and DEL, ignoring
+// expiry.
+type fakeRedis struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	data map[string]string
+	cmds []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, data: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, err := rd.ReadString('\n')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			b := make([]byte, size+2)
+			if _, err := io.ReadFull(rd, b); err != nil {
+				return
+			}
+			args[i] = string(b[:size])
+		}
+		conn.Write([]byte(f.do(args)))
+	}
+}
+
+func (f *fakeRedis) do(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cmds = append(f.cmds, strings.Join(args, " "))
+	switch args[0] {
+	case "GET":
+		v, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+	case "SET":
+		f.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := f.data[args[1]]
+		delete(f.data, args[1])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.ln.Close()
+	store := newRedisStore(f.ln.Addr().String())
+	testSessionStore(t, store)
+
+	f.mu.Lock()
+	cmd := f.cmds[1]
+	f.mu.Unlock()
+	if want := `SET session:abc {"count":3,"n":"hello"} PX 3600000`; cmd != want {
+		t.Errorf("got command %q, want %q", cmd, want)
+	}
+	if _, err := store.do("PING"); err == nil || err.Error() != "redis: ERR unknown command 'PING'" {
+		t.Errorf("expected a Redis error, got %v", err)
+	}
+}
+
+func TestRedisStoreConcurrent(t *testing.T) {
+	f := newFakeRedis(t)
+	defer f.ln.Close()
+	// The first connection goes to a server that never replies.
+	stuck, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stuck.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := stuck.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	store := newRedisStore(f.ln.Addr().String())
+	var mu sync.Mutex
+	dials := 0
+	store.dial = func(addr string) (net.Conn, error) {
+		mu.Lock()
+		dials++
+		first := dials == 1
+		mu.Unlock()
+		if first {
+			addr = stuck.Addr().String()
+		}
+		return net.Dial("tcp", addr)
+	}
+
+	stuckErr := make(chan error, 1)
+	go func() {
+		_, err := store.Get("slow")
+		stuckErr <- err
+	}()
+	conn := <-accepted
+	saved := make(chan error, 1)
+	go func() { saved <- store.Save("abc", Session{"n": "hello"}, time.Hour) }()
+	select {
+	case err := <-saved:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Save waited for a command on another connection")
+	}
+	conn.Close()
+	if err := <-stuckErr; err == nil {
+		t.Error("expected the command without a reply to fail")
+	}
+}
+
+func TestStoredSessionCookie(t *testing.T) {
+	defer live.Store(getLive())
+	setLive(testConfig(), NewRandomKey())
+	store := newMemoryStore()
+	h := newSessionHandler(store)
+
+	long := strings.Repeat("x", 8000)
+	cookie := getSessionCookie(t, sessionRequestTo(h, "/?n="+long, nil))
+	if len(cookie.Value) > 200 {
+		t.Errorf("expected the cookie to hold only the session ID, got %d bytes", len(cookie.Value))
+	}
+	if body := sessionRequestTo(h, "/", cookie).Body.String(); body != long {
+		t.Errorf("got session value of length %d, want %d", len(body), len(long))
+	}
+
+	// A session that was deleted from the store starts over.
+	id, err := unopaque(cookie.Value, currentKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Delete(id)
+	if body := sessionRequestTo(h, "/", cookie).Body.String(); body != "" {
+		t.Errorf("expected an empty session after Delete, got %d bytes", len(body))
+	}
+}
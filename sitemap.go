@@ -0,0 +1,108 @@
+package main
+
+// sitemap.xml, which lists the pages crawlers should index.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/rest"
+)
+
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// sitemapChangeFreqs are the change frequencies the sitemap protocol allows.
+var sitemapChangeFreqs = map[string]bool{
+	"always": true, "hourly": true, "daily": true, "weekly": true,
+	"monthly": true, "yearly": true, "never": true,
+}
+
+// sitemapEntry is how a route is listed in the sitemap.
+type sitemapEntry struct {
+	changeFreq string
+	priority   string
+}
+
+// Sitemap lists the route in /sitemap.xml. changeFreq is how often the page
+// changes, one of "always", "hourly", "daily", "weekly", "monthly", "yearly"
+// or "never", and priority is its importance relative to the site's other
+// pages, from 0 to 1. Use "" and a negative priority to leave them out;
+// crawlers assume a priority of 0.5.
+//
+// Only GET routes registered with a path pattern that has no parameters can
+// be listed, since the sitemap needs the page's URL.
+func (r *route) Sitemap(changeFreq string, priority float64) *route {
+	if r.method != "GET" || r.path == "" || strings.Contains(r.path, "/:") {
+		panic(fmt.Sprintf("router: can't list route %q in the sitemap: only GET routes with a path and no parameters can be listed", r.pattern))
+	}
+	if changeFreq != "" && !sitemapChangeFreqs[changeFreq] {
+		panic(fmt.Sprintf("router: invalid sitemap change frequency %q", changeFreq))
+	}
+	if priority > 1 {
+		panic(fmt.Sprintf("router: sitemap priority %v is greater than 1", priority))
+	}
+	e := &sitemapEntry{changeFreq: changeFreq}
+	if priority >= 0 {
+		e.priority = strconv.FormatFloat(priority, 'f', 1, 64)
+	}
+	r.sitemap = e
+	return r
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// sitemapHandler serves a sitemap of the routes listed with Sitemap, in the
+// order they were registered. URLs start with the base_url in the current
+// config, or the scheme and host of the request if it isn't set.
+func (rt *router) sitemapHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := ""
+		if c := currentConfig(); c != nil {
+			base = c.BaseURL
+		}
+		if base == "" {
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			base = scheme + "://" + r.Host
+		}
+		base = strings.TrimSuffix(base, "/")
+		set := sitemapURLSet{XMLNS: sitemapNamespace}
+		for _, route := range rt.table.routes {
+			if route.sitemap == nil {
+				continue
+			}
+			set.URLs = append(set.URLs, sitemapURL{
+				Loc:        base + route.path,
+				ChangeFreq: route.sitemap.changeFreq,
+				Priority:   route.sitemap.priority,
+			})
+		}
+		data, err := xml.MarshalIndent(set, "", "  ")
+		if err != nil {
+			rest.ServerError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		if r.Method == "HEAD" {
+			return
+		}
+		w.Write([]byte(xml.Header))
+		w.Write(data)
+		w.Write([]byte("\n"))
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkSitemap parses a sitemap and checks it has the shape the sitemap
+// schema requires.
+func checkSitemap(t *testing.T, body string) []sitemapURL {
+	t.Helper()
+	if !strings.HasPrefix(body, `<?xml version="1.0" encoding="UTF-8"?>`) {
+		t.Errorf("expected an XML declaration, got %q", body)
+	}
+	var set struct {
+		XMLName xml.Name
+		URLs    []struct {
+			XMLName    xml.Name
+			Loc        string `xml:"loc"`
+			ChangeFreq string `xml:"changefreq"`
+			Priority   string `xml:"priority"`
+		} `xml:"url"`
+	}
+	if err := xml.Unmarshal([]byte(body), &set); err != nil {
+		t.Fatal(err)
+	}
+	if set.XMLName.Space != sitemapNamespace || set.XMLName.Local != "urlset" {
+		t.Errorf("got root element %v, want urlset in the sitemap namespace", set.XMLName)
+	}
+	var urls []sitemapURL
+	for _, u := range set.URLs {
+		if u.XMLName.Space != sitemapNamespace {
+			t.Errorf("url element in namespace %q", u.XMLName.Space)
+		}
+		if parsed, err := url.Parse(u.Loc); err != nil || !parsed.IsAbs() || len(u.Loc) > 2048 {
+			t.Errorf("loc %q is not an absolute URL", u.Loc)
+		}
+		if u.ChangeFreq != "" && !sitemapChangeFreqs[u.ChangeFreq] {
+			t.Errorf("invalid changefreq %q", u.ChangeFreq)
+		}
+		if u.Priority != "" {
+			if p, err := strconv.ParseFloat(u.Priority, 64); err != nil || p < 0 || p > 1 {
+				t.Errorf("invalid priority %q", u.Priority)
+			}
+		}
+		urls = append(urls, sitemapURL{u.Loc, u.ChangeFreq, u.Priority})
+	}
+	return urls
+}
+
+func TestSitemap(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.BaseURL = "https://www.example.com/"
+	setLive(c, NewRandomKey())
+	w := httptest.NewRecorder()
+	NewServeMux(c).ServeHTTP(w, httptest.NewRequest("GET", "/sitemap.xml", nil))
+	if w.Code != 200 {
+		t.Fatalf("got code %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/xml; charset=utf-8" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	urls := checkSitemap(t, w.Body.String())
+	want := sitemapURL{Loc: "https://www.example.com/", ChangeFreq: "daily", Priority: "1.0"}
+	if len(urls) != 1 || urls[0] != want {
+		t.Errorf("got URLs %+v, want the homepage", urls)
+	}
+}
+
+func TestSitemapRoutes(t *testing.T) {
+	defer live.Store(getLive())
+	setLive(testConfig(), NewRandomKey())
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r := newRouter()
+	r.Get("/about", ok).Sitemap("monthly", -1)
+	r.Get("/private", ok)
+	r.Group("/docs").Get("/intro", ok).Sitemap("", 0.5)
+	r.Get("/sitemap.xml", r.sitemapHandler())
+
+	req := httptest.NewRequest("GET", "/sitemap.xml", nil)
+	req.Host = "example.org"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	urls := checkSitemap(t, w.Body.String())
+	want := []sitemapURL{
+		{Loc: "http://example.org/about", ChangeFreq: "monthly"},
+		{Loc: "http://example.org/docs/intro", Priority: "0.5"},
+	}
+	if len(urls) != len(want) {
+		t.Fatalf("got URLs %+v, want %+v", urls, want)
+	}
+	for i := range want {
+		if urls[i] != want[i] {
+			t.Errorf("URL %d: got %+v, want %+v", i, urls[i], want[i])
+		}
+	}
+
+	for _, f := range []func(){
+		func() { r.Get("/users/:id", ok).Sitemap("daily", 1) },
+		func() { r.Post("/form", ok).Sitemap("daily", 1) },
+		func() { r.Get("/weekly", ok).Sitemap("fortnightly", 1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected Sitemap to panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+// Serving a single-page app for routes it handles in the browser.
+
+import (
+	"html/template"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/kevinburke/rest"
+)
+
+// DefaultSPAExclude are the path prefixes that get a 404 instead of the app
+// when SPAFallback is on, if no SPAExclude is configured. Static files always
+// get a 404 when they're missing.
+var DefaultSPAExclude = []string{"/api/"}
+
+// spaRoute reports whether c serves the single-page app for a request to
+// urlPath that didn't match a route.
+func spaRoute(c *FileConfig, urlPath string) bool {
+	if c == nil || !c.SPAFallback {
+		return false
+	}
+	// A missing asset, like "/app.js", shouldn't get HTML instead.
+	if path.Ext(urlPath) != "" {
+		return false
+	}
+	exclude := c.SPAExclude
+	if exclude == nil {
+		exclude = DefaultSPAExclude
+	}
+	for _, prefix := range exclude {
+		if strings.HasPrefix(urlPath, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// spaFallback serves the app.html template, or home if there's no app.html,
+// to requests the single-page app handles in the current config, and a 404 to
+// the rest. load returns the parsed templates.
+func spaFallback(load func() (map[string]*template.Template, error), home http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !spaRoute(currentConfig(), r.URL.Path) {
+			rest.NotFound(w, r)
+			return
+		}
+		tpls, err := load()
+		if err != nil {
+			renderDevError(w, err)
+			return
+		}
+		tpl, ok := tpls["app.html"]
+		if !ok {
+			home.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		render(w, r, tpl, "app.html", nil)
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSPAFallback(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.SPAFallback = true
+	setLive(c, NewRandomKey())
+	mux := NewServeMux(c)
+
+	for _, path := range []string{"/some/client/route", "/settings"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Errorf("GET %s: got code %d, want 200", path, w.Code)
+		}
+		if body := w.Body.String(); !strings.Contains(body, "Hello World") {
+			t.Errorf("GET %s: expected the homepage, got %s", path, body)
+		}
+	}
+	for _, path := range []string{"/static/missing.js", "/missing.js", "/api/users"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != 404 {
+			t.Errorf("GET %s: got code %d, want 404", path, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/some/client/route", nil))
+	if w.Code != 404 {
+		t.Errorf("POST /some/client/route: got code %d, want 404", w.Code)
+	}
+
+	// It can be turned off by reloading the config.
+	off := *c
+	off.SPAFallback = false
+	setLive(&off, NewRandomKey())
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/some/client/route", nil))
+	if w.Code != 404 {
+		t.Errorf("GET /some/client/route with spa_fallback off: got code %d, want 404", w.Code)
+	}
+}
+
+func TestSPAFallbackAppTemplate(t *testing.T) {
+	defer live.Store(getLive())
+	dir, err := ioutil.TempDir("", "go-html-boilerplate-spa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "templates/base.html", `{{ define "base" }}{{ block "content" . }}{{ end }}{{ end }}`)
+	writeFile(t, dir, "templates/index.html", `<h1>Home</h1>`)
+	writeFile(t, dir, "templates/app.html", `<div id="app"></div>`)
+
+	c := testConfig()
+	c.Dev = true
+	c.DevDir = dir
+	c.SPAFallback = true
+	setLive(c, NewRandomKey())
+	w := httptest.NewRecorder()
+	NewServeMux(c).ServeHTTP(w, httptest.NewRequest("GET", "/some/client/route", nil))
+	if w.Code != 200 {
+		t.Fatalf("got code %d, want 200", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `<div id="app"></div>`) {
+		t.Errorf("expected app.html, got %s", body)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+// Server-sent events, for pages that update live.
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sseKeepAlive is how often serveEvents sends a comment when there are no
+// events, so proxies don't close the connection as idle.
+var sseKeepAlive = 15 * time.Second
+
+// An Event is a server-sent event. Data is split into one "data:" line per
+// line; the browser joins them with newlines again. The other fields are
+// optional.
+type Event struct {
+	// ID is sent back by the browser in the Last-Event-ID header when it
+	// reconnects.
+	ID string
+	// Event is the type of the event. Listen for it with
+	// addEventListener(Event, ...); events without a type go to onmessage.
+	Event string
+	Data  string
+	// Retry tells the browser how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// withServerWriter lets handlers inside h flush or hijack the ResponseWriter
+// h was called with. The writers from handlers.Server and handlers.Duration
+// don't implement http.Flusher or http.Hijacker, so this has to wrap them.
+func withServerWriter(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &serverWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), serverWriterKey, sw)))
+	})
+}
+
+// serverWriter is the ResponseWriter from the http.Server. Once the
+// connection is hijacked it ignores WriteHeader, so a handler can still pass
+// the status it sent on the connection to middleware like the access log.
+type serverWriter struct {
+	http.ResponseWriter
+	hijacked bool
+}
+
+func (w *serverWriter) WriteHeader(code int) {
+	if !w.hijacked {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *serverWriter) Write(p []byte) (int, error) {
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *serverWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *serverWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// canHijack reports whether the connection can be hijacked. HTTP/2
+// connections can't.
+func (w *serverWriter) canHijack() bool {
+	_, ok := w.ResponseWriter.(http.Hijacker)
+	return ok
+}
+
+func (w *serverWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, buf, err := hj.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, buf, err
+}
+
+// flush sends everything written to w so far to the client. Middleware that
+// buffers, like withGzip, writes out its buffer first.
+func flush(w http.ResponseWriter, r *http.Request) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	if f, ok := r.Context().Value(serverWriterKey).(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// An eventStream writes server-sent events to a response.
+type eventStream struct {
+	w http.ResponseWriter
+	r *http.Request
+}
+
+// newEventStream starts a text/event-stream response to r. Nothing is
+// compressed or buffered, so each event reaches the client as soon as it's
+// sent.
+func newEventStream(w http.ResponseWriter, r *http.Request) *eventStream {
+	hdr := w.Header()
+	hdr.Set("Content-Type", "text/event-stream")
+	hdr.Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the response.
+	hdr.Set("X-Accel-Buffering", "no")
+	hdr.Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+	flush(w, r)
+	return &eventStream{w: w, r: r}
+}
+
+// Send writes e and flushes it to the client.
+func (s *eventStream) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n") || strings.ContainsAny(e.Event, "\r\n") {
+		return errors.New("sse: event ID and type can't contain newlines")
+	}
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// comment writes a comment line, which browsers ignore.
+func (s *eventStream) comment(text string) error {
+	return s.write(": " + text + "\n\n")
+}
+
+func (s *eventStream) write(msg string) error {
+	if _, err := s.w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	flush(s.w, s.r)
+	return nil
+}
+
+// serveEvents streams the events from events to the client until events is
+// closed or the client disconnects, when the request context is canceled.
+// Close or stop sending on events after serveEvents returns:
+//
+//	events := make(chan Event)
+//	unsubscribe := hub.subscribe(events)
+//	defer unsubscribe()
+//	serveEvents(w, r, events)
+//
+// withTimeout buffers responses, so give the route a timeout of "0s" in
+// route_timeouts. write_timeout still limits how long a stream can last; the
+// browser reconnects when it ends, sending the last ID it got.
+func serveEvents(w http.ResponseWriter, r *http.Request, events <-chan Event) {
+	s := newEventStream(w, r)
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := s.Send(e); err != nil {
+				LoggerFrom(ctx).Debug("Could not send event", "err", err)
+				return
+			}
+		case <-ticker.C:
+			if err := s.comment("keepalive"); err != nil {
+				return
+			}
+		}
+	}
+}
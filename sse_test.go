@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/handlers"
+)
+
+func TestServeEvents(t *testing.T) {
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	setLogFormat(handlers.Logger, "logfmt", new(bytes.Buffer))
+
+	events := make(chan Event)
+	done := make(chan struct{})
+	var mux http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		serveEvents(w, r, events)
+	})
+	// The same buffering middleware the server uses.
+	mux = withGzip(mux)
+	mux = handlers.Server(mux, "go-html-boilerplate/test")
+	mux = withByteCounts(mux)
+	mux = logRequests(mux)
+	mux = handlers.Duration(mux)
+	s := httptest.NewServer(withServerWriter(mux))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("got Content-Type %q, want text/event-stream", got)
+	}
+	if got := res.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("got Content-Encoding %q, want none", got)
+	}
+
+	// Each event has to arrive before the next one is sent, so nothing can
+	// be buffering them.
+	br := bufio.NewReader(res.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+	events <- Event{ID: "1", Event: "update", Data: "hello"}
+	if got, want := readEvent(), "id: 1\nevent: update\ndata: hello\n"; got != want {
+		t.Errorf("got event %q, want %q", got, want)
+	}
+	events <- Event{Data: "two\nlines"}
+	if got, want := readEvent(), "data: two\ndata: lines\n"; got != want {
+		t.Errorf("got event %q, want %q", got, want)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveEvents didn't return after the client disconnected")
+	}
+}
+
+func TestServeEventsKeepAlive(t *testing.T) {
+	defer func(d time.Duration) { sseKeepAlive = d }(sseKeepAlive)
+	sseKeepAlive = time.Millisecond
+	events := make(chan Event)
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx, cancel := context.WithTimeout(req.Context(), 20*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	serveEvents(w, req.WithContext(ctx), events)
+	if !strings.HasPrefix(w.Body.String(), ": keepalive\n\n") {
+		t.Errorf("got body %q, want keepalive comments", w.Body.String())
+	}
+	if !w.Flushed {
+		t.Error("expected the response to be flushed")
+	}
+}
+
+func TestEventBadID(t *testing.T) {
+	s := newEventStream(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if err := s.Send(Event{ID: "1\ndata: injected"}); err == nil {
+		t.Error("expected an error for an ID with a newline")
+	}
+}
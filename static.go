@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevinburke/go-html-boilerplate/assets"
+	"github.com/kevinburke/handlers"
+	"github.com/kevinburke/rest"
+)
+
+// DefaultStaticPrefix is the URL path static assets are served under, if no
+// StaticPrefix is configured.
+const DefaultStaticPrefix = "/static/"
+
+// DefaultStaticCacheMaxAge is how long browsers may cache static assets, if
+// no StaticCacheMaxAge is configured.
+const DefaultStaticCacheMaxAge = time.Hour
+
+// fingerprintMaxAge is how long browsers may cache fingerprinted assets. The
+// content at a fingerprinted path never changes, so it's the longest max-age
+// browsers respect.
+const fingerprintMaxAge = 365 * 24 * time.Hour
+
+// assetStore is a read-only set of named files.
+type assetStore interface {
+	Asset(name string) ([]byte, error)
+	AssetInfo(name string) (os.FileInfo, error)
+	AssetNames() []string
+}
+
+// embedded is the assetStore embedded in the binary by the assets package.
+type embedded struct{}
+
+func (embedded) Asset(name string) ([]byte, error)          { return assets.Asset(name) }
+func (embedded) AssetInfo(name string) (os.FileInfo, error) { return assets.AssetInfo(name) }
+func (embedded) AssetNames() []string                       { return assets.AssetNames() }
+
+// diskStore is an assetStore that reads the "static" and "templates" folders
+// in a directory on disk, for development. Asset names are slash-separated
+// paths relative to the directory, like "static/style.css".
+type diskStore string
+
+// diskFolders are the folders in a diskStore that assets are read from.
+var diskFolders = []string{"static", "templates"}
+
+// path returns the file for the asset name. It's an error if the file isn't
+// inside one of diskFolders, or if name has a ".." segment, so requests can't
+// read other files, like the config, or templates through the static route.
+func (d diskStore) path(name string) (string, error) {
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("asset %s not found", name)
+		}
+	}
+	name = path.Clean("/" + name)[1:]
+	for _, folder := range diskFolders {
+		if strings.HasPrefix(name, folder+"/") {
+			return filepath.Join(string(d), filepath.FromSlash(name)), nil
+		}
+	}
+	return "", fmt.Errorf("asset %s not found", name)
+}
+
+func (d diskStore) Asset(name string) ([]byte, error) {
+	filename, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filename)
+}
+
+func (d diskStore) AssetInfo(name string) (os.FileInfo, error) {
+	filename, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(filename)
+}
+
+func (d diskStore) AssetNames() []string {
+	var names []string
+	for _, folder := range diskFolders {
+		root := filepath.Join(string(d), folder)
+		filepath.Walk(root, func(filename string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(string(d), filename)
+			if err == nil {
+				names = append(names, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+	}
+	return names
+}
+
+// precompressedEncodings are the encodings a static server looks for
+// precompressed copies of an asset in, in order of preference. A precompressed
+// copy of "static/style.css" is named "static/style.css.br" or
+// "static/style.css.gz".
+var precompressedEncodings = []struct {
+	encoding, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// A HTTP server for static files. If an asset has a precompressed copy that
+// the client accepts, the copy is served; other assets are compressed on the
+// fly.
+//
+// Assets in the static directory are served under a URL prefix, "/static/"
+// unless it's changed with StaticPrefix. Every asset is also served at a
+// fingerprinted path that includes a hash of its contents, like
+// "/static/style.1a2b3c4d.css".
+// Browsers can cache fingerprinted assets forever, since the path changes
+// when the contents do. Use URL, or the "asset" template function, to get the
+// fingerprinted path of an asset, and Integrity, or the "sri" template
+// function, to get its Subresource Integrity hash.
+type static struct {
+	store     assetStore
+	prefix    string // URL path the static directory is served under
+	maxAge    time.Duration
+	etags     map[string]string    // asset name => ETag
+	modTimes  map[string]time.Time // asset name => Last-Modified
+	manifest  map[string]string    // asset name => fingerprinted name
+	originals map[string]string    // fingerprinted name => asset name
+	integrity map[string]string    // asset name => Subresource Integrity hash
+}
+
+// newStatic returns a static server for the assets in store, with ETags
+// computed for every asset, served under DefaultStaticPrefix. Browsers may
+// cache assets for maxAge. Assets without a recorded modification time use
+// modTime instead.
+func newStatic(store assetStore, modTime time.Time, maxAge time.Duration) *static {
+	s := &static{
+		store:     store,
+		prefix:    DefaultStaticPrefix,
+		maxAge:    maxAge,
+		etags:     make(map[string]string),
+		modTimes:  make(map[string]time.Time),
+		integrity: make(map[string]string),
+	}
+	hashes := make(map[string]string)
+	for _, name := range store.AssetNames() {
+		bits, err := store.Asset(name)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(bits)
+		hashes[name] = hex.EncodeToString(sum[:])
+		s.etags[name] = `"` + hashes[name] + `"`
+		sri := sha512.Sum384(bits)
+		s.integrity[name] = "sha384-" + base64.StdEncoding.EncodeToString(sri[:])
+		s.modTimes[name] = modTime
+		if info, err := store.AssetInfo(name); err == nil {
+			s.modTimes[name] = assetModTime(info, modTime)
+		}
+	}
+	s.manifest, s.originals = buildManifest(hashes)
+	return s
+}
+
+// buildManifest returns the fingerprinted name of every asset in the static
+// directory, given the hex-encoded hashes of all assets, and the reverse
+// mapping. Precompressed copies aren't fingerprinted; they're served for the
+// fingerprinted name of the asset they're a copy of.
+func buildManifest(hashes map[string]string) (manifest, originals map[string]string) {
+	manifest = make(map[string]string)
+	originals = make(map[string]string)
+	for name, hash := range hashes {
+		if !strings.HasPrefix(name, "static/") || isPrecompressed(name, hashes) {
+			continue
+		}
+		fp := fingerprint(name, hash)
+		manifest[name] = fp
+		originals[fp] = name
+	}
+	return manifest, originals
+}
+
+// isPrecompressed reports whether name is a precompressed copy of another
+// asset in hashes.
+func isPrecompressed(name string, hashes map[string]string) bool {
+	for _, pc := range precompressedEncodings {
+		if strings.HasSuffix(name, pc.ext) {
+			if _, ok := hashes[strings.TrimSuffix(name, pc.ext)]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fingerprint inserts the first 8 characters of hash before the extension of
+// name: "static/style.css" becomes "static/style.1a2b3c4d.css".
+func fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash[:8] + ext
+}
+
+// staticName returns the asset name for a file in the static directory. The
+// "static/" prefix is optional, so "style.css" and "static/style.css" are the
+// same asset.
+func staticName(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if strings.HasPrefix(name, "static/") {
+		return name
+	}
+	return "static/" + name
+}
+
+// URL returns the fingerprinted path of an asset in the static directory,
+// like "/static/style.1a2b3c4d.css" for "style.css".
+func (s *static) URL(name string) (string, error) {
+	fp, ok := s.manifest[staticName(name)]
+	if !ok {
+		return "", fmt.Errorf("unknown static asset %q", name)
+	}
+	return s.prefix + strings.TrimPrefix(fp, "static/"), nil
+}
+
+// Integrity returns the Subresource Integrity hash of an asset in the static
+// directory, for the integrity attribute of a <link> or <script> tag: "sha384-"
+// followed by the base64-encoded SHA-384 hash of the file.
+func (s *static) Integrity(name string) (string, error) {
+	hash, ok := s.integrity[staticName(name)]
+	if !ok {
+		return "", fmt.Errorf("unknown static asset %q", name)
+	}
+	return hash, nil
+}
+
+// templateFuncs returns functions for templates that use the assets in s:
+//
+//	<link rel="stylesheet" href="{{ asset "style.css" }}" integrity="{{ sri "style.css" }}">
+//
+// "asset" returns the fingerprinted path of static/style.css, like URL, and
+// "sri" returns its hash, like Integrity.
+func (s *static) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"asset": s.URL,
+		"sri":   s.Integrity,
+	}
+}
+
+// assetModTime returns the modification time recorded for an asset, or
+// fallback if there isn't one. Files embedded in the binary don't have a
+// modification time.
+func assetModTime(info os.FileInfo, fallback time.Time) time.Time {
+	t := info.ModTime()
+	if t.IsZero() || t.Unix() == 0 {
+		return fallback
+	}
+	return t
+}
+
+func (s *static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := "static/favicon.ico"
+	if r.URL.Path != "/favicon.ico" {
+		if !strings.HasPrefix(r.URL.Path, s.prefix) {
+			rest.NotFound(w, r)
+			return
+		}
+		name = "static/" + strings.TrimPrefix(r.URL.Path, s.prefix)
+	}
+	original, fingerprinted := s.originals[name]
+	if fingerprinted {
+		name = original
+	}
+	hasCopies := false
+	for _, pc := range precompressedEncodings {
+		if _, ok := s.etags[name+pc.ext]; !ok {
+			continue
+		}
+		hasCopies = true
+		if acceptsEncoding(r.Header.Get("Accept-Encoding"), pc.encoding) {
+			w.Header().Set("Content-Encoding", pc.encoding)
+			w.Header().Add("Vary", "Accept-Encoding")
+			s.serve(w, r, name, name+pc.ext, fingerprinted)
+			return
+		}
+	}
+	if hasCopies {
+		// The client doesn't accept any of the precompressed copies.
+		w.Header().Add("Vary", "Accept-Encoding")
+		s.serve(w, r, name, name, fingerprinted)
+		return
+	}
+	handlers.GZip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serve(w, r, name, name, fingerprinted)
+	})).ServeHTTP(w, r)
+}
+
+// serve writes the asset file, which is either the asset name or a
+// precompressed copy of it.
+func (s *static) serve(w http.ResponseWriter, r *http.Request, name, file string, fingerprinted bool) {
+	bits, err := s.store.Asset(file)
+	if err != nil {
+		w.Header().Del("Content-Encoding")
+		rest.NotFound(w, r)
+		return
+	}
+	// ServeContent checks the ETag against If-None-Match and If-Match.
+	if etag, ok := s.etags[file]; ok {
+		w.Header().Set("ETag", etag)
+		if file == name && w.Header().Get("Content-Encoding") != "" {
+			// handlers.GZip is compressing the response.
+			weakenETag(w.Header())
+		}
+	}
+	w.Header().Set("Cache-Control", cacheControl(s.maxAge, fingerprinted))
+	// The Content-Type comes from the extension of name, not file.
+	http.ServeContent(w, r, name, s.modTimes[name], bytes.NewReader(bits))
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows encoding.
+// An encoding with a quality value of 0 is not accepted.
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		if strings.TrimSpace(fields[0]) != encoding {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// cacheControl returns the Cache-Control header for a static asset. A
+// fingerprinted asset is immutable, so it can be cached for as long as
+// possible.
+func cacheControl(maxAge time.Duration, fingerprinted bool) string {
+	if fingerprinted {
+		return "public, max-age=" + strconv.Itoa(int(fingerprintMaxAge/time.Second)) + ", immutable"
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge/time.Second))
+}
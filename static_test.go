@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/go-html-boilerplate/assets"
+)
+
+func TestStaticETag(t *testing.T) {
+	mux := NewServeMux(testConfig())
+	req := httptest.NewRequest("GET", "/static/style.css", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("GET /static/style.css: got code %d, want 200", w.Code)
+	}
+	sum := sha256.Sum256(w.Body.Bytes())
+	want := `"` + hex.EncodeToString(sum[:]) + `"`
+	etag := w.Header().Get("ETag")
+	if etag != want {
+		t.Fatalf("GET /static/style.css: got ETag %q, want %q", etag, want)
+	}
+
+	req = httptest.NewRequest("GET", "/static/style.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 304 {
+		t.Errorf("GET /static/style.css with matching If-None-Match: got code %d, want 304", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/static/style.css", nil)
+	req.Header.Set("If-None-Match", `"stale"`)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("GET /static/style.css with stale If-None-Match: got code %d, want 200", w.Code)
+	}
+}
+
+func TestStaticETagGzip(t *testing.T) {
+	mux := NewServeMux(testConfig())
+	req := httptest.NewRequest("GET", "/static/style.css", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	identity := w.Header().Get("ETag")
+
+	req = httptest.NewRequest("GET", "/static/style.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got Content-Encoding %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+	etag := w.Header().Get("ETag")
+	if etag != "W/"+identity {
+		t.Errorf("gzipped: got ETag %q, want a weak %s", etag, identity)
+	}
+
+	req = httptest.NewRequest("GET", "/static/style.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != 304 {
+		t.Errorf("gzipped with matching If-None-Match: got code %d, want 304", w.Code)
+	}
+}
+
+func TestStaticCacheControl(t *testing.T) {
+	c := testConfig()
+	c.StaticCacheMaxAge.Duration = 2 * time.Hour
+	mux := NewServeMux(c)
+	req := httptest.NewRequest("GET", "/static/style.css", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if cc, want := w.Header().Get("Cache-Control"), "public, max-age=7200"; cc != want {
+		t.Errorf("GET /static/style.css: got Cache-Control %q, want %q", cc, want)
+	}
+	if cc, want := cacheControl(2*time.Hour, true), "public, max-age=31536000, immutable"; cc != want {
+		t.Errorf("cacheControl for fingerprinted asset: got %q, want %q", cc, want)
+	}
+}
+
+type fileInfo struct {
+	os.FileInfo
+	modTime time.Time
+}
+
+func (f fileInfo) ModTime() time.Time { return f.modTime }
+
+func TestAssetModTime(t *testing.T) {
+	fallback := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	recorded := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	tests := []struct {
+		modTime time.Time
+		want    time.Time
+	}{
+		{recorded, recorded},
+		{time.Unix(0, 0), fallback},
+		{time.Time{}, fallback},
+	}
+	for _, tt := range tests {
+		if got := assetModTime(fileInfo{modTime: tt.modTime}, fallback); !got.Equal(tt.want) {
+			t.Errorf("assetModTime(%v): got %v, want %v", tt.modTime, got, tt.want)
+		}
+	}
+}
+
+func TestStaticLastModified(t *testing.T) {
+	start := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	modified := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	dir, err := ioutil.TempDir("", "static-last-modified")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "static/style.css", "body {}")
+	if err := os.Chtimes(filepath.Join(dir, "static", "style.css"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		store assetStore
+		want  time.Time
+	}{
+		// Embedded assets have no modification time, so they use the time
+		// the server started.
+		{"embedded", embedded{}, start},
+		{"disk", diskStore(dir), modified},
+	}
+	for _, tt := range tests {
+		s := newStatic(tt.store, start, time.Hour)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/static/style.css", nil))
+		want := tt.want.Format(http.TimeFormat)
+		if lm := w.Header().Get("Last-Modified"); lm != want {
+			t.Errorf("%s: got Last-Modified %q, want %q", tt.name, lm, want)
+		}
+	}
+}
+
+// memStore is an assetStore for tests.
+type memStore map[string]string
+
+func (m memStore) Asset(name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return []byte(data), nil
+}
+
+func (m memStore) AssetInfo(name string) (os.FileInfo, error) {
+	if _, ok := m[name]; !ok {
+		return nil, errors.New("not found")
+	}
+	return fileInfo{modTime: time.Unix(0, 0)}, nil
+}
+
+func (m memStore) AssetNames() []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	store := memStore{
+		"static/app.css":    "body { color: red }",
+		"static/app.css.br": "brotli bytes",
+		"static/app.css.gz": "gzip bytes",
+		"static/gz.css":     "body { color: blue }",
+		"static/gz.css.gz":  "gzip only bytes",
+	}
+	s := newStatic(store, time.Now(), time.Hour)
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		encoding       string
+		body           string
+	}{
+		{"/static/app.css", "gzip, deflate, br", "br", "brotli bytes"},
+		{"/static/app.css", "gzip", "gzip", "gzip bytes"},
+		{"/static/app.css", "br;q=0, gzip", "gzip", "gzip bytes"},
+		{"/static/app.css", "", "", "body { color: red }"},
+		{"/static/app.css", "identity", "", "body { color: red }"},
+		{"/static/gz.css", "br", "", "body { color: blue }"},
+		{"/static/gz.css", "br, gzip", "gzip", "gzip only bytes"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Errorf("GET %s (Accept-Encoding %q): got code %d, want 200", tt.path, tt.acceptEncoding, w.Code)
+			continue
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != tt.encoding {
+			t.Errorf("GET %s (Accept-Encoding %q): got Content-Encoding %q, want %q", tt.path, tt.acceptEncoding, enc, tt.encoding)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("GET %s (Accept-Encoding %q): got Vary %q, want Accept-Encoding", tt.path, tt.acceptEncoding, vary)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/css; charset=utf-8" {
+			t.Errorf("GET %s (Accept-Encoding %q): got Content-Type %q, want text/css", tt.path, tt.acceptEncoding, ct)
+		}
+		if body := w.Body.String(); body != tt.body {
+			t.Errorf("GET %s (Accept-Encoding %q): got body %q, want %q", tt.path, tt.acceptEncoding, body, tt.body)
+		}
+	}
+}
+
+func TestStaticCompressesOnTheFly(t *testing.T) {
+	s := newStatic(memStore{"static/app.css": "body { color: red }"}, time.Now(), time.Hour)
+	req := httptest.NewRequest("GET", "/static/app.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if enc := w.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Errorf("got Content-Encoding %q, want gzip", enc)
+	}
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "body { color: red }" {
+		t.Errorf("got body %q, want %q", body, "body { color: red }")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"static/style.css", "static/style.0123abcd.css"},
+		{"static/js/app.min.js", "static/js/app.min.0123abcd.js"},
+		{"static/LICENSE", "static/LICENSE.0123abcd"},
+	}
+	for _, tt := range tests {
+		if got := fingerprint(tt.name, "0123abcdef"); got != tt.want {
+			t.Errorf("fingerprint(%q): got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildManifest(t *testing.T) {
+	manifest, originals := buildManifest(map[string]string{
+		"static/app.css":       "aaaaaaaaaaaa",
+		"static/app.css.br":    "bbbbbbbbbbbb",
+		"static/data.gz":       "cccccccccccc",
+		"templates/index.html": "dddddddddddd",
+	})
+	want := map[string]string{
+		"static/app.css": "static/app.aaaaaaaa.css",
+		"static/data.gz": "static/data.cccccccc.gz",
+	}
+	if len(manifest) != len(want) {
+		t.Errorf("got manifest %v, want %v", manifest, want)
+	}
+	for name, fp := range want {
+		if manifest[name] != fp {
+			t.Errorf("manifest[%q]: got %q, want %q", name, manifest[name], fp)
+		}
+		if originals[fp] != name {
+			t.Errorf("originals[%q]: got %q, want %q", fp, originals[fp], name)
+		}
+	}
+}
+
+func TestStaticFingerprinted(t *testing.T) {
+	store := memStore{
+		"static/app.css":    "body { color: red }",
+		"static/app.css.br": "brotli bytes",
+	}
+	s := newStatic(store, time.Now(), time.Hour)
+	sum := sha256.Sum256([]byte("body { color: red }"))
+	want := "/static/app." + hex.EncodeToString(sum[:])[:8] + ".css"
+	u, err := s.URL("app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != want {
+		t.Fatalf("URL(app.css): got %q, want %q", u, want)
+	}
+	if _, err := s.URL("missing.css"); err == nil {
+		t.Error("URL(missing.css): expected an error, got nil")
+	}
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		body           string
+		cacheControl   string
+	}{
+		{want, "", "body { color: red }", "public, max-age=31536000, immutable"},
+		{want, "br", "brotli bytes", "public, max-age=31536000, immutable"},
+		{"/static/app.css", "", "body { color: red }", "public, max-age=3600"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Errorf("GET %s: got code %d, want 200", tt.path, w.Code)
+			continue
+		}
+		if body := w.Body.String(); body != tt.body {
+			t.Errorf("GET %s: got body %q, want %q", tt.path, body, tt.body)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != tt.cacheControl {
+			t.Errorf("GET %s: got Cache-Control %q, want %q", tt.path, cc, tt.cacheControl)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/css; charset=utf-8" {
+			t.Errorf("GET %s: got Content-Type %q, want text/css", tt.path, ct)
+		}
+	}
+}
+
+func TestAssetTemplateFunc(t *testing.T) {
+	s := newStatic(memStore{"static/app.css": "body { color: red }"}, time.Now(), time.Hour)
+	tpl := template.Must(template.New("t").Funcs(s.templateFuncs()).Parse(`<link href="{{ asset "app.css" }}">`))
+	buf := new(bytes.Buffer)
+	if err := tpl.Execute(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := s.URL("app.css")
+	if got := buf.String(); got != `<link href="`+want+`">` {
+		t.Errorf("got %q, want a link to %q", got, want)
+	}
+}
+
+func TestHomepageFingerprintedStylesheet(t *testing.T) {
+	want, err := newStatic(embedded{}, time.Now(), time.Hour).URL("style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	NewServeMux(testConfig()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, `href="`+want+`"`) {
+		t.Errorf("GET /: expected a link to %q in body, got %s", want, body)
+	}
+}
+
+// writeFile writes data to the slash-separated name in dir, creating
+// directories as needed.
+func writeFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+	filename := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate-dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "static/css/app.css", "body {}")
+	writeFile(t, dir, "templates/index.html", "hello")
+	writeFile(t, dir, "config.yml", "secret_key: hunter2")
+
+	store := diskStore(dir)
+	names := store.AssetNames()
+	if len(names) != 2 || names[0] != "static/css/app.css" || names[1] != "templates/index.html" {
+		t.Errorf("AssetNames: got %q", names)
+	}
+	if data, err := store.Asset("static/css/app.css"); err != nil || string(data) != "body {}" {
+		t.Errorf("Asset: got (%q, %v)", data, err)
+	}
+	for _, name := range []string{"config.yml", "static/../config.yml", "../config.yml", "static/../templates/index.html"} {
+		if _, err := store.Asset(name); err == nil {
+			t.Errorf("Asset(%q): expected an error, got nil", name)
+		}
+	}
+}
+
+func TestDevMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate-dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "static/style.css", "body { color: red }")
+	writeFile(t, dir, "templates/base.html", `{{ define "base" }}{{ block "content" . }}{{ end }}{{ end }}`)
+	writeFile(t, dir, "templates/index.html", `<h1>First</h1><link href="{{ asset "style.css" }}">`)
+
+	c := testConfig()
+	c.Dev = true
+	c.DevDir = dir
+	mux := NewServeMux(c)
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 200 {
+			t.Fatalf("GET %s: got code %d, want 200", path, w.Code)
+		}
+		return w.Body.String()
+	}
+	if body := get("/static/style.css"); body != "body { color: red }" {
+		t.Errorf("GET /static/style.css: got %q", body)
+	}
+	if body := get("/"); !strings.Contains(body, "First") {
+		t.Errorf("GET /: expected the template on disk, got %q", body)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/static/../templates/base.html", nil))
+	if w.Code != 404 {
+		t.Errorf("GET /static/../templates/base.html: got code %d, want 404", w.Code)
+	}
+
+	writeFile(t, dir, "static/style.css", "body { color: blue }")
+	writeFile(t, dir, "templates/index.html", `<h1>Second</h1><link href="{{ asset "style.css" }}">`)
+	if body := get("/static/style.css"); body != "body { color: blue }" {
+		t.Errorf("GET /static/style.css after change: got %q", body)
+	}
+	body := get("/")
+	if !strings.Contains(body, "Second") {
+		t.Errorf("GET / after change: expected the new template, got %q", body)
+	}
+	sum := sha256.Sum256([]byte("body { color: blue }"))
+	if want := "/static/style." + hex.EncodeToString(sum[:])[:8] + ".css"; !strings.Contains(body, want) {
+		t.Errorf("GET / after change: expected a link to %q, got %q", want, body)
+	}
+}
+
+func TestProductionIgnoresDevDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate-dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "static/style.css", "body { color: red }")
+	writeFile(t, dir, "templates/index.html", "<h1>From disk</h1>")
+
+	c := testConfig()
+	c.DevDir = dir
+	mux := NewServeMux(c)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, "Hello World") {
+		t.Errorf("GET /: expected the embedded template, got %q", body)
+	}
+	want, err := assets.Asset("static/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/static/style.css", nil))
+	if w.Body.String() != string(want) {
+		t.Errorf("GET /static/style.css: expected the embedded asset, got %q", w.Body.String())
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	s := newStatic(embedded{}, time.Now(), time.Hour)
+	data, err := assets.Asset("static/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha512.Sum384(data)
+	want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	for _, name := range []string{"style.css", "static/style.css", "/static/style.css"} {
+		got, err := s.Integrity(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Integrity(%q): got %q, want %q", name, got, want)
+		}
+	}
+	if !regexp.MustCompile(`^sha384-[A-Za-z0-9+/]{64}$`).MatchString(want) {
+		t.Errorf("Integrity: %q doesn't look like a SHA-384 SRI hash", want)
+	}
+	if _, err := s.Integrity("missing.css"); err == nil {
+		t.Error("Integrity(missing.css): expected an error, got nil")
+	}
+
+	w := httptest.NewRecorder()
+	NewServeMux(testConfig()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, `integrity="`+want+`"`) {
+		t.Errorf("GET /: expected integrity %q in body, got %s", want, body)
+	}
+}
+
+func TestStaticPrefix(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.StaticPrefix = "/assets"
+	setLive(c, NewRandomKey())
+	mux := NewServeMux(c)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	home := get("/").Body.String()
+	styleURL, _ := regexp.MatchString(`href="/assets/style\.[0-9a-f]{8}\.css"`, home)
+	if !styleURL {
+		t.Fatalf("expected the homepage to link to the stylesheet under /assets/, got %s", home)
+	}
+	for _, path := range []string{"/assets/style.css", "/robots.txt", "/manifest.webmanifest"} {
+		if w := get(path); w.Code != 200 {
+			t.Errorf("GET %s: got code %d, want 200", path, w.Code)
+		}
+	}
+	url := regexp.MustCompile(`/assets/style\.[0-9a-f]{8}\.css`).FindString(home)
+	if w := get(url); w.Code != 200 || !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("GET %s: got code %d and Cache-Control %q", url, w.Code, w.Header().Get("Cache-Control"))
+	}
+	for _, path := range []string{"/static/style.css", "/static/" + strings.TrimPrefix(url, "/assets/")} {
+		if w := get(path); w.Code != 404 {
+			t.Errorf("GET %s: got code %d, want 404", path, w.Code)
+		}
+	}
+
+	// The stylesheet still loads during maintenance.
+	c.MaintenanceMode = true
+	if w := get("/assets/style.css"); w.Code != 200 {
+		t.Errorf("GET /assets/style.css during maintenance: got code %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+// Serving directories on disk, like user uploads, alongside the embedded
+// static assets.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevinburke/rest"
+)
+
+// A StaticDir serves the files in a directory on disk at a URL prefix:
+//
+//	static_dirs:
+//	  - name: uploads
+//	    prefix: /uploads/
+//	    dir: /var/lib/app/uploads
+//	    cache_max_age: 24h
+//
+// Unlike the embedded static assets, files are read from disk for
+// every request, so files added while the server is running are served too.
+type StaticDir struct {
+	// Name identifies the directory in errors and logs.
+	Name string `yaml:"name" json:"name" toml:"name"`
+	// Prefix is the URL path the files are served under, like "/uploads/".
+	// It must start and end with a slash.
+	Prefix string `yaml:"prefix" json:"prefix" toml:"prefix"`
+	Dir    string `yaml:"dir" json:"dir" toml:"dir"`
+	// CacheMaxAge is how long browsers may cache the files, like "24h". If
+	// it's unspecified, they check for changes on every request.
+	CacheMaxAge Duration `yaml:"cache_max_age" json:"cache_max_age" toml:"cache_max_age"`
+}
+
+// validate returns an error if d can't be served.
+func (d StaticDir) validate() error {
+	if d.Name == "" {
+		return errors.New("name is required")
+	}
+	if !strings.HasPrefix(d.Prefix, "/") || !strings.HasSuffix(d.Prefix, "/") || d.Prefix == "/" {
+		return fmt.Errorf("%s: prefix %q must be a path that starts and ends with a slash, like /uploads/", d.Name, d.Prefix)
+	}
+	info, err := os.Stat(d.Dir)
+	if err != nil {
+		return fmt.Errorf("%s: %v", d.Name, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: %s is not a directory", d.Name, d.Dir)
+	}
+	if d.CacheMaxAge.Duration < 0 {
+		return fmt.Errorf("%s: cache_max_age: %v is negative", d.Name, d.CacheMaxAge)
+	}
+	return nil
+}
+
+// handler serves the files in d to requests with paths under d.Prefix.
+// Directories and files or directories whose names start with a dot get a
+// 404.
+//
+// The files may have been uploaded by users, so they're served with a
+// Content-Security-Policy that stops HTML files from running scripts on the
+// site. Pages that use the files, like images and stylesheets, aren't
+// affected.
+func (d StaticDir) handler() http.Handler {
+	cacheControl := "no-cache"
+	if d.CacheMaxAge.Duration > 0 {
+		cacheControl = "public, max-age=" + strconv.Itoa(int(d.CacheMaxAge.Duration/time.Second))
+	}
+	root := http.Dir(d.Dir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, d.Prefix))
+		if strings.Contains(name, "/.") {
+			rest.NotFound(w, r)
+			return
+		}
+		f, err := root.Open(name)
+		if err != nil {
+			rest.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			rest.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	})
+}
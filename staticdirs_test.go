@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStaticDirs(t *testing.T) {
+	uploads, err := ioutil.TempDir("", "go-html-boilerplate-uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(uploads)
+	media, err := ioutil.TempDir("", "go-html-boilerplate-media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(media)
+	writeFile(t, uploads, "avatars/1.txt", "first upload")
+	writeFile(t, uploads, ".secret", "hidden")
+	writeFile(t, media, "intro.txt", "media file")
+
+	c := testConfig()
+	c.StaticDirs = []StaticDir{
+		{Name: "uploads", Prefix: "/uploads/", Dir: uploads},
+		{Name: "media", Prefix: "/media/", Dir: media, CacheMaxAge: Duration{24 * time.Hour}},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	mux := NewServeMux(c)
+	tests := []struct {
+		path         string
+		code         int
+		body         string
+		cacheControl string
+	}{
+		{"/uploads/avatars/1.txt", 200, "first upload", "no-cache"},
+		{"/media/intro.txt", 200, "media file", "public, max-age=86400"},
+		{"/media/avatars/1.txt", 404, "", ""},
+		{"/uploads/.secret", 404, "", ""},
+		{"/uploads/avatars/", 404, "", ""},
+		{"/uploads/../media/intro.txt", 404, "", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("GET %s: got code %d, want %d", tt.path, w.Code, tt.code)
+			continue
+		}
+		if tt.code != 200 {
+			continue
+		}
+		if got := w.Body.String(); got != tt.body {
+			t.Errorf("GET %s: got body %q, want %q", tt.path, got, tt.body)
+		}
+		if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+			t.Errorf("GET %s: got Cache-Control %q, want %q", tt.path, got, tt.cacheControl)
+		}
+	}
+
+	// Files added while the server is running are served.
+	writeFile(t, uploads, "2.txt", "second upload")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/uploads/2.txt", nil))
+	if w.Code != 200 || w.Body.String() != "second upload" {
+		t.Errorf("GET /uploads/2.txt: got code %d and body %q", w.Code, w.Body.String())
+	}
+
+	// The embedded assets are still served.
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/static/style.css", nil))
+	if w.Code != 200 {
+		t.Errorf("GET /static/style.css: got code %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+// Helpers for loading templates.
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// templateFuncs are available in every template, in addition to the url,
+// asset and sri functions. To add your own, add them to the map here, or to
+// templateFuncs before the templates are parsed in init.
+var templateFuncs = template.FuncMap{
+	// {{ formatDate .CreatedAt "Jan 2, 2006" }}
+	"formatDate": formatDate,
+	// {{ title "hello world" }} returns "Hello World".
+	"title": title,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	// {{ join .Tags ", " }}
+	"join": strings.Join,
+	// {{ range flashes $ }}{{ .Level }}: {{ .Message }}{{ end }} shows the
+	// messages queued with AddFlash.
+	"flashes": func(p Page) []Flash { return GetFlashes(p.ctx) },
+	// {{ csrfField $ }} is a hidden input with the CSRF token for the
+	// session; add it to every form that doesn't use GET. {{ csrfToken $ }}
+	// is the bare token, for the X-CSRF-Token header.
+	"csrfToken": func(p Page) string { return CSRFToken(p.ctx) },
+	"csrfField": func(p Page) template.HTML { return csrfField(CSRFToken(p.ctx)) },
+	// <script nonce="{{ cspNonce $ }}"> lets an inline script run under the
+	// Content-Security-Policy.
+	"cspNonce": func(p Page) string { return CSPNonce(p.ctx) },
+}
+
+// A Page is what render executes a template with. Data is the value passed to
+// render, so templates refer to it as {{ .Data }}. The request's context is
+// for the functions that need it, like flashes and csrfField, which take the
+// Page as $. Pass the Page itself, not .Data, to {{ template "base" . }}.
+type Page struct {
+	Data interface{}
+	ctx  context.Context
+}
+
+// formatDate formats t with layout, like t.Format. The zero time is formatted
+// as the empty string.
+func formatDate(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// title upper-cases the first letter of each word in s.
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		isStart := unicode.IsSpace(prev)
+		prev = r
+		if isStart {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+// layoutFile is the base layout shared by every page in the templates
+// folder. It defines a "base" template with "title" and "content" blocks. A
+// page uses the layout by calling {{ template "base" . }} and defining the
+// blocks it wants to override:
+//
+//	{{ template "base" . }}
+//	{{ define "content" }}<h1>Hello World!</h1>{{ end }}
+const layoutFile = "templates/base.html"
+
+// templateDir contains the layout and the pages.
+const templateDir = "templates/"
+
+// parseTemplates parses every .html file in the templates folder of store,
+// except the layout, as a page. Each page is a template named for its path in
+// the folder, like "index.html" or "users/show.html", and is parsed with its
+// own copy of the layout, so pages can define the same blocks. templateFuncs
+// and funcs are available to every page.
+//
+// If a file can't be parsed, the error includes the file name.
+func parseTemplates(store assetStore, funcs ...template.FuncMap) (map[string]*template.Template, error) {
+	data, err := store.Asset(layoutFile)
+	if err != nil {
+		return nil, err
+	}
+	layout := template.New(layoutFile).Funcs(templateFuncs)
+	for _, f := range funcs {
+		layout.Funcs(f)
+	}
+	if _, err := layout.Parse(string(data)); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", layoutFile, err)
+	}
+	pages := make(map[string]*template.Template)
+	for _, file := range store.AssetNames() {
+		if !strings.HasPrefix(file, templateDir) || !strings.HasSuffix(file, ".html") || file == layoutFile {
+			continue
+		}
+		data, err := store.Asset(file)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(file, templateDir)
+		tpl, err := layout.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tpl.New(name).Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", file, err)
+		}
+		pages[name] = tpl
+	}
+	return pages, nil
+}
+
+// cloneTemplates returns a copy of pages with funcs available to them, in
+// place of any functions with the same names.
+func cloneTemplates(pages map[string]*template.Template, funcs ...template.FuncMap) (map[string]*template.Template, error) {
+	clones := make(map[string]*template.Template, len(pages))
+	for name, tpl := range pages {
+		clone, err := tpl.Clone()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range funcs {
+			clone.Funcs(f)
+		}
+		clones[name] = clone
+	}
+	return clones, nil
+}
+
+// templateLoader returns the pages for a request. In dev mode it parses the
+// templates in store again for every request, so changes show up without a
+// restart; otherwise it returns the pages parsed when the server started.
+type templateLoader struct {
+	store  assetStore
+	dev    bool
+	parsed map[string]*template.Template
+}
+
+// load returns the pages, keyed by name. In dev mode funcs are made available
+// to the newly parsed pages; otherwise they're ignored, and load never returns
+// an error.
+func (l *templateLoader) load(funcs ...template.FuncMap) (map[string]*template.Template, error) {
+	if !l.dev {
+		return l.parsed, nil
+	}
+	return parseTemplates(l.store, funcs...)
+}
+
+var devErrorTpl = template.Must(template.New("error").Parse(`<!doctype html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <title>{{ .Title }}</title>
+  </head>
+  <body>
+    <h1>{{ .Title }}</h1>
+    <pre>{{ .Detail }}</pre>
+  </body>
+</html>
+`))
+
+// renderDevError writes a 500 error page describing err, which is usually a
+// mistake in a template. Only use it in dev mode; the error can contain
+// details about the server that shouldn't be public.
+func renderDevError(w http.ResponseWriter, err error) {
+	renderDevErrorPage(w, "Template error", err.Error())
+}
+
+func renderDevErrorPage(w http.ResponseWriter, title, detail string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	devErrorTpl.Execute(w, struct{ Title, Detail string }{title, detail})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateLoaderDev(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "templates/base.html", "")
+	writeFile(t, dir, "templates/page.html", "<p>old</p>")
+	store := diskStore(dir)
+	parsed, err := parseTemplates(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := &templateLoader{store: store, dev: true, parsed: parsed}
+	prod := &templateLoader{store: store, parsed: parsed}
+
+	writeFile(t, dir, "templates/page.html", "<p>new</p>")
+	for _, tt := range []struct {
+		loader *templateLoader
+		want   string
+	}{
+		{dev, "<p>new</p>"},
+		{prod, "<p>old</p>"},
+	} {
+		pages, err := tt.loader.load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if err := pages["page.html"].ExecuteTemplate(buf, "page.html", nil); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("dev %t: got %q, want %q", tt.loader.dev, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestDevTemplateParseError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "static/style.css", "body {}")
+	writeFile(t, dir, "templates/base.html", "")
+	writeFile(t, dir, "templates/index.html", "<h1>{{ .Title </h1>")
+
+	c := testConfig()
+	c.Dev = true
+	c.DevDir = dir
+	w := httptest.NewRecorder()
+	NewServeMux(c).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 500 {
+		t.Errorf("GET /: got code %d, want 500", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("GET /: got Content-Type %q, want text/html", ct)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Template error") || !strings.Contains(body, "template: index.html:1:") {
+		t.Errorf("GET /: expected a readable parse error, got %s", body)
+	}
+	if strings.Contains(body, "<h1>{{") {
+		t.Error("GET /: template source should be escaped in the error page")
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	store := memStore{
+		"templates/base.html": `{{ define "base" }}<html><title>{{ block "title" . }}Default{{ end }}</title>` +
+			`<body>{{ block "content" . }}{{ end }}</body></html>{{ end }}`,
+		"templates/index.html": `{{ template "base" . }}{{ define "content" }}<h1>Home</h1>{{ end }}`,
+		"templates/about.html": `{{ template "base" . }}{{ define "title" }}About{{ end }}` +
+			`{{ define "content" }}<p>About {{ . }}</p>{{ end }}`,
+		"templates/users/show.html": `<p>User {{ . }}</p>`,
+		"templates/notes.txt":       `not a template`,
+		"static/style.css":          `body {}`,
+	}
+	pages, err := parseTemplates(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 3 {
+		t.Errorf("got %d pages, want 3", len(pages))
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"index.html", "<html><title>Default</title><body><h1>Home</h1></body></html>"},
+		{"about.html", "<html><title>About</title><body><p>About us</p></body></html>"},
+		{"users/show.html", "<p>User us</p>"},
+	}
+	for _, tt := range tests {
+		tpl, ok := pages[tt.name]
+		if !ok {
+			t.Errorf("%s: not parsed", tt.name)
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if err := tpl.ExecuteTemplate(buf, tt.name, "us"); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestParseTemplatesError(t *testing.T) {
+	store := memStore{
+		"templates/base.html":  "",
+		"templates/index.html": "<p>fine</p>",
+		"templates/bad.html":   "{{ .Title ",
+	}
+	_, err := parseTemplates(store)
+	if err == nil || !strings.Contains(err.Error(), "templates/bad.html") {
+		t.Errorf("got error %v, want one naming templates/bad.html", err)
+	}
+}
+
+func TestHomepageLayout(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewServeMux(testConfig()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	for _, want := range []string{"<!doctype html>", "<title>Go HTML Template</title>", "<h1>Hello World!</h1>", "</html>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /: expected %q in body, got %s", want, body)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	templateFuncs["shout"] = func(s string) string { return strings.ToUpper(s) + "!" }
+	defer delete(templateFuncs, "shout")
+
+	store := memStore{
+		"templates/base.html": "",
+		"templates/page.html": `{{ shout .Name }} {{ title .Name }} {{ formatDate .Date "Jan 2, 2006" }} {{ join .Tags ", " }}`,
+	}
+	pages, err := parseTemplates(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := pages["page.html"]
+	buf := new(bytes.Buffer)
+	data := map[string]interface{}{
+		"Name": "hello world",
+		"Date": time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC),
+		"Tags": []string{"go", "html"},
+	}
+	if err := tpl.ExecuteTemplate(buf, "page.html", data); err != nil {
+		t.Fatal(err)
+	}
+	if want := "HELLO WORLD! Hello World Mar 1, 2017 go, html"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestFormatDateZero(t *testing.T) {
+	if got := formatDate(time.Time{}, "2006"); got != "" {
+		t.Errorf("formatDate(zero): got %q, want empty", got)
+	}
+}
+
+func TestRenderStatus(t *testing.T) {
+	store := memStore{
+		"templates/base.html":  "",
+		"templates/error.html": `<p>{{ .Data }}</p>`,
+		"templates/bad.html":   `<p>Partial {{ .Data.Missing.Field }}</p>`,
+	}
+	pages, err := parseTemplates(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		page     string
+		code     int
+		data     interface{}
+		wantCode int
+		wantBody string
+	}{
+		{"error.html", 404, "Not found", 404, "<p>Not found</p>"},
+		{"error.html", 422, "Invalid email", 422, "<p>Invalid email</p>"},
+		{"bad.html", 422, map[string]interface{}{"Missing": 3}, 500, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		renderStatus(w, httptest.NewRequest("GET", "/", nil), pages[tt.page], tt.page, tt.code, tt.data)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s (%d): got code %d, want %d", tt.page, tt.code, w.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+			t.Errorf("%s (%d): got body %q, want %q", tt.page, tt.code, w.Body.String(), tt.wantBody)
+		}
+		if tt.wantCode == 500 && strings.Contains(w.Body.String(), "<p>Partial") {
+			t.Errorf("%s (%d): expected no partial output, got %q", tt.page, tt.code, w.Body.String())
+		}
+	}
+}
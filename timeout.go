@@ -0,0 +1,55 @@
+package main
+
+// Per-request timeouts.
+
+import (
+	"net/http"
+	"time"
+)
+
+const timeoutPage = `<!doctype html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <title>Request timed out</title>
+  </head>
+  <body>
+    <h1>Request timed out</h1>
+    <p>The server took too long to respond. Please try again later.</p>
+  </body>
+</html>
+`
+
+// requestTimeout returns how long c allows a request to path to take: the
+// timeout for the longest prefix in RouteTimeouts that path is at or below,
+// or RequestTimeout. Zero means no limit.
+func requestTimeout(c *FileConfig, path string) time.Duration {
+	if c == nil {
+		return 0
+	}
+	timeout, matched := c.RequestTimeout.Duration, ""
+	for prefix, d := range c.RouteTimeouts {
+		if hasPathPrefix(path, prefix) && len(prefix) > len(matched) {
+			timeout, matched = d.Duration, prefix
+		}
+	}
+	return timeout
+}
+
+// withTimeout responds with a 503 if h takes longer than the timeout for the
+// request path in the current config, and cancels the request context so h
+// can stop working. The response is buffered until h returns, so h can't
+// stream its response or use http.Flusher; give routes that need to a longer
+// timeout in route_timeouts, or "0s" for none. WebSocket requests aren't
+// limited, since the connection outlives the request.
+func withTimeout(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := requestTimeout(currentConfig(), r.URL.Path)
+		if d <= 0 || isWebSocket(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		// TimeoutHandler would treat a 103 as the final status code.
+		http.TimeoutHandler(h, d, timeoutPage).ServeHTTP(w, withoutEarlyHints(r))
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.RequestTimeout = Duration{20 * time.Millisecond}
+	c.RouteTimeouts = map[string]Duration{"/slow": {time.Second}, "/stream": {}}
+	setLive(c, NewRandomKey())
+	if d := requestTimeout(c, "/slowly"); d != 20*time.Millisecond {
+		t.Errorf("/slowly: got timeout %v, want the default 20ms", d)
+	}
+	canceled := make(chan bool, 1)
+	h := withTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			canceled <- true
+		case <-time.After(100 * time.Millisecond):
+			canceled <- false
+			w.Write([]byte("done"))
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 503 {
+		t.Errorf("slow handler: got code %d, want 503", w.Code)
+	}
+	if !<-canceled {
+		t.Error("expected the request context to be canceled")
+	}
+
+	for _, path := range []string{"/slow/report", "/stream"} {
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		<-canceled
+		if w.Code != 200 || w.Body.String() != "done" {
+			t.Errorf("%s: got %d %q, want the handler to finish", path, w.Code, w.Body.String())
+		}
+	}
+}
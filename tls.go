@@ -0,0 +1,373 @@
+package main
+
+// Helpers for configuring TLS.
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/kevinburke/handlers"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// AutoTLSConfig configures automatic certificates from Let's Encrypt.
+type AutoTLSConfig struct {
+	// Hosts to get certificates for. If empty, certificates are loaded from
+	// CertFile and KeyFile instead.
+	Hosts []string `yaml:"hosts" json:"hosts" toml:"hosts"`
+
+	// CacheDir stores certificates so they survive a restart. Defaults to
+	// DefaultAutoTLSCacheDir.
+	CacheDir string `yaml:"cache_dir" json:"cache_dir" toml:"cache_dir"`
+
+	// Email is an optional contact address for certificate problems.
+	Email string `yaml:"email" json:"email" toml:"email"`
+}
+
+// CertKeyPair is the location of a certificate and its private key.
+type CertKeyPair struct {
+	CertFile string `yaml:"cert_file" json:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file" toml:"key_file"`
+}
+
+// certKeyPairs returns every cert and key file pair configured in c.
+func certKeyPairs(c *FileConfig) []CertKeyPair {
+	var pairs []CertKeyPair
+	if c.CertFile != "" || c.KeyFile != "" {
+		pairs = append(pairs, CertKeyPair{CertFile: c.CertFile, KeyFile: c.KeyFile})
+	}
+	return append(pairs, c.Certificates...)
+}
+
+// DefaultAutoTLSCacheDir is where certificates from Let's Encrypt are stored
+// if no cache directory is configured.
+const DefaultAutoTLSCacheDir = ".autocert"
+
+// Enabled reports whether certificates should come from Let's Encrypt.
+func (a AutoTLSConfig) Enabled() bool {
+	return len(a.Hosts) > 0
+}
+
+// certSource provides a certificate during each TLS handshake. It's
+// implemented by *certStore and *autocert.Manager.
+type certSource interface {
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+}
+
+// certManager gets certificates for the server on demand, and answers
+// challenges to prove the server controls its hostnames. It's implemented by
+// *autocert.Manager.
+type certManager interface {
+	certSource
+	HTTPHandler(fallback http.Handler) http.Handler
+}
+
+// newCertManager returns a certManager that gets certificates from Let's
+// Encrypt for the hosts in c.AutoTLS.
+func newCertManager(c *FileConfig) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(c.AutoTLS.Hosts...),
+		Cache:      autocert.DirCache(c.AutoTLS.CacheDir),
+		Email:      c.AutoTLS.Email,
+	}
+}
+
+// newTLSConfig returns the TLS config for the server, which gets certificates
+// from certs.
+func newTLSConfig(c *FileConfig, certs certSource) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(c.MinTLSVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCipherSuites(c.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+	}
+	if c.AutoTLS.Enabled() {
+		config.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	}
+	if c.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, nil
+}
+
+// ClientSubject returns the subject of the client's verified TLS certificate,
+// if it presented one.
+func ClientSubject(ctx context.Context) (pkix.Name, bool) {
+	name, ok := ctx.Value(clientSubjectKey).(pkix.Name)
+	return name, ok
+}
+
+// withClientSubject stores the subject of the client's verified certificate in
+// the request context, so handlers can retrieve it with ClientSubject.
+func withClientSubject(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			subject := r.TLS.VerifiedChains[0][0].Subject
+			r = r.WithContext(context.WithValue(r.Context(), clientSubjectKey, subject))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// withTLSInfo adds the TLS version and cipher suite of the connection, like
+// "TLS 1.3" and "TLS_AES_128_GCM_SHA256", to the access log line and the
+// request logger. Requests over plain HTTP are logged without them.
+func withTLSInfo(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			version, cipher := tls.VersionName(r.TLS.Version), tls.CipherSuiteName(r.TLS.CipherSuite)
+			handlers.AppendLog(r, "tls_version", version, "tls_cipher", cipher)
+			l := LoggerFrom(r.Context()).New("tls_version", version, "tls_cipher", cipher)
+			r = r.WithContext(context.WithValue(r.Context(), loggerKey, l))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// DefaultCertPollInterval is how often a certStore checks whether its cert
+// and key files have changed.
+const DefaultCertPollInterval = time.Minute
+
+// certStore holds the certificates loaded from the cert and key files in a
+// config. The certificates can be reloaded while the server is running;
+// connections that are already open keep using the old certificate.
+type certStore struct {
+	config *FileConfig
+	certs  atomic.Value // []tls.Certificate
+
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+}
+
+// newCertStore loads the certificates in c.
+func newCertStore(c *FileConfig) (*certStore, error) {
+	s := &certStore{config: c}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetCertificate returns the first certificate that's valid for the hostname
+// in hello, or the first certificate if none match.
+func (s *certStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := s.certs.Load().([]tls.Certificate)
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates loaded")
+	}
+	for i := range certs {
+		if hello.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i], nil
+		}
+	}
+	return &certs[0], nil
+}
+
+// reload loads the certificates from disk. If they can't be loaded, the old
+// certificates stay in use.
+func (s *certStore) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	modTimes := s.currentModTimes()
+	certs, err := loadCertificates(s.config)
+	if err != nil {
+		return err
+	}
+	s.certs.Store(certs)
+	s.modTimes = modTimes
+	return nil
+}
+
+// changed reports whether any cert or key file has been modified since the
+// certificates were loaded.
+func (s *certStore) changed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, modTime := range s.currentModTimes() {
+		if !modTime.Equal(s.modTimes[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *certStore) currentModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, pair := range certKeyPairs(s.config) {
+		for _, name := range []string{pair.CertFile, pair.KeyFile} {
+			if fi, err := os.Stat(name); err == nil {
+				modTimes[name] = fi.ModTime()
+			}
+		}
+	}
+	return modTimes
+}
+
+// watch reloads the certificates when the process receives SIGHUP, or when a
+// cert or key file changes, checking every interval.
+func (s *certStore) watch(interval time.Duration) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sig:
+			case <-ticker.C:
+				if !s.changed() {
+					continue
+				}
+			}
+			if err := s.reload(); err != nil {
+				logger.Error("Couldn't reload certificates; keeping the old ones", "err", err)
+				continue
+			}
+			logger.Info("Reloaded certificates")
+		}
+	}()
+}
+
+// loadCertificates loads every cert and key file pair in c. If a pair doesn't
+// exist and c.DevCert is set, a self-signed certificate for localhost is
+// generated in its place.
+func loadCertificates(c *FileConfig) ([]tls.Certificate, error) {
+	pairs := certKeyPairs(c)
+	certs := make([]tls.Certificate, 0, len(pairs))
+	for _, pair := range pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if os.IsNotExist(err) && c.DevCert {
+			logger.Warn("Using a generated self-signed certificate; don't do this in production", "cert_file", pair.CertFile, "key_file", pair.KeyFile)
+			cert, err = generateCert("localhost", "127.0.0.1", "::1")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %v", pair.CertFile, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// parseTLSVersion returns the tls.VersionTLS* constant for a version string
+// like "1.2". An empty string is treated as "1.2".
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version %q; use \"1.2\" or \"1.3\"", version)
+	}
+}
+
+// parseCipherSuites returns the IDs of the named cipher suites. If names is
+// empty, parseCipherSuites returns nil, so Go's defaults are used. Unknown
+// and insecure cipher suites are an error.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint16, len(names))
+	for i, name := range names {
+		id, ok := findCipherSuite(tls.CipherSuites(), name)
+		if !ok {
+			if _, insecure := findCipherSuite(tls.InsecureCipherSuites(), name); insecure {
+				return nil, fmt.Errorf("cipher suite %q is insecure", name)
+			}
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func findCipherSuite(suites []*tls.CipherSuite, name string) (uint16, bool) {
+	for _, suite := range suites {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// generateCert returns a self-signed certificate, valid for a year, for the
+// given host names and IP addresses.
+func generateCert(hosts ...string) (tls.Certificate, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"go-html-boilerplate development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  priv,
+		Leaf:        leaf,
+	}, nil
+}
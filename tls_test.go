@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevinburke/handlers"
+)
+
+type stubManager struct {
+	cert  *tls.Certificate
+	hello *tls.ClientHelloInfo
+}
+
+func (s *stubManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.hello = hello
+	return s.cert, nil
+}
+
+func (s *stubManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/acme-challenge/token" {
+			w.Write([]byte("challenge"))
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+func TestNewTLSConfigAutoTLS(t *testing.T) {
+	c := testConfig()
+	c.HTTPOnly = false
+	c.AutoTLS.Hosts = []string{"example.com"}
+	if err := c.setDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("expected missing cert files to be allowed with auto_tls, got %v", err)
+	}
+	m := &stubManager{cert: new(tls.Certificate)}
+	config, err := newTLSConfig(c, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) != 0 {
+		t.Errorf("expected no static certificates, got %d", len(config.Certificates))
+	}
+	hello := &tls.ClientHelloInfo{ServerName: "example.com"}
+	cert, err := config.GetCertificate(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert != m.cert || m.hello != hello {
+		t.Error("expected GetCertificate to be answered by the cert manager")
+	}
+
+	s := httptest.NewServer(newRedirectServer(c, m).Handler)
+	defer s.Close()
+	res, err := http.Get(s.URL + "/.well-known/acme-challenge/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("challenge: got code %d, want 200", res.StatusCode)
+	}
+}
+
+func TestNewTLSConfigStaticCerts(t *testing.T) {
+	c := testConfig()
+	c.CertFile = "testdata/missing-cert.pem"
+	c.KeyFile = "testdata/missing-key.pem"
+	if _, err := newCertStore(c); err == nil {
+		t.Error("expected an error loading missing cert files, got nil")
+	}
+}
+
+func TestDevCert(t *testing.T) {
+	c := testConfig()
+	c.HTTPOnly = false
+	c.DevCert = true
+	c.BindAddress = "127.0.0.1"
+	port := 0
+	c.Port = &port
+	c.CertFile = "testdata/missing-cert.pem"
+	c.KeyFile = "testdata/missing-key.pem"
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(c, NewServeMux(c))
+	store, err := newCertStore(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.TLSConfig, err = newTLSConfig(c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listen(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(srv, ln, c)
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(store.certs.Load().([]tls.Certificate)[0].Leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	_, port2, _ := net.SplitHostPort(ln.Addr().String())
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		res, err := client.Get("https://" + net.JoinHostPort(host, port2) + "/")
+		if err != nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 200 {
+			t.Errorf("%s: got code %d, want 200", host, res.StatusCode)
+		}
+		if res.TLS == nil {
+			t.Errorf("%s: expected a TLS connection", host)
+		}
+	}
+}
+
+func TestDevCertRequiresOptIn(t *testing.T) {
+	c := testConfig()
+	c.HTTPOnly = false
+	c.CertFile = "testdata/missing-cert.pem"
+	c.KeyFile = "testdata/missing-key.pem"
+	if err := c.Validate(); err == nil {
+		t.Error("expected missing cert files to be an error without dev_cert")
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint16
+	}{
+		{"", tls.VersionTLS12},
+		{"1.2", tls.VersionTLS12},
+		{"1.3", tls.VersionTLS13},
+	}
+	for _, tt := range tests {
+		got, err := parseTLSVersion(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %x, want %x", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"1.0", "1.1", "TLS1.3", "2"} {
+		if _, err := parseTLSVersion(in); err == nil {
+			t.Errorf("%q: expected an error, got nil", in)
+		}
+	}
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	c := testConfig()
+	if err := parseConfig("config.yml", []byte("min_tls_version: \"1.3\"\n"), c); err != nil {
+		t.Fatal(err)
+	}
+	config, err := newTLSConfig(c, &stubManager{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion: got %x, want TLS 1.3", config.MinVersion)
+	}
+
+	c = testConfig()
+	c.MinTLSVersion = "1.1"
+	if err := c.Validate(); err == nil {
+		t.Error("expected an error for min_tls_version 1.1, got nil")
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := parseCipherSuites([]string{
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}
+	if len(ids) != len(want) || ids[0] != want[0] || ids[1] != want[1] {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+
+	if ids, err := parseCipherSuites(nil); err != nil || ids != nil {
+		t.Errorf("empty list: got (%v, %v), want (nil, nil)", ids, err)
+	}
+
+	for _, name := range []string{"TLS_MADE_UP_CIPHER", "TLS_RSA_WITH_RC4_128_SHA"} {
+		if _, err := parseCipherSuites([]string{name}); err == nil {
+			t.Errorf("%s: expected an error, got nil", name)
+		}
+	}
+
+	c := testConfig()
+	c.CipherSuites = []string{"TLS_MADE_UP_CIPHER"}
+	if err := c.Validate(); err == nil {
+		t.Error("expected Validate to reject an unknown cipher suite")
+	}
+	c.CipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	config, err := newTLSConfig(c, &stubManager{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.CipherSuites) != 1 || config.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("CipherSuites: got %v", config.CipherSuites)
+	}
+}
+
+// writeCert generates a self-signed certificate for host and writes it and its
+// key to PEM files in dir.
+func writeCert(t *testing.T, dir string, host string) (CertKeyPair, *x509.Certificate) {
+	t.Helper()
+	cert, err := generateCert(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair := CertKeyPair{
+		CertFile: filepath.Join(dir, host+".crt"),
+		KeyFile:  filepath.Join(dir, host+".key"),
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(pair.CertFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pair.KeyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return pair, cert.Leaf
+}
+
+func TestMultipleCertificatesSNI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pairA, leafA := writeCert(t, dir, "a.example.com")
+	pairB, leafB := writeCert(t, dir, "b.example.com")
+
+	c := testConfig()
+	c.HTTPOnly = false
+	c.BindAddress = "127.0.0.1"
+	port := 0
+	c.Port = &port
+	c.Certificates = []CertKeyPair{pairA, pairB}
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.CertFile != "" {
+		t.Errorf("expected no default cert_file when certificates is set, got %q", c.CertFile)
+	}
+	srv := newServer(c, NewServeMux(c))
+	store, err := newCertStore(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.certs.Load().([]tls.Certificate)); n != 2 {
+		t.Fatalf("got %d certificates, want 2", n)
+	}
+	srv.TLSConfig, err = newTLSConfig(c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listen(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(srv, ln, c)
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leafA)
+	pool.AddCert(leafB)
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{ServerName: host, RootCAs: pool})
+		if err != nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		names := conn.ConnectionState().PeerCertificates[0].DNSNames
+		conn.Close()
+		if len(names) != 1 || names[0] != host {
+			t.Errorf("%s: server presented a certificate for %v", host, names)
+		}
+	}
+}
+
+func TestCertStoreReloadsChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pair, oldLeaf := writeCert(t, dir, "localhost")
+
+	c := testConfig()
+	c.HTTPOnly = false
+	c.BindAddress = "127.0.0.1"
+	port := 0
+	c.Port = &port
+	c.CertFile = pair.CertFile
+	c.KeyFile = pair.KeyFile
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	store, err := newCertStore(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(c, NewServeMux(c))
+	srv.TLSConfig, err = newTLSConfig(c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := listen(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(srv, ln, c)
+	defer srv.Close()
+
+	serial := func() string {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{ServerName: "localhost", InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.String()
+	}
+	if got := serial(); got != oldLeaf.SerialNumber.String() {
+		t.Fatalf("got serial %s, want %s", got, oldLeaf.SerialNumber)
+	}
+
+	if store.changed() {
+		t.Error("expected no change before the files are rewritten")
+	}
+	_, newLeaf := writeCert(t, dir, "localhost")
+	// Make sure the modification time changes, even on filesystems with
+	// coarse timestamps.
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(pair.CertFile, later, later)
+	os.Chtimes(pair.KeyFile, later, later)
+
+	store.watch(10 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for serial() != newLeaf.SerialNumber.String() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the new certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newCA returns a certificate authority that can sign client certificates.
+func newCA(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv, Leaf: leaf}
+}
+
+// newClientCert returns a client certificate for commonName, signed by ca.
+func newClientCert(t *testing.T, ca tls.Certificate, commonName string) tls.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, &priv.PublicKey, ca.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
+
+func TestRequireClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-html-boilerplate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newCA(t, "Test CA")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	untrustedCA := newCA(t, "Untrusted CA")
+
+	c := testConfig()
+	c.HTTPOnly = false
+	c.DevCert = true
+	c.CertFile = filepath.Join(dir, "missing-cert.pem")
+	c.KeyFile = filepath.Join(dir, "missing-key.pem")
+	c.ClientCAFile = caFile
+	c.RequireClientCert = true
+	if _, err := setupConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	store, err := newCertStore(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewUnstartedServer(withClientSubject(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, ok := ClientSubject(r.Context())
+		if !ok {
+			t.Error("expected a client subject in the request context")
+		}
+		w.Write([]byte(subject.CommonName))
+	})))
+	s.TLS, err = newTLSConfig(c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.StartTLS()
+	defer s.Close()
+
+	get := func(certs ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       certs,
+		}}}
+		res, err := client.Get(s.URL)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		return string(body), err
+	}
+
+	body, err := get(newClientCert(t, ca, "alice"))
+	if err != nil {
+		t.Fatalf("trusted client cert: %v", err)
+	}
+	if body != "alice" {
+		t.Errorf("trusted client cert: got subject %q, want alice", body)
+	}
+	if _, err := get(); err == nil {
+		t.Error("no client cert: expected the request to be rejected")
+	}
+	if _, err := get(newClientCert(t, untrustedCA, "mallory")); err == nil {
+		t.Error("untrusted client cert: expected the request to be rejected")
+	}
+}
+
+func TestRequireClientCertNeedsCA(t *testing.T) {
+	c := testConfig()
+	c.RequireClientCert = true
+	if err := c.Validate(); err == nil {
+		t.Error("expected an error for require_client_cert without client_ca_file")
+	}
+}
+
+func TestTLSInfoLogged(t *testing.T) {
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	buf := new(bytes.Buffer)
+	setLogFormat(handlers.Logger, "logfmt", buf)
+
+	mux := withRequestID(logRequests(withTLSInfo(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LoggerFrom(r.Context()).Info("Handled request")
+	}))))
+	s := httptest.NewTLSServer(mux)
+	defer s.Close()
+	res, err := s.Client().Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	want := fmt.Sprintf("tls_version=\"TLS 1.3\" tls_cipher=%s", tls.CipherSuiteName(res.TLS.CipherSuite))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %q", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, want) {
+			t.Errorf("got log line %q, want it to contain %q", line, want)
+		}
+	}
+
+	buf.Reset()
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(buf.String(), "tls_") {
+		t.Errorf("plain HTTP: got log output %q, want no TLS fields", buf.String())
+	}
+}
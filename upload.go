@@ -0,0 +1,148 @@
+package main
+
+// Reading files uploaded in multipart forms.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+// DefaultMaxUploadBytes is the largest uploaded file formFile accepts, if no
+// MaxUploadBytes is configured. Requests also have to fit in the body limit,
+// so raise that too for routes that take larger files.
+const DefaultMaxUploadBytes = 1 << 20
+
+// DefaultUploadTypes are the content types formFile accepts, if no
+// UploadTypes are configured. SVG isn't included since it can contain
+// scripts.
+var DefaultUploadTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// An Upload is a file from a multipart form.
+type Upload struct {
+	multipart.File
+
+	// Filename is the name of the file on the client. Don't use it as a
+	// path on the server.
+	Filename string
+	// ContentType is sniffed from the start of the file with
+	// http.DetectContentType, so it doesn't depend on what the client says.
+	ContentType string
+	Size        int64
+}
+
+// An uploadError means an uploaded file was missing or wasn't allowed.
+type uploadError struct {
+	status int
+	msg    string
+}
+
+func (e *uploadError) Error() string {
+	return e.msg
+}
+
+// formFile returns the file uploaded in field of the multipart form in r,
+// checking it against the max_upload_bytes and upload_types in the current
+// config. Read it like any other file, and close it when you're done:
+//
+//	f, err := formFile(r, "avatar")
+//	if err != nil {
+//		uploadFailed(w, r, err)
+//		return
+//	}
+//	defer f.Close()
+//
+// Files over the size limit, or with a type that isn't allowed, return an
+// *uploadError, as does a missing file. Bodies over the limit set by
+// withBodyLimit return an error for which isBodyTooLarge is true. Handle them
+// all with uploadFailed.
+func formFile(r *http.Request, field string) (*Upload, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return nil, &uploadError{http.StatusUnsupportedMediaType, "uploads must be sent as multipart/form-data"}
+	}
+	// withCSRF may have parsed the form already; if so this does nothing.
+	if err := parseForm(r); err != nil {
+		if isBodyTooLarge(err) {
+			return nil, err
+		}
+		return nil, &uploadError{http.StatusBadRequest, fmt.Sprintf("invalid form: %v", err)}
+	}
+	headers := r.MultipartForm.File[field]
+	if len(headers) == 0 {
+		return nil, &uploadError{http.StatusBadRequest, field + " is required"}
+	}
+	fh := headers[0]
+	maxSize, types := int64(DefaultMaxUploadBytes), DefaultUploadTypes
+	if c := currentConfig(); c != nil {
+		if c.MaxUploadBytes > 0 {
+			maxSize = c.MaxUploadBytes
+		}
+		if len(c.UploadTypes) > 0 {
+			types = c.UploadTypes
+		}
+	}
+	if fh.Size > maxSize {
+		return nil, &uploadError{http.StatusRequestEntityTooLarge, fmt.Sprintf("%s is larger than %d bytes", field, maxSize)}
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := sniffContentType(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !allowedType(contentType, types) {
+		f.Close()
+		return nil, &uploadError{http.StatusUnsupportedMediaType, fmt.Sprintf("%s has type %s, which isn't allowed", field, contentType)}
+	}
+	return &Upload{File: f, Filename: fh.Filename, ContentType: contentType, Size: fh.Size}, nil
+}
+
+// sniffContentType detects the type of f from its first 512 bytes, and seeks
+// back to the start.
+func sniffContentType(f multipart.File) (string, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func allowedType(contentType string, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadFailed responds to an error from formFile: a 413 if the body or file
+// was too large, a 415 if the file type isn't allowed, or a 400 otherwise.
+func uploadFailed(w http.ResponseWriter, r *http.Request, err error) {
+	if isBodyTooLarge(err) {
+		bodyTooLarge(w, r)
+		return
+	}
+	var ue *uploadError
+	if errors.As(err, &ue) {
+		writeError(w, ue.status, ue.msg)
+		return
+	}
+	LoggerFrom(r.Context()).Error("Could not read uploaded file", "err", err)
+	writeError(w, http.StatusBadRequest, "Could not read uploaded file")
+}
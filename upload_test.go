@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// onePixelPNG is a 1x1 transparent PNG.
+var onePixelPNG, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII=")
+
+func uploadRequest(t *testing.T, field, filename, contentType string, data []byte) *http.Request {
+	t.Helper()
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	hdr := textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="` + field + `"; filename="` + filename + `"`},
+		"Content-Type":        {contentType},
+	}
+	part, err := mw.CreatePart(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	mw.Close()
+	req := httptest.NewRequest("POST", "/avatar", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// avatarHandler responds with the sniffed type and contents of the avatar.
+var avatarHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	f, err := formFile(r, "avatar")
+	if err != nil {
+		uploadFailed(w, r, err)
+		return
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		uploadFailed(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Write(data)
+})
+
+func TestFormFile(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.MaxUploadBytes = 100
+	setLive(c, NewRandomKey())
+
+	w := httptest.NewRecorder()
+	avatarHandler.ServeHTTP(w, uploadRequest(t, "avatar", "me.png", "image/png", onePixelPNG))
+	if w.Code != 200 {
+		t.Fatalf("valid upload: got code %d, want 200: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("valid upload: got type %q, want image/png", ct)
+	}
+	if !bytes.Equal(w.Body.Bytes(), onePixelPNG) {
+		t.Error("valid upload: the file contents changed")
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		code int
+		want string
+	}{
+		{"too large", uploadRequest(t, "avatar", "me.png", "image/png", append(onePixelPNG, make([]byte, 100)...)), 413, "larger than 100 bytes"},
+		// The client says it's a PNG, but it's HTML.
+		{"disallowed type", uploadRequest(t, "avatar", "me.png", "image/png", []byte("<html><script>alert(1)</script></html>")), 415, "text/html"},
+		{"missing file", uploadRequest(t, "photo", "me.png", "image/png", onePixelPNG), 400, "avatar is required"},
+		{"not multipart", httptest.NewRequest("POST", "/avatar", strings.NewReader("avatar=me.png")), 415, "multipart/form-data"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		avatarHandler.ServeHTTP(w, tt.req)
+		if w.Code != tt.code {
+			t.Errorf("%s: got code %d, want %d", tt.name, w.Code, tt.code)
+		}
+		if !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: got body %q, want it to contain %q", tt.name, w.Body, tt.want)
+		}
+	}
+}
+
+func TestFormFileBodyLimit(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.MaxBodyBytes = 100
+	setLive(c, NewRandomKey())
+	req := uploadRequest(t, "avatar", "me.png", "image/png", append(onePixelPNG, make([]byte, 100)...))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	withBodyLimit(avatarHandler).ServeHTTP(w, req)
+	if w.Code != 413 {
+		t.Errorf("got code %d, want 413", w.Code)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+// Checking decoded request bodies against validate tags.
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A FieldError is a problem with one field of a form or JSON body. Field is
+// the name of the field in the form or JSON, not the struct.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists every field that failed validation, in the order of
+// the struct fields.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + " " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// For returns the message for field, or the empty string if it's valid. Use
+// it to show errors next to the inputs when a form is rendered again:
+//
+//	<input name="email"> {{ .Errors.For "email" }}
+func (e ValidationErrors) For(field string) string {
+	for _, fe := range e {
+		if fe.Field == field {
+			return fe.Message
+		}
+	}
+	return ""
+}
+
+// Flash queues each error as an error flash message in the session for ctx,
+// to show on the form after redirecting back to it.
+func (e ValidationErrors) Flash(ctx context.Context) {
+	for _, fe := range e {
+		AddFlash(ctx, LevelError, fe.Field+" "+fe.Message)
+	}
+}
+
+// validate checks the fields of the struct v points to against their validate
+// tags, and returns ValidationErrors listing the fields that failed, or nil.
+// A tag is a comma-separated list of rules:
+//
+//	required  the field isn't the zero value
+//	min=N     a string has at least N characters, or a number is at least N
+//	max=N     a string has at most N characters, or a number is at most N
+//	email     a string is an email address, like "gopher@example.com"
+//
+// Rules other than required pass for empty fields, so optional fields can be
+// left out. For example:
+//
+//	type signup struct {
+//		Email string `form:"email" validate:"required,email"`
+//		Name  string `form:"name" validate:"max=100"`
+//	}
+//
+// validate panics if a tag has an unknown rule.
+func validate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic("validate: v must be a struct or a pointer to one, got " + rv.Type().String())
+	}
+	var errs ValidationErrors
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		name := formName(field)
+		if tag == "" || name == "" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			if msg := checkRule(rv.Field(i), field, rule); msg != "" {
+				errs = append(errs, FieldError{Field: name, Message: msg})
+				break
+			}
+		}
+	}
+	if errs == nil {
+		return nil
+	}
+	return errs
+}
+
+// checkRule returns a message if v doesn't pass rule, or the empty string.
+func checkRule(v reflect.Value, field reflect.StructField, rule string) string {
+	rule, arg := strings.TrimSpace(rule), ""
+	if i := strings.IndexByte(rule, '='); i >= 0 {
+		rule, arg = rule[:i], rule[i+1:]
+	}
+	if rule == "required" {
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}
+	if v.IsZero() {
+		return ""
+	}
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: %s: %s needs a number, got %q", field.Name, rule, arg))
+		}
+		n, unit := validateSize(v, field)
+		if rule == "min" && n < limit {
+			return "must be at least " + arg + unit
+		}
+		if rule == "max" && n > limit {
+			return "must be at most " + arg + unit
+		}
+	case "email":
+		if v.Kind() != reflect.String {
+			panic("validate: " + field.Name + ": email only applies to strings")
+		}
+		addr, err := mail.ParseAddress(v.String())
+		if err != nil || addr.Address != v.String() {
+			return "is not a valid email address"
+		}
+	default:
+		panic(fmt.Sprintf("validate: %s: unknown rule %q", field.Name, rule))
+	}
+	return ""
+}
+
+// validateSize returns the length of a string, slice or map, or the value of
+// a number, and the unit to use in messages about it.
+func validateSize(v reflect.Value, field reflect.StructField) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Map:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	panic("validate: " + field.Name + ": min and max don't apply to a " + v.Type().String())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type profile struct {
+	Email string   `json:"email" validate:"required,email"`
+	Name  string   `form:"name" json:"full_name" validate:"required,min=2,max=10"`
+	Age   int      `json:"age" validate:"min=13,max=120"`
+	Tags  []string `json:"tags" validate:"max=2"`
+	Bio   string   `json:"bio"`
+}
+
+func TestValidateStruct(t *testing.T) {
+	valid := profile{Email: "gopher@example.com", Name: "Gopher", Age: 13, Tags: []string{"go"}}
+	if err := validate(&valid); err != nil {
+		t.Errorf("valid struct: got error %v", err)
+	}
+
+	tests := []struct {
+		name string
+		p    profile
+		want ValidationErrors
+	}{
+		{"missing required", profile{Name: "Gopher"}, ValidationErrors{{"email", "is required"}}},
+		{"too long", profile{Email: "gopher@example.com", Name: "Gopher Gopherson"}, ValidationErrors{{"name", "must be at most 10 characters"}}},
+		{"multibyte", profile{Email: "gopher@example.com", Name: "ゴーファー"}, nil},
+		{"too short", profile{Email: "gopher@example.com", Name: "G"}, ValidationErrors{{"name", "must be at least 2 characters"}}},
+		{"bad email", profile{Email: "Gopher <gopher@example.com>", Name: "Gopher"}, ValidationErrors{{"email", "is not a valid email address"}}},
+		{"number", profile{Email: "gopher@example.com", Name: "Gopher", Age: 7}, ValidationErrors{{"age", "must be at least 13"}}},
+		{"slice", profile{Email: "gopher@example.com", Name: "Gopher", Tags: []string{"a", "b", "c"}}, ValidationErrors{{"tags", "must be at most 2 items"}}},
+		{"several", profile{Name: "Gopher Gopherson"}, ValidationErrors{{"email", "is required"}, {"name", "must be at most 10 characters"}}},
+	}
+	for _, tt := range tests {
+		err := validate(tt.p)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: got error %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		got, ok := err.(ValidationErrors)
+		if !ok {
+			t.Errorf("%s: got %#v, want ValidationErrors", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidationErrorsOutput(t *testing.T) {
+	err := validate(profile{Name: "Gopher Gopherson"}).(ValidationErrors)
+	if got := err.For("name"); got != "must be at most 10 characters" {
+		t.Errorf("For(name): got %q", got)
+	}
+	if got := err.For("bio"); got != "" {
+		t.Errorf("For(bio): got %q, want none", got)
+	}
+	b, jsonErr := json.Marshal(err)
+	if jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+	want := `[{"field":"email","message":"is required"},{"field":"name","message":"must be at most 10 characters"}]`
+	if string(b) != want {
+		t.Errorf("JSON: got %s, want %s", b, want)
+	}
+
+	ctx := context.WithValue(context.Background(), sessionKey, &sessionState{values: Session{}})
+	err.Flash(ctx)
+	flashes := GetFlashes(ctx)
+	if len(flashes) != 2 || flashes[0].Level != LevelError || flashes[0].Message != "email is required" {
+		t.Errorf("got flashes %v", flashes)
+	}
+}
+
+func TestValidateUnknownRule(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "unknown rule") {
+			t.Errorf("got panic %v, want an unknown rule", r)
+		}
+	}()
+	validate(struct {
+		Name string `validate:"uppercase"`
+	}{Name: "gopher"})
+}
@@ -0,0 +1,172 @@
+package main
+
+// An example WebSocket endpoint, as a starting point for real-time features.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// wsMaxMessageBytes is the largest message echoWebSocket accepts. Bigger ones
+// close the connection.
+const wsMaxMessageBytes = 64 << 10
+
+// isWebSocket reports whether r asks to upgrade to a WebSocket connection.
+func isWebSocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// webSocketHandler upgrades requests to WebSocket connections handled by h.
+// Browsers send cookies with WebSocket requests from any site, so requests
+// from other origins are rejected with a 403 unless the CORS config allows
+// them. Clients that aren't browsers don't send an Origin and are allowed.
+func webSocketHandler(h websocket.Handler) http.Handler {
+	ws := websocket.Server{Handshake: checkWebSocketOrigin, Handler: h}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebSocket(r) {
+			w.Header().Set("Upgrade", "websocket")
+			writeError(w, http.StatusUpgradeRequired, "This endpoint only accepts WebSocket connections")
+			return
+		}
+		hj, ok := w.(http.Hijacker)
+		if sw, found := r.Context().Value(serverWriterKey).(*serverWriter); found {
+			hj, ok = sw, sw.canHijack()
+		}
+		if !ok {
+			LoggerFrom(r.Context()).Error("Can't upgrade to a WebSocket: the ResponseWriter can't be hijacked")
+			writeError(w, http.StatusInternalServerError, "WebSocket connections aren't supported")
+			return
+		}
+		// The middleware between here and the http.Server doesn't need to
+		// see the connection once it's hijacked.
+		hw := &hijackWriter{ResponseWriter: w, hj: hj}
+		ws.ServeHTTP(hw, r)
+		// The handshake response went straight to the connection, so tell
+		// the middleware, like the access log, what its status was.
+		if hw.status != 0 {
+			w.WriteHeader(hw.status)
+		}
+	})
+}
+
+// hijackWriter hijacks the http.Server's connection under a ResponseWriter
+// from middleware that can't, and records the status of the response written
+// to the connection.
+type hijackWriter struct {
+	http.ResponseWriter
+	hj     http.Hijacker
+	status int
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := w.hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	buf.Writer = bufio.NewWriter(&statusWriter{Writer: conn, status: &w.status})
+	return conn, buf, nil
+}
+
+// statusWriter sets status to the status code of the HTTP response written to
+// it, like 101 or 403.
+type statusWriter struct {
+	io.Writer
+	status *int
+	seen   bool
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if !w.seen {
+		w.seen = true
+		// The first write starts with the status line, like
+		// "HTTP/1.1 101 Switching Protocols".
+		if f := strings.Fields(string(p[:bytes.IndexByte(p, '\n')+1])); len(f) > 1 {
+			*w.status, _ = strconv.Atoi(f[1])
+		}
+	}
+	return w.Writer.Write(p)
+}
+
+// checkWebSocketOrigin allows WebSocket connections with no Origin, from the
+// same host, or from an origin allowed by the CORS config.
+func checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	config.Origin = u
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	if c := currentConfig(); c != nil && c.CORS.allowOrigin(origin) != "" {
+		return nil
+	}
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
+
+// wsMessage is a WebSocket message, text or binary.
+type wsMessage struct {
+	data        []byte
+	payloadType byte
+}
+
+// wsMessageCodec sends and receives wsMessages, keeping their type.
+var wsMessageCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		m := v.(wsMessage)
+		return m.data, m.payloadType, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		m := v.(*wsMessage)
+		m.data, m.payloadType = data, payloadType
+		return nil
+	},
+}
+
+// echoWebSocket sends every message it receives on ws back to the client,
+// until the client closes the connection or is idle for longer than the
+// idle_timeout. Copy it to start your own handler.
+func echoWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = wsMaxMessageBytes
+	logger := LoggerFrom(ws.Request().Context())
+	// The hijacked connection keeps the deadlines the http.Server set for
+	// the request.
+	ws.SetDeadline(time.Time{})
+	idle, writeTimeout := DefaultIdleTimeout, DefaultWriteTimeout
+	if c := currentConfig(); c != nil {
+		idle, writeTimeout = c.IdleTimeout.Duration, c.WriteTimeout.Duration
+	}
+	messages := 0
+	for {
+		ws.SetReadDeadline(time.Now().Add(idle))
+		var m wsMessage
+		if err := wsMessageCodec.Receive(ws, &m); err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Debug("Closing WebSocket", "err", err, "messages", messages)
+			}
+			return
+		}
+		messages++
+		ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := wsMessageCodec.Send(ws, m); err != nil {
+			logger.Debug("Could not write to WebSocket", "err", err)
+			return
+		}
+	}
+}
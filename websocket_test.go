@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/kevinburke/handlers"
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocketEcho(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.WebSocketEcho = true
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, useTLS := range []bool{false, true} {
+		var ts *httptest.Server
+		if useTLS {
+			ts = httptest.NewTLSServer(s.Handler())
+		} else {
+			ts = httptest.NewServer(s.Handler())
+		}
+		defer ts.Close()
+		origin := ts.URL
+		url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/echo"
+		config, err := websocket.NewConfig(url, origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if useTLS {
+			config.TlsConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		ws, err := websocket.DialConfig(config)
+		if err != nil {
+			t.Fatalf("TLS %t: %v", useTLS, err)
+		}
+		for _, msg := range []string{"hello", "world"} {
+			if err := websocket.Message.Send(ws, msg); err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			if err := websocket.Message.Receive(ws, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != msg {
+				t.Errorf("TLS %t: got echo %q, want %q", useTLS, got, msg)
+			}
+		}
+		if err := websocket.Message.Send(ws, []byte{0, 1, 2}); err != nil {
+			t.Fatal(err)
+		}
+		var got []byte
+		if err := websocket.Message.Receive(ws, &got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "\x00\x01\x02" {
+			t.Errorf("TLS %t: got binary echo %q", useTLS, got)
+		}
+		if err := ws.Close(); err != nil {
+			t.Errorf("TLS %t: closing: %v", useTLS, err)
+		}
+	}
+}
+
+func TestWebSocketRejectsOtherOrigins(t *testing.T) {
+	defer live.Store(getLive())
+	c := testConfig()
+	c.WebSocketEcho = true
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/echo"
+	if _, err := websocket.Dial(url, "", "https://evil.example.com"); err == nil {
+		t.Error("expected a connection from another origin to fail")
+	}
+
+	// Plain requests get a 426.
+	res, err := http.Get(ts.URL + "/ws/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("GET /ws/echo: got code %d, want 426", res.StatusCode)
+	}
+}
+
+func TestWebSocketEchoOff(t *testing.T) {
+	defer live.Store(getLive())
+	s, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/ws/echo", nil))
+	if w.Code != 404 {
+		t.Errorf("GET /ws/echo: got code %d, want 404", w.Code)
+	}
+}
+
+func TestWebSocketAccessLog(t *testing.T) {
+	defer live.Store(getLive())
+	h := handlers.Logger.GetHandler()
+	defer handlers.Logger.SetHandler(h)
+	records := make(chan *log.Record, 100)
+	handlers.Logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		select {
+		case records <- r:
+		default:
+		}
+		return nil
+	}))
+
+	c := testConfig()
+	c.WebSocketEcho = true
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/echo"
+
+	ws, err := websocket.Dial(url, "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.Close()
+	if got := accessLogStatus(t, records, "/ws/echo"); got != "101" {
+		t.Errorf("accepted connection: got status %s in the access log, want 101", got)
+	}
+
+	if _, err := websocket.Dial(url, "", "https://evil.example.com"); err == nil {
+		t.Fatal("expected a connection from another origin to fail")
+	}
+	if got := accessLogStatus(t, records, "/ws/echo"); got != "403" {
+		t.Errorf("rejected connection: got status %s in the access log, want 403", got)
+	}
+}
+
+// accessLogStatus waits for the access log line for path and returns its
+// status.
+func accessLogStatus(t *testing.T, records <-chan *log.Record, path string) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case r := <-records:
+			fields := make(map[interface{}]interface{})
+			for i := 0; i+1 < len(r.Ctx); i += 2 {
+				fields[r.Ctx[i]] = r.Ctx[i+1]
+			}
+			if fields["path"] == path && fields["status"] != nil {
+				return fields["status"].(string)
+			}
+		case <-timeout:
+			t.Fatalf("no access log line for %s", path)
+		}
+	}
+}